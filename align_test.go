@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAlignOffset(t *testing.T) {
+	tests := []struct {
+		name string
+		// Time of the clock past 12:00 when the printer is added.
+		after          time.Duration
+		period, offset int
+		// First and second ticks past 12:00.
+		first, second time.Duration
+	}{
+		{"hour at :05", 0, 3600, 300, 5 * time.Minute, time.Hour + 5*time.Minute},
+		{"hour at :05, added at :10", 10 * time.Minute, 3600, 300, time.Hour + 5*time.Minute, 2*time.Hour + 5*time.Minute},
+		{"hour without an offset", 10 * time.Minute, 3600, 0, time.Hour, 2 * time.Hour},
+		{"minute at :30", 0, 60, 30, 30 * time.Second, 90 * time.Second},
+		{"minute at :30, added at :45", 45 * time.Second, 60, 30, 90 * time.Second, 150 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClock()
+			start := c.Now()
+			c.Advance(tt.after)
+			p, sk := newTestPrinters(t, c)
+			mustAdd(t, p, spec{Name: "aligned", Period: tt.period, Align: true, Offset: tt.offset})
+			waitTimers(t, c, 1)
+
+			c.Advance(tt.first - tt.after - time.Second)
+			time.Sleep(10 * time.Millisecond)
+			if n := len(sk.Lines()); n != 0 {
+				t.Fatalf("%d lines before the aligned tick", n)
+			}
+			tick(t, c, time.Second, sk, 1)
+			if info, _ := p.Get("aligned"); info.LastTick == nil || !info.LastTick.Equal(start.Add(tt.first)) {
+				t.Errorf("first tick at %v, want %s", info.LastTick, start.Add(tt.first))
+			}
+			c.Advance(tt.second - tt.first - time.Second)
+			time.Sleep(10 * time.Millisecond)
+			if n := len(sk.Lines()); n != 1 {
+				t.Fatalf("%d lines before the second aligned tick, want 1", n)
+			}
+			tick(t, c, time.Second, sk, 2)
+			if info, _ := p.Get("aligned"); !info.LastTick.Equal(start.Add(tt.second)) {
+				t.Errorf("second tick at %s, want %s", info.LastTick, start.Add(tt.second))
+			}
+		})
+	}
+}
+
+func TestOffsetValidation(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`[{"name": "a", "period": 3600, "align": true, "offset": 300}]`, http.StatusOK},
+		{`[{"name": "a", "period": 3600, "align": true, "offset": 0}]`, http.StatusOK},
+		{`[{"name": "a", "period": 60, "align": true, "offset": 60}]`, http.StatusBadRequest},
+		{`[{"name": "a", "period": 60, "align": true, "offset": -1}]`, http.StatusBadRequest},
+		{`[{"name": "a", "period": 60, "offset": 30}]`, http.StatusBadRequest},
+		{`[{"name": "a", "period": 60, "align": true, "offset": "30"}]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		p, _ := newTestPrinters(t, realClock{})
+		if w := serve(t, newTestServer(p), http.MethodPost, "/api/printers/bulk", tt.body); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.body, w.Code, tt.want, w.Body)
+		}
+	}
+}
+
+func TestOffsetForm(t *testing.T) {
+	sp, err := specFromForm(formRequest(url.Values{"text": {"a"}, "period": {"1h"}, "align": {"on"}, "offset": {"5m"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sp.Align || sp.Offset != 300 {
+		t.Errorf("align %t and offset %d, want an offset of 300", sp.Align, sp.Offset)
+	}
+	if _, err := specFromForm(formRequest(url.Values{"text": {"a"}, "period": {"1h"}, "align": {"on"}, "offset": {"soon"}})); err == nil {
+		t.Error("an invalid offset was accepted")
+	}
+}
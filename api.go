@@ -0,0 +1,423 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleList returns the printers as JSON, or as CSV if the client asks for it
+// through the Accept header, unless the exports are disabled.
+func (s *server) handleList(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		if s.disabled["export"] {
+			http.NotFound(w, r)
+			return
+		}
+		s.handleListCSV(w, r)
+		return
+	}
+
+	list := s.printers.List()
+	// The guard commands need the -token, see private.
+	if anonymous(r) {
+		for i := range list {
+			list[i].Guard = ""
+		}
+	}
+	writeJSON(w, r, http.StatusOK, list)
+}
+
+// handleListCSV returns the printers as CSV, one row per printer after a header row.
+// The header is always written, even without printers.
+func (s *server) handleListCSV(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+
+	// The csv writer takes care of quoting names containing commas, quotes or newlines.
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "period", "color", "paused", "age_seconds"})
+	for _, p := range s.printers.List() {
+		cw.Write([]string{
+			p.Name,
+			strconv.Itoa(p.Period),
+			p.Color,
+			strconv.FormatBool(p.Paused),
+			strconv.FormatFloat(p.Age, 'f', 0, 64),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		requestLogger(r).Error("writing the CSV", "err", err)
+	}
+}
+
+// handleListText returns the names of the printers, sorted, one per line.
+func (s *server) handleListText(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, p := range s.printers.List() {
+		fmt.Fprintln(w, p.Name)
+	}
+}
+
+// colorEntry is the color a printer is printed with, in hexadecimal and as RGB.
+type colorEntry struct {
+	Name string   `json:"name"`
+	Hex  string   `json:"hex"`
+	RGB  [3]uint8 `json:"rgb"`
+}
+
+// handleColors returns the colors of the printers, both as an object by name
+// and as an array sorted by name, for clients that need a stable order.
+func (s *server) handleColors(w http.ResponseWriter, r *http.Request) {
+	resp := struct {
+		Colors map[string]colorEntry `json:"colors"`
+		Legend []colorEntry          `json:"legend"`
+	}{Colors: map[string]colorEntry{}, Legend: []colorEntry{}}
+	for _, p := range s.printers.List() {
+		e := colorEntry{Name: p.Name, Hex: p.Color}
+		// Colors are always stored as #RRGGBB.
+		if v, err := strconv.ParseUint(strings.TrimPrefix(p.Color, "#"), 16, 32); err == nil {
+			e.RGB = [3]uint8{uint8(v >> 16), uint8(v >> 8), uint8(v)}
+		}
+		resp.Colors[p.Name] = e
+		resp.Legend = append(resp.Legend, e)
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// handleGet returns a single printer.
+func (s *server) handleGet(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.printers.Get(r.PathValue("name"))
+	if !ok {
+		http.Error(w, "No such printer", http.StatusNotFound)
+		return
+	}
+	// The guard commands need the -token, see private.
+	if anonymous(r) {
+		info.Guard = ""
+	}
+	writeJSON(w, r, http.StatusOK, info)
+}
+
+// handleLast returns the last line printed by a printer, with null values if
+// it didn't tick yet.
+func (s *server) handleLast(w http.ResponseWriter, r *http.Request) {
+	last, ok := s.printers.Last(r.PathValue("name"))
+	if !ok {
+		http.Error(w, "No such printer", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, last)
+}
+
+// handleHead reports whether a printer exists without a body, with the
+// current period of printers that don't follow a cron schedule in X-Period.
+func (s *server) handleHead(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.printers.Get(r.PathValue("name"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if info.Cron == "" {
+		w.Header().Set("X-Period", strconv.Itoa(info.Period))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleDelete stops a printer. Stopping a printer that is already stopping
+// succeeds, as it is going away either way. A pinned printer is only stopped
+// with ?force=true, and is a conflict otherwise.
+func (s *server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	switch s.printers.Stop(name, r.URL.Query().Get("force") == "true") {
+	case stopNotFound:
+		http.Error(w, "No such printer", http.StatusNotFound)
+		return
+	case stopPinned:
+		http.Error(w, "The printer is pinned, stop it with ?force=true", http.StatusConflict)
+		return
+	case stopped:
+		s.audit(r, "stop", name, nil)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetByID returns a single printer, found by its id.
+func (s *server) handleGetByID(w http.ResponseWriter, r *http.Request) {
+	name, ok := s.nameFromID(w, r)
+	if !ok {
+		return
+	}
+	r.SetPathValue("name", name)
+	s.handleGet(w, r)
+}
+
+// handleDeleteByID stops a printer, found by its id.
+func (s *server) handleDeleteByID(w http.ResponseWriter, r *http.Request) {
+	name, ok := s.nameFromID(w, r)
+	if !ok {
+		return
+	}
+	r.SetPathValue("name", name)
+	s.handleDelete(w, r)
+}
+
+// nameFromID returns the name of the printer with the id of the path.
+// If there is none, it writes the error and returns false.
+func (s *server) nameFromID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return "", false
+	}
+	name, ok := s.printers.Name(id)
+	if !ok {
+		http.Error(w, "No such printer", http.StatusNotFound)
+		return "", false
+	}
+	return name, true
+}
+
+// handleResync realigns the ticks of every printer to now.
+func (s *server) handleResync(w http.ResponseWriter, r *http.Request) {
+	n := s.printers.Resync()
+	s.audit(r, "resync", "", map[string]int{"resynced": n})
+	writeJSON(w, r, http.StatusOK, map[string]int{"resynced": n})
+}
+
+// handleStats returns the counters of the printers, and the health of the server.
+func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, struct {
+		stats
+		PersistenceHealthy bool `json:"persistence_healthy"`
+	}{
+		stats:              s.printers.Stats(),
+		PersistenceHealthy: s.state.Healthy(),
+	})
+}
+
+// handleStatus returns the stats as a single line for terminals,
+// such as "3 printers, uptime 1h2m, 145 ticks".
+func (s *server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	st := s.printers.Stats()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s, uptime %s, %s\n",
+		plural(st.Printers, "printer"),
+		humanDuration(time.Duration(st.Uptime*float64(time.Second))),
+		plural(int(st.Ticks), "tick"))
+}
+
+// plural returns n followed by the word, with an s unless n is 1.
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return strconv.Itoa(n) + " " + word + "s"
+}
+
+// humanDuration formats d to the second, or to the minute past an hour,
+// without the trailing zero units: 1h2m, 5m, 42s.
+func humanDuration(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	if d >= time.Hour {
+		d = d.Truncate(time.Minute)
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// handleFreeze stops every printer and rejects new ones until handleUnfreeze.
+// It returns how many printers were stopped, and the ones that didn't stop in time.
+func (s *server) handleFreeze(w http.ResponseWriter, r *http.Request) {
+	stopped, stuck := s.printers.Freeze(shutdownTimeout)
+	s.audit(r, "freeze", "", map[string]int{"stopped": stopped})
+	if stuck == nil {
+		stuck = []string{}
+	}
+	writeJSON(w, r, http.StatusOK, struct {
+		Stopped int      `json:"stopped"`
+		Stuck   []string `json:"stuck"`
+	}{stopped, stuck})
+}
+
+// handleUnfreeze accepts new printers again.
+func (s *server) handleUnfreeze(w http.ResponseWriter, r *http.Request) {
+	s.printers.Unfreeze()
+	s.audit(r, "unfreeze", "", nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePauseAll pauses every printer, and returns how many were paused.
+func (s *server) handlePauseAll(w http.ResponseWriter, r *http.Request) {
+	n := s.printers.SetPausedAll(true)
+	s.audit(r, "pause-all", "", map[string]int{"paused": n})
+	writeJSON(w, r, http.StatusOK, map[string]int{"paused": n})
+}
+
+// handleResumeAll resumes every paused printer, and returns how many were resumed.
+func (s *server) handleResumeAll(w http.ResponseWriter, r *http.Request) {
+	n := s.printers.SetPausedAll(false)
+	s.audit(r, "resume-all", "", map[string]int{"resumed": n})
+	writeJSON(w, r, http.StatusOK, map[string]int{"resumed": n})
+}
+
+// handleStopMatching stops the printers whose name matches a glob or a regex pattern,
+// and returns the names of the stopped printers.
+func (s *server) handleStopMatching(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Pattern string `json:"pattern"`
+		// Either "glob", the default, or "regex".
+		Mode string `json:"mode"`
+		// Also stops the pinned printers.
+		Force bool `json:"force,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err, "Invalid JSON body")
+		return
+	}
+
+	match, err := matcher(req.Pattern, req.Mode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stopped := s.printers.StopMatching(match, req.Force)
+	for _, name := range stopped {
+		s.audit(r, "stop", name, req)
+	}
+	if stopped == nil {
+		stopped = []string{}
+	}
+	writeJSON(w, r, http.StatusOK, map[string][]string{"stopped": stopped})
+}
+
+// handleSetPeriodMatching sets the period of the printers whose name matches a
+// glob or a regex pattern, and returns the names of the updated printers.
+func (s *server) handleSetPeriodMatching(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Pattern string `json:"pattern"`
+		// Either "glob", the default, or "regex".
+		Mode string `json:"mode"`
+		// In seconds.
+		Period int `json:"period"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err, "Invalid JSON body")
+		return
+	}
+
+	match, err := matcher(req.Pattern, req.Mode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated, err := s.printers.SetPeriodMatching(match, time.Duration(req.Period)*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	for _, name := range updated {
+		s.audit(r, "update", name, req)
+	}
+	if updated == nil {
+		updated = []string{}
+	}
+	writeJSON(w, r, http.StatusOK, struct {
+		Updated []string `json:"updated"`
+		Count   int      `json:"count"`
+	}{updated, len(updated)})
+}
+
+// handleBoost temporarily sets a faster period on a printer.
+// The body gives the new period and how long it lasts, both in seconds.
+func (s *server) handleBoost(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Period   int `json:"period"`
+		Duration int `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err, "Invalid JSON body")
+		return
+	}
+	if req.Period < 1 || req.Duration < 1 {
+		http.Error(w, "period and duration must be positive numbers of seconds", http.StatusBadRequest)
+		return
+	}
+
+	err := s.printers.Boost(r.PathValue("name"), time.Duration(req.Period)*time.Second, time.Duration(req.Duration)*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	s.audit(r, "boost", r.PathValue("name"), req)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// matcher returns a function matching names against `pattern`,
+// interpreted according to `mode`: "glob" (or empty) or "regex".
+func matcher(pattern, mode string) (func(string) bool, error) {
+	if pattern == "" {
+		return nil, errors.New("empty pattern")
+	}
+
+	switch mode {
+	case "", "glob":
+		// Matching against an empty string is enough to validate the pattern.
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob: %w", err)
+		}
+		return func(name string) bool {
+			ok, _ := path.Match(pattern, name)
+			return ok
+		}, nil
+	case "regex":
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		return re.MatchString, nil
+	default:
+		return nil, fmt.Errorf("unknown mode %q, expected glob or regex", mode)
+	}
+}
+
+// errorStatus returns the status code of an error returned by the printers.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrExists):
+		return http.StatusConflict
+	case errors.Is(err, ErrLimit):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrDisabled):
+		return http.StatusForbidden
+	case errors.Is(err, ErrFrozen), errors.Is(err, ErrDraining):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// writeJSON encodes v as the JSON body of the response, with the given status.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		requestLogger(r).Error("writing the JSON", "err", err)
+	}
+}
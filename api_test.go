@@ -0,0 +1,501 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListCSV(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		accept string
+	}{
+		{"csv route", "/api/printers.csv", ""},
+		{"accept header", "/api/printers", "text/csv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			mustAdd(t, p, spec{Name: "a, b", Period: 60}, spec{Name: `say "hi"`, Period: 30})
+			w := serve(t, newTestServer(p), http.MethodGet, tt.target, "", "Accept", tt.accept)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d, want 200", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+				t.Errorf("content type %q, want text/csv", ct)
+			}
+			rows, err := csv.NewReader(w.Body).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 3 {
+				t.Fatalf("got %d rows, want a header and 2 printers: %q", len(rows), rows)
+			}
+			if got := strings.Join(rows[0], ","); got != "name,period,color,paused,age_seconds" {
+				t.Errorf("header %q", got)
+			}
+			for i, want := range [][2]string{{"a, b", "60"}, {`say "hi"`, "30"}} {
+				if rows[i+1][0] != want[0] || rows[i+1][1] != want[1] {
+					t.Errorf("row %d is %q, want name %q and period %s", i+1, rows[i+1], want[0], want[1])
+				}
+			}
+		})
+	}
+}
+
+func TestListCSVEmpty(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	w := serve(t, newTestServer(p), http.MethodGet, "/api/printers.csv", "")
+	if got := w.Body.String(); got != "name,period,color,paused,age_seconds\n" {
+		t.Errorf("got %q, want only the header", got)
+	}
+}
+
+func TestListJSON(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "b", Period: 2}, spec{Name: "a", Period: 1})
+	w := serve(t, newTestServer(p), http.MethodGet, "/api/printers", "")
+	var list []printerInfo
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "a" || list[1].Name != "b" {
+		t.Errorf("got %+v, want a then b", list)
+	}
+}
+
+func TestListText(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "zeta", Period: 1}, spec{Name: "alpha beta", Period: 2}, spec{Name: "mid", Period: 3})
+	w := serve(t, newTestServer(p), http.MethodGet, "/api/printers.txt", "")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("content type %q, want text/plain", ct)
+	}
+	if got := w.Body.String(); got != "alpha beta\nmid\nzeta\n" {
+		t.Errorf("got %q, want the sorted names, one per line", got)
+	}
+}
+
+func TestListTextRejectsNewlines(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	s := newTestServer(p)
+	for _, name := range []string{`a\nb`, `a\rb`, `a\u0000b`} {
+		if w := serve(t, s, http.MethodPost, "/api/printers/bulk", `[{"name": "`+name+`", "period": 1}]`); w.Code != http.StatusBadRequest {
+			t.Errorf("adding %s: status %d, want 400", name, w.Code)
+		}
+	}
+	if got := serve(t, s, http.MethodGet, "/api/printers.txt", "").Body.String(); got != "" {
+		t.Errorf("got %q, want no printer", got)
+	}
+}
+
+func TestStopMatching(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+		left []string
+	}{
+		{"glob star", `{"pattern": "web-*"}`, []string{"web-1", "web-2"}, []string{"db-1", "pinned-web", "web"}},
+		{"glob default mode", `{"pattern": "*", "mode": "glob"}`, []string{"db-1", "web", "web-1", "web-2"}, []string{"pinned-web"}},
+		{"anchored regex", `{"pattern": "^web(-[0-9]+)?$", "mode": "regex"}`, []string{"web", "web-1", "web-2"}, []string{"db-1", "pinned-web"}},
+		{"unanchored regex", `{"pattern": "web", "mode": "regex"}`, []string{"web", "web-1", "web-2"}, []string{"db-1", "pinned-web"}},
+		{"forced", `{"pattern": "*web*", "force": true}`, []string{"pinned-web", "web", "web-1", "web-2"}, []string{"db-1"}},
+		{"no match", `{"pattern": "cache-*"}`, []string{}, []string{"db-1", "pinned-web", "web", "web-1", "web-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			mustAdd(t, p,
+				spec{Name: "web", Period: 60}, spec{Name: "web-1", Period: 60}, spec{Name: "web-2", Period: 60},
+				spec{Name: "db-1", Period: 60}, spec{Name: "pinned-web", Period: 60, Pinned: true},
+			)
+			w := serve(t, newTestServer(p), http.MethodPost, "/api/printers/stop", tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var resp struct{ Stopped []string }
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(resp.Stopped, tt.want) {
+				t.Errorf("stopped %q, want %q", resp.Stopped, tt.want)
+			}
+			waitFor(t, "the printers to stop", func() bool { return len(p.List()) == len(tt.left) })
+			var left []string
+			for _, info := range p.List() {
+				left = append(left, info.Name)
+			}
+			if !slices.Equal(left, tt.left) {
+				t.Errorf("left %q, want %q", left, tt.left)
+			}
+		})
+	}
+}
+
+func TestStopMatchingInvalid(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	s := newTestServer(p)
+	for _, body := range []string{`{"pattern": ""}`, `{"pattern": "[a"}`, `{"pattern": "(", "mode": "regex"}`, `{"pattern": "*", "mode": "sql"}`} {
+		if w := serve(t, s, http.MethodPost, "/api/printers/stop", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestPrinterIDs(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 60}, spec{Name: "b", Period: 60})
+	s := newTestServer(p)
+	a, _ := p.Get("a")
+	b, _ := p.Get("b")
+	if a.ID == 0 || b.ID <= a.ID {
+		t.Fatalf("ids %d and %d, want increasing ones", a.ID, b.ID)
+	}
+	byID := func(id int64) string { return fmt.Sprintf("/api/printers/id/%d", id) }
+
+	for _, want := range []printerInfo{a, b} {
+		w := serve(t, s, http.MethodGet, byID(want.ID), "")
+		var got printerInfo
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusOK || got.Name != want.Name || got.ID != want.ID {
+			t.Errorf("id %d: status %d and %+v, want %s", want.ID, w.Code, got, want.Name)
+		}
+	}
+
+	if w := serve(t, s, http.MethodDelete, byID(a.ID), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d", w.Code)
+	}
+	waitFor(t, "a to stop", func() bool { _, ok := p.Get("a"); return !ok })
+	// A printer added again with the same name has a new id.
+	mustAdd(t, p, spec{Name: "a", Period: 60})
+	if again, _ := p.Get("a"); again.ID == a.ID {
+		t.Errorf("the id %d was given again", a.ID)
+	}
+
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, byID(a.ID), http.StatusNotFound},
+		{http.MethodDelete, byID(a.ID), http.StatusNotFound},
+		{http.MethodGet, byID(1000), http.StatusNotFound},
+		{http.MethodGet, "/api/printers/id/b", http.StatusBadRequest},
+		{http.MethodDelete, "/api/printers/id/-", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := serve(t, s, tt.method, tt.target, ""); w.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, w.Code, tt.want)
+		}
+	}
+	if _, ok := p.Get("b"); !ok {
+		t.Error("b was stopped")
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	withConfig(t, config{DefaultPeriod: 1})
+	p, _ := newTestPrinters(t, realClock{})
+	st, _ := newTestState(t, p, filepath.Join(t.TempDir(), "state.json"))
+	s := newTestServer(p)
+	s.state = st
+	mustAdd(t, p, spec{Name: "a", Period: 60}, spec{Name: "b", Period: 60, Pinned: true})
+	saved := func() int {
+		specs, err := st.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(specs)
+	}
+
+	w := serve(t, s, http.MethodPost, "/api/freeze", "")
+	if got := strings.TrimSpace(w.Body.String()); got != `{"stopped":2,"stuck":[]}` {
+		t.Errorf("freeze returned %s, want both printers stopped, pinned included", got)
+	}
+	if n := len(p.List()); n != 0 {
+		t.Errorf("%d printers left", n)
+	}
+	// The state keeps the printers, to restore them at the next start.
+	if n := saved(); n != 2 {
+		t.Errorf("%d printers saved while frozen, want 2", n)
+	}
+	if !p.Stats().Frozen {
+		t.Error("the stats aren't frozen")
+	}
+	if page := serve(t, s, http.MethodGet, "/", "").Body.String(); !strings.Contains(page, "<fieldset disabled>") {
+		t.Error("the form isn't disabled")
+	}
+	if w := serve(t, s, http.MethodPost, "/api/printers/bulk", `[{"name": "c"}]`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("bulk while frozen: status %d, want 503", w.Code)
+	}
+	form := httptest.NewRecorder()
+	s.routes().ServeHTTP(form, formRequest(url.Values{"text": {"c"}}))
+	if form.Code != http.StatusServiceUnavailable {
+		t.Errorf("form while frozen: status %d, want 503", form.Code)
+	}
+	if err := p.Add(spec{Name: "c", Period: 1}); !errors.Is(err, ErrFrozen) {
+		t.Errorf("Add while frozen returned %v, want ErrFrozen", err)
+	}
+
+	if w := serve(t, s, http.MethodPost, "/api/unfreeze", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("unfreeze: status %d", w.Code)
+	}
+	if w := serve(t, s, http.MethodPost, "/api/printers/bulk", `[{"name": "c"}]`); w.Code != http.StatusOK {
+		t.Errorf("bulk after unfreeze: status %d, want 200", w.Code)
+	}
+	if _, ok := p.Get("c"); !ok || p.Stats().Frozen {
+		t.Error("c wasn't added after unfreeze")
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{42*time.Second + 300*time.Millisecond, "42s"},
+		{5 * time.Minute, "5m"},
+		{5*time.Minute + 3*time.Second, "5m3s"},
+		{time.Hour, "1h"},
+		{time.Hour + 2*time.Minute + 59*time.Second, "1h2m"},
+		{26 * time.Hour, "26h"},
+	}
+	for _, tt := range tests {
+		if got := humanDuration(tt.d); got != tt.want {
+			t.Errorf("humanDuration(%s) = %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		printers int
+		want     string
+	}{
+		{0, "0 printers, uptime 1h2m, 0 ticks\n"},
+		{1, "1 printer, uptime 1h2m, 1 tick\n"},
+		{3, "3 printers, uptime 1h2m, 3 ticks\n"},
+	}
+	for _, tt := range tests {
+		c := newFakeClock()
+		p, sk := newTestPrinters(t, c)
+		for i := range tt.printers {
+			mustAdd(t, p, spec{Name: fmt.Sprint(i), Period: 62 * 60})
+		}
+		waitTimers(t, c, tt.printers)
+		tick(t, c, time.Hour+2*time.Minute+30*time.Second, sk, tt.printers)
+		w := serve(t, newTestServer(p), http.MethodGet, "/api/status", "")
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Errorf("content type %q", ct)
+		}
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestHead(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 60}, spec{Name: "cron", Cron: "* * * * *"})
+	s := newTestServer(p)
+	tests := []struct {
+		name   string
+		want   int
+		period string
+	}{
+		{"a", http.StatusOK, "60"},
+		{"cron", http.StatusOK, ""},
+		{"missing", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := serve(t, s, http.MethodHead, "/api/printers/"+tt.name, "")
+		if w.Code != tt.want || w.Header().Get("X-Period") != tt.period || w.Body.Len() != 0 {
+			t.Errorf("%s: status %d, X-Period %q and %d bytes, want %d, %q and no body", tt.name, w.Code, w.Header().Get("X-Period"), w.Body.Len(), tt.want, tt.period)
+		}
+	}
+	// The header follows the current period.
+	if w := serve(t, s, http.MethodPatch, "/api/printers/a", `{"period": 5}`); w.Code != http.StatusOK {
+		t.Fatalf("patch: status %d: %s", w.Code, w.Body)
+	}
+	if got := serve(t, s, http.MethodHead, "/api/printers/a", "").Header().Get("X-Period"); got != "5" {
+		t.Errorf("X-Period %q after the change, want 5", got)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{ErrNotFound, http.StatusNotFound},
+		{fmt.Errorf("%w: no printer %q to mirror", ErrNotFound, "a"), http.StatusNotFound},
+		{ErrExists, http.StatusConflict},
+		{ErrLimit, http.StatusTooManyRequests},
+		{fmt.Errorf("%w: must be positive", ErrInvalidPeriod), http.StatusBadRequest},
+		{fmt.Errorf("%w: guard", ErrDisabled), http.StatusForbidden},
+		{ErrFrozen, http.StatusServiceUnavailable},
+		{ErrDraining, http.StatusServiceUnavailable},
+		{errors.New("invalid name"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if got := errorStatus(tt.err); got != tt.want {
+			t.Errorf("errorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestColors(t *testing.T) {
+	withColors(t)
+	c := newFakeClock()
+	p, _ := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "zeta", Period: 60, Color: "#FF8800"}, spec{Name: "alpha", Period: 60}, spec{Name: "mid", Period: 60, Color: "#0A0B0C"})
+	w := serve(t, newTestServer(p), http.MethodGet, "/api/colors", "")
+	var resp struct {
+		Colors map[string]colorEntry
+		Legend []colorEntry
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		hex  string
+		rgb  [3]uint8
+	}{
+		{"alpha", stringToColor("alpha"), [3]uint8{}},
+		{"mid", "#0A0B0C", [3]uint8{10, 11, 12}},
+		{"zeta", "#FF8800", [3]uint8{255, 136, 0}},
+	}
+	if len(resp.Legend) != len(tests) || len(resp.Colors) != len(tests) {
+		t.Fatalf("got %+v, want %d printers", resp, len(tests))
+	}
+	for i, tt := range tests {
+		e := resp.Legend[i]
+		if e.Name != tt.name || e.Hex != tt.hex || resp.Colors[tt.name] != e {
+			t.Errorf("legend %d is %+v and the color of %s is %+v, want %s", i, e, tt.name, resp.Colors[tt.name], tt.hex)
+		}
+		if tt.rgb != ([3]uint8{}) && e.RGB != tt.rgb {
+			t.Errorf("%s: RGB %v, want %v", tt.name, e.RGB, tt.rgb)
+		}
+		// The color is the one the lines of the printer are printed in.
+		info, _ := p.Get(tt.name)
+		sk := &colorSink{}
+		if err := printWithTime(sk, line{name: tt.name, color: info.Color}, "ansi", nil, ""); err != nil {
+			t.Fatal(err)
+		}
+		escape := fmt.Sprintf("\x1b[38;2;%d;%d;%dm", e.RGB[0], e.RGB[1], e.RGB[2])
+		if !strings.Contains(sk.colored[0], escape) {
+			t.Errorf("%s: printed %q, want the escape %q", tt.name, sk.colored[0], escape)
+		}
+	}
+}
+
+func TestSetPeriodMatching(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"glob", `{"pattern": "web-*", "period": 5}`, []string{"web-1", "web-2"}},
+		{"regex", `{"pattern": "^web", "mode": "regex", "period": 5}`, []string{"web", "web-1", "web-2"}},
+		// The printers without a period of their own are left alone.
+		{"everything", `{"pattern": "*", "period": 5}`, []string{"db-1", "web", "web-1", "web-2"}},
+		{"no match", `{"pattern": "cache-*", "period": 5}`, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClock()
+			p, _ := newTestPrinters(t, c)
+			mustAdd(t, p,
+				spec{Name: "web", Period: 60}, spec{Name: "web-1", Period: 60}, spec{Name: "web-2", Period: 60},
+				spec{Name: "db-1", Period: 60}, spec{Name: "cron", Cron: "* * * * *"},
+				spec{Name: "mirror", Mirror: "web"}, spec{Name: "random", Period: 10, MinPeriod: 10, MaxPeriod: 20},
+			)
+			w := serve(t, newTestServer(p), http.MethodPost, "/api/printers/period", tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Updated []string
+				Count   int
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(resp.Updated, tt.want) || resp.Count != len(tt.want) {
+				t.Errorf("updated %q (%d), want %q", resp.Updated, resp.Count, tt.want)
+			}
+			for _, info := range p.List() {
+				want := 60
+				if slices.Contains(tt.want, info.Name) {
+					want = 5
+				}
+				if info.Cron != "" || info.Mirror != "" || info.MaxPeriod != 0 {
+					continue
+				}
+				if info.Period != want {
+					t.Errorf("%s has the period %d, want %d", info.Name, info.Period, want)
+				}
+			}
+			if len(tt.want) > 0 {
+				waitTicker(t, c, 5*time.Second)
+			}
+		})
+	}
+}
+
+func TestSetPeriodMatchingInvalid(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 60})
+	s := newTestServer(p)
+	for _, body := range []string{`{"pattern": "*", "period": 0}`, `{"pattern": "*", "period": -1}`, `{"pattern": "", "period": 5}`, `{"pattern": "(", "mode": "regex", "period": 5}`, `{"pattern": "*", "period": "5"}`} {
+		if w := serve(t, s, http.MethodPost, "/api/printers/period", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, w.Code)
+		}
+	}
+	if info, _ := p.Get("a"); info.Period != 60 {
+		t.Errorf("a has the period %d, want still 60", info.Period)
+	}
+}
+
+func TestSetPeriodMatchingConcurrent(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	for i := range 20 {
+		mustAdd(t, p, spec{Name: fmt.Sprint("p-", i), Period: 60})
+	}
+	s := newTestServer(p)
+	// Printers stopped while the periods change are skipped.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 10 {
+			p.Stop(fmt.Sprint("p-", i), false)
+		}
+	}()
+	w := serve(t, s, http.MethodPost, "/api/printers/period", `{"pattern": "p-*", "period": 5}`)
+	<-done
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	waitFor(t, "the printers to stop", func() bool { return len(p.List()) == 10 })
+	for _, info := range p.List() {
+		if info.Period != 5 {
+			t.Errorf("%s has the period %d, want 5", info.Name, info.Period)
+		}
+	}
+}
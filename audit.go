@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Number of entries kept by the audit log, the oldest ones are dropped first.
+const auditSize = 1000
+
+// auditEntry is an operation done through the HTTP API or the page.
+type auditEntry struct {
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	Name string    `json:"name,omitempty"`
+	// IP address of the client.
+	Source string `json:"source"`
+	Params any    `json:"params,omitempty"`
+}
+
+// auditLog keeps the last `auditSize` entries in a ring buffer.
+type auditLog struct {
+	mu      sync.Mutex
+	entries []auditEntry
+	// Index of the next entry to overwrite once the buffer is full.
+	next int
+}
+
+func newAuditLog(size int) *auditLog {
+	return &auditLog{entries: make([]auditEntry, 0, size)}
+}
+
+func (a *auditLog) add(e auditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.entries) < cap(a.entries) {
+		a.entries = append(a.entries, e)
+		return
+	}
+	a.entries[a.next] = e
+	a.next = (a.next + 1) % len(a.entries)
+}
+
+// Entries returns the entries, oldest first.
+func (a *auditLog) Entries() []auditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := make([]auditEntry, 0, len(a.entries))
+	s = append(s, a.entries[a.next:]...)
+	return append(s, a.entries[:a.next]...)
+}
+
+// audit records an operation that succeeded, if the server has an audit log.
+func (s *server) audit(r *http.Request, op, name string, params any) {
+	if s.auditLog == nil {
+		return
+	}
+	source, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		source = r.RemoteAddr
+	}
+	s.auditLog.add(auditEntry{
+		Time:   s.printers.clock.Now(),
+		Op:     op,
+		Name:   name,
+		Source: source,
+		Params: params,
+	})
+}
+
+// handleAudit returns the audit log, oldest first.
+func (s *server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	entries := []auditEntry{}
+	if s.auditLog != nil {
+		entries = s.auditLog.Entries()
+	}
+	writeJSON(w, r, http.StatusOK, entries)
+}
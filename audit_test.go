@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAuditLogRing(t *testing.T) {
+	tests := []struct {
+		added int
+		want  []string
+	}{
+		{0, []string{}},
+		{2, []string{"0", "1"}},
+		{3, []string{"0", "1", "2"}},
+		{5, []string{"2", "3", "4"}},
+		{7, []string{"4", "5", "6"}},
+	}
+	for _, tt := range tests {
+		a := newAuditLog(3)
+		for i := range tt.added {
+			a.add(auditEntry{Name: string(rune('0' + i))})
+		}
+		got := []string{}
+		for _, e := range a.Entries() {
+			got = append(got, e.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%d added: got %q, want %q", tt.added, got, tt.want)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	c := newFakeClock()
+	p, _ := newTestPrinters(t, c)
+	s := newTestServer(p)
+
+	serve(t, s, http.MethodPost, "/api/printers/bulk", `[{"name": "a", "period": 5}]`)
+	c.Advance(time.Minute)
+	serve(t, s, http.MethodPatch, "/api/printers/a", `{"period": 10}`)
+	// Failed operations aren't recorded.
+	serve(t, s, http.MethodPatch, "/api/printers/missing", `{"period": 10}`)
+	serve(t, s, http.MethodPost, "/api/printers/bulk", `[{"name": "a", "period": 5}]`)
+	serve(t, s, http.MethodDelete, "/api/printers/a", "")
+
+	w := serve(t, s, http.MethodGet, "/api/audit", "")
+	var got []struct {
+		Time   time.Time
+		Op     string
+		Name   string
+		Source string
+		Params map[string]any
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ op, name string }{{"add", "a"}, {"update", "a"}, {"stop", "a"}}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %v", got, want)
+	}
+	for i, e := range got {
+		if e.Op != want[i].op || e.Name != want[i].name || e.Source != "192.0.2.1" {
+			t.Errorf("entry %d is %+v, want %s of %s from 192.0.2.1", i, e, want[i].op, want[i].name)
+		}
+	}
+	if start := newFakeClock().Now(); !got[0].Time.Equal(start) || !got[1].Time.Equal(start.Add(time.Minute)) {
+		t.Errorf("times %s and %s, want the time of the operations", got[0].Time, got[1].Time)
+	}
+	if got[1].Params["period"] != 10.0 {
+		t.Errorf("update params %v, want the period", got[1].Params)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+type anonymousKey struct{}
+
+// anonymous reports whether the request was let through without the -token,
+// by -readonly-open.
+func anonymous(r *http.Request) bool {
+	anon, _ := r.Context().Value(anonymousKey{}).(bool)
+	return anon
+}
+
+// private reports whether a read still needs the -token with -readonly-open:
+// the exports and the audit log, which have the guard commands and the client
+// addresses, and the debug routes.
+func private(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/api/printers.csv", "/api/printers.txt", "/api/export.sh", "/api/audit":
+		return true
+	case "/api/printers":
+		// The CSV export, see handleList.
+		return strings.Contains(r.Header.Get("Accept"), "text/csv")
+	}
+	return strings.HasPrefix(r.URL.Path, "/debug/")
+}
+
+// requireToken only lets through the requests with an `Authorization: Bearer
+// <token>` header, and the GET and HEAD ones too if `readOpen` is set, except
+// for the private ones. The health checks are always let through, for the
+// probes that can't authenticate.
+func requireToken(h http.Handler, token string, readOpen bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		given, ok := bearerToken(r)
+		if !ok && readOpen && (r.Method == http.MethodGet || r.Method == http.MethodHead) && !private(r) {
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), anonymousKey{}, true)))
+			return
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ticker-printer"`)
+			http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ticker-printer", error="invalid_token"`)
+			http.Error(w, "Invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// bearerToken returns the token of the `Authorization: Bearer <token>` header,
+// and whether there is one. The scheme is case-insensitive, like every HTTP
+// authentication scheme.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimLeft(token, " "), true
+}
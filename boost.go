@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Boost temporarily changes the period of a printer for `d`, after which the period
+// it had before is restored. Boosting a boosted printer changes its period again and
+// restarts the countdown, but still restores the period from before the first boost.
+// It returns ErrNotFound if there is no printer for this string, and ErrInvalidPeriod
+// if the period isn't positive or if the printer follows a cron schedule.
+func (p *printers) Boost(s string, period, d time.Duration) error {
+	if period <= 0 {
+		return fmt.Errorf("%w: must be positive", ErrInvalidPeriod)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pr, ok := p.l[s]
+	if !ok {
+		return ErrNotFound
+	}
+	if pr.schedule != nil {
+		return fmt.Errorf("%w: the printer follows a cron schedule", ErrInvalidPeriod)
+	}
+	if pr.maxPeriod > 0 {
+		return fmt.Errorf("%w: the printer has a random period", ErrInvalidPeriod)
+	}
+	if pr.mirror != "" {
+		return fmt.Errorf("%w: the printer mirrors %s", ErrInvalidPeriod, pr.mirror)
+	}
+
+	if pr.boost == nil {
+		pr.unboosted = pr.period
+		pr.boost = p.clock.AfterFunc(d, func() { p.unboost(s, pr) })
+	} else {
+		pr.boost.Reset(d)
+	}
+	pr.period = period
+	notify(pr.reset)
+	return nil
+}
+
+// unboost restores the period of a printer at the end of its boost.
+func (p *printers) unboost(s string, pr *printer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// The printer may have been stopped, or replaced by another with the same name.
+	if p.l[s] != pr || pr.boost == nil {
+		return
+	}
+	pr.boost = nil
+	pr.period = pr.unboosted
+	notify(pr.reset)
+}
+
+// cancelBoost stops the boost of a printer, keeping its current period.
+// The lock of the printers must be held.
+func (pr *printer) cancelBoost() {
+	if pr.boost != nil {
+		pr.boost.Stop()
+		pr.boost = nil
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// waitTicker waits for an active ticker of period d, such as the one of a printer
+// once it took a new period into account.
+func waitTicker(t *testing.T, c *fakeClock, d time.Duration) {
+	t.Helper()
+	waitFor(t, "the ticker of "+d.String(), func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, ft := range c.timers {
+			if ft.active && ft.period == d {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func TestBoostReverts(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "demo", Period: 10})
+	waitTicker(t, c, 10*time.Second)
+	s := newTestServer(p)
+
+	if w := serve(t, s, http.MethodPost, "/api/printers/demo/boost", `{"period": 1, "duration": 3}`); w.Code != http.StatusNoContent {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if info, _ := p.Get("demo"); info.Period != 1 || !info.Boosted {
+		t.Errorf("period %d and boosted %t, want 1 and true", info.Period, info.Boosted)
+	}
+	waitTicker(t, c, time.Second)
+	tick(t, c, time.Second, sk, 1)
+	tick(t, c, time.Second, sk, 2)
+
+	// Boosting again restarts the countdown, and keeps the period from before.
+	if w := serve(t, s, http.MethodPost, "/api/printers/demo/boost", `{"period": 2, "duration": 4}`); w.Code != http.StatusNoContent {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	waitTicker(t, c, 2*time.Second)
+	c.Advance(2 * time.Second)
+	if info, _ := p.Get("demo"); info.Period != 2 {
+		t.Errorf("period %d after the first boost would have ended, want still boosted to 2", info.Period)
+	}
+	c.Advance(2 * time.Second)
+	waitFor(t, "the period to revert", func() bool {
+		info, _ := p.Get("demo")
+		return info.Period == 10 && !info.Boosted
+	})
+	waitTicker(t, c, 10*time.Second)
+}
+
+func TestBoostErrors(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 10}, spec{Name: "cron", Cron: "* * * * *"})
+	s := newTestServer(p)
+	tests := []struct {
+		target, body string
+		want         int
+	}{
+		{"/api/printers/missing/boost", `{"period": 1, "duration": 3}`, http.StatusNotFound},
+		{"/api/printers/a/boost", `{"period": 0, "duration": 3}`, http.StatusBadRequest},
+		{"/api/printers/a/boost", `{"period": 1}`, http.StatusBadRequest},
+		{"/api/printers/cron/boost", `{"period": 1, "duration": 3}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := serve(t, s, http.MethodPost, tt.target, tt.body); w.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.target, tt.body, w.Code, tt.want)
+		}
+	}
+}
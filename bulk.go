@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// fieldError is a validation error about one field of one printer of a payload.
+type fieldError struct {
+	Index   int    `json:"index"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// handleBulkAdd adds the printers of a JSON array of specs.
+// The whole payload is validated first, and nothing is added if any field is invalid:
+// the response is then a 400 listing every invalid field.
+func (s *server) handleBulkAdd(w http.ResponseWriter, r *http.Request) {
+	var items []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		bodyError(w, err, "Invalid JSON body: expected an array of printers")
+		return
+	}
+
+	specs, errs := validateSpecs(items)
+	if len(errs) > 0 {
+		writeJSON(w, r, http.StatusBadRequest, map[string][]fieldError{"errors": errs})
+		return
+	}
+
+	for _, sp := range specs {
+		if sp.Guard != "" && !cfg.AllowExec {
+			http.Error(w, "Guard commands are disabled, start the server with -allow-exec", http.StatusForbidden)
+			return
+		}
+	}
+
+	if s.printers.Frozen() {
+		http.Error(w, ErrFrozen.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if s.printers.Draining() {
+		http.Error(w, ErrDraining.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	var resp struct {
+		// Names the printers were added with, see -dupes.
+		Added []string `json:"added"`
+		// Errors returned by Add for the printers that could not be added.
+		Errors []fieldError `json:"errors,omitempty"`
+	}
+	resp.Added = []string{}
+	for i, sp := range specs {
+		name, err := s.add(sp)
+		if err != nil {
+			resp.Errors = append(resp.Errors, fieldError{Index: i, Message: err.Error()})
+			continue
+		}
+		s.audit(r, "add", name, sp)
+		resp.Added = append(resp.Added, name)
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// validateSpecs checks every field of every item against the format of a spec,
+// and returns the decoded specs if there was no error.
+// Missing periods are replaced by the default one.
+func validateSpecs(items []json.RawMessage) ([]spec, []fieldError) {
+	var specs []spec
+	var errs []fieldError
+	for i, item := range items {
+		sp, itemErrs := validateSpec(item)
+		for _, e := range itemErrs {
+			e.Index = i
+			errs = append(errs, e)
+		}
+		specs = append(specs, sp)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return specs, nil
+}
+
+// validateSpec checks the fields of a single printer object.
+func validateSpec(item json.RawMessage) (spec, []fieldError) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(item, &fields); err != nil {
+		return spec{}, []fieldError{{Message: "must be an object"}}
+	}
+
+	var sp spec
+	var errs []fieldError
+	addErr := func(field, msg string) {
+		errs = append(errs, fieldError{Field: field, Message: msg})
+	}
+
+	if raw, ok := fields["name"]; !ok {
+		addErr("name", "is required")
+	} else if err := json.Unmarshal(raw, &sp.Name); err != nil {
+		addErr("name", "must be a string")
+	} else if err := validateName(sp.Name); err != nil {
+		addErr("name", err.Error())
+	}
+
+	sp.Period = cfg.DefaultPeriod
+	if raw, ok := fields["period"]; ok {
+		// A string is parsed like in the form, such as "5m" or "every 30 seconds".
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			if d, err := parsePeriod(s); err != nil {
+				addErr("period", err.Error())
+			} else {
+				sp.Period = int(d / time.Second)
+			}
+		} else if err := json.Unmarshal(raw, &sp.Period); err != nil {
+			addErr("period", "must be an integer number of seconds, or a string such as \"5m\" or \"every 30 seconds\"")
+		} else if _, mirror := fields["mirror"]; sp.Period < 0 || sp.Period == 0 && !mirror {
+			// Shadow printers have none, and are listed with 0.
+			addErr("period", "must be positive")
+		}
+	}
+
+	if raw, ok := fields["color"]; ok {
+		if err := json.Unmarshal(raw, &sp.Color); err != nil || !colorRe.MatchString(sp.Color) {
+			addErr("color", "must be a color as #RRGGBB")
+		}
+	}
+
+	if raw, ok := fields["cron"]; ok {
+		if err := json.Unmarshal(raw, &sp.Cron); err != nil {
+			addErr("cron", "must be a string")
+		} else if _, err := cron.ParseStandard(sp.Cron); err != nil {
+			addErr("cron", err.Error())
+		}
+	}
+
+	if raw, ok := fields["guard"]; ok {
+		if err := json.Unmarshal(raw, &sp.Guard); err != nil {
+			addErr("guard", "must be a string")
+		}
+	}
+
+	if raw, ok := fields["priority"]; ok {
+		if err := json.Unmarshal(raw, &sp.Priority); err != nil {
+			addErr("priority", "must be an integer")
+		}
+	}
+
+	if raw, ok := fields["window"]; ok {
+		if err := json.Unmarshal(raw, &sp.Window); err != nil {
+			addErr("window", "must be an object with integer start_hour and end_hour")
+		} else if err := sp.Window.validate(); err != nil {
+			addErr("window", err.Error())
+		}
+	}
+
+	if raw, ok := fields["fields"]; ok {
+		if err := json.Unmarshal(raw, &sp.Fields); err != nil {
+			addErr("fields", "must be an object of strings")
+		} else if err := validateFields(sp.Fields); err != nil {
+			addErr("fields", err.Error())
+		}
+	}
+
+	if raw, ok := fields["precise"]; ok {
+		if err := json.Unmarshal(raw, &sp.Precise); err != nil {
+			addErr("precise", "must be a boolean")
+		} else if sp.Precise && sp.Cron != "" {
+			addErr("precise", "only applies to printers with a period, not a cron expression")
+		}
+	}
+
+	if raw, ok := fields["dim"]; ok {
+		if err := json.Unmarshal(raw, &sp.Dim); err != nil {
+			addErr("dim", "must be a boolean")
+		}
+	}
+
+	if raw, ok := fields["align"]; ok {
+		if err := json.Unmarshal(raw, &sp.Align); err != nil {
+			addErr("align", "must be a boolean")
+		} else if sp.Align && sp.Cron != "" {
+			addErr("align", "only applies to printers with a period, not a cron expression")
+		}
+	}
+
+	if raw, ok := fields["offset"]; ok {
+		if err := json.Unmarshal(raw, &sp.Offset); err != nil {
+			addErr("offset", "must be an integer number of seconds")
+		} else if err := validateOffset(sp); err != nil {
+			addErr("offset", err.Error())
+		}
+	}
+
+	if raw, ok := fields["countdown"]; ok {
+		if err := json.Unmarshal(raw, &sp.Countdown); err != nil {
+			addErr("countdown", "must be a boolean")
+		}
+	}
+
+	if raw, ok := fields["pinned"]; ok {
+		if err := json.Unmarshal(raw, &sp.Pinned); err != nil {
+			addErr("pinned", "must be a boolean")
+		}
+	}
+
+	if raw, ok := fields["minperiod"]; ok {
+		if err := json.Unmarshal(raw, &sp.MinPeriod); err != nil {
+			addErr("minperiod", "must be an integer number of seconds")
+		}
+	}
+	if raw, ok := fields["maxperiod"]; ok {
+		if err := json.Unmarshal(raw, &sp.MaxPeriod); err != nil {
+			addErr("maxperiod", "must be an integer number of seconds")
+		} else if err := validateRange(sp); err != nil {
+			addErr("maxperiod", err.Error())
+		}
+	} else if _, ok := fields["minperiod"]; ok {
+		addErr("maxperiod", "is required with minperiod")
+	}
+
+	if raw, ok := fields["mirror"]; ok {
+		if err := json.Unmarshal(raw, &sp.Mirror); err != nil {
+			addErr("mirror", "must be a string")
+		} else if err := validateMirror(sp); err != nil {
+			addErr("mirror", err.Error())
+		}
+	}
+
+	if raw, ok := fields["cycle"]; ok {
+		if err := json.Unmarshal(raw, &sp.Cycle); err != nil {
+			addErr("cycle", "must be a boolean")
+		}
+	}
+	if raw, ok := fields["palette"]; ok {
+		if err := json.Unmarshal(raw, &sp.Palette); err != nil {
+			addErr("palette", "must be an array of colors as #RRGGBB")
+		} else if err := validateCycle(sp); err != nil {
+			addErr("palette", err.Error())
+		}
+	}
+
+	if raw, ok := fields["printevery"]; ok {
+		if err := json.Unmarshal(raw, &sp.Every); err != nil || sp.Every < 0 {
+			addErr("printevery", "must be a positive integer number of ticks")
+		}
+	}
+
+	if raw, ok := fields["sink"]; ok {
+		if err := json.Unmarshal(raw, &sp.Sink); err != nil {
+			addErr("sink", "must be a string")
+		}
+	}
+
+	if raw, ok := fields["text"]; ok {
+		if err := json.Unmarshal(raw, &sp.Text); err != nil {
+			addErr("text", "must be a string")
+		} else if err := validateName(sp.Text); err != nil {
+			addErr("text", err.Error())
+		}
+	}
+
+	// Report unknown fields, which are most likely typos.
+	known := map[string]bool{"name": true, "period": true, "color": true, "cron": true, "guard": true, "priority": true, "window": true, "fields": true, "precise": true, "dim": true, "text": true, "align": true, "offset": true, "countdown": true, "pinned": true, "minperiod": true, "maxperiod": true, "mirror": true, "sink": true, "cycle": true, "palette": true, "printevery": true}
+	var unknown []string
+	for k := range fields {
+		if !known[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		addErr(k, "unknown field")
+	}
+
+	return sp, errs
+}
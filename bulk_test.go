@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestBulkValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// Index and field of each expected error.
+		want []fieldError
+	}{
+		{"missing name", `[{"period": 5}]`, []fieldError{{Index: 0, Field: "name"}}},
+		{"name not a string", `[{"name": 5, "period": 5}]`, []fieldError{{Index: 0, Field: "name"}}},
+		{"float period", `[{"name": "a", "period": 1.5}]`, []fieldError{{Index: 0, Field: "period"}}},
+		{"negative period", `[{"name": "a", "period": -1}]`, []fieldError{{Index: 0, Field: "period"}}},
+		{"unparseable period", `[{"name": "a", "period": "soon"}]`, []fieldError{{Index: 0, Field: "period"}}},
+		{"sub-second period", `[{"name": "a", "period": "500ms"}]`, []fieldError{{Index: 0, Field: "period"}}},
+		{"bad color", `[{"name": "a", "period": 5, "color": "red"}]`, []fieldError{{Index: 0, Field: "color"}}},
+		{"short color", `[{"name": "a", "period": 5, "color": "#fff"}]`, []fieldError{{Index: 0, Field: "color"}}},
+		{"not an object", `[{"name": "a", "period": 5}, "b"]`, []fieldError{{Index: 1}}},
+		{
+			"every error of every item",
+			`[{"name": "ok", "period": 5}, {"period": "x", "color": "#12345g"}]`,
+			[]fieldError{{Index: 1, Field: "name"}, {Index: 1, Field: "period"}, {Index: 1, Field: "color"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			w := serve(t, newTestServer(p), http.MethodPost, "/api/printers/bulk", tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400", w.Code)
+			}
+			var resp struct{ Errors []fieldError }
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Errors) != len(tt.want) {
+				t.Fatalf("got the errors %+v, want %+v", resp.Errors, tt.want)
+			}
+			for i, e := range resp.Errors {
+				if e.Index != tt.want[i].Index || e.Field != tt.want[i].Field || e.Message == "" {
+					t.Errorf("error %d is %+v, want item %d and field %q with a message", i, e, tt.want[i].Index, tt.want[i].Field)
+				}
+			}
+			// Nothing is added when a field is invalid, even from the valid items.
+			if n := len(p.List()); n != 0 {
+				t.Errorf("%d printers added, want none", n)
+			}
+		})
+	}
+}
+
+func TestBulkAdd(t *testing.T) {
+	withConfig(t, config{DefaultPeriod: 1})
+	p, _ := newTestPrinters(t, realClock{})
+	w := serve(t, newTestServer(p), http.MethodPost, "/api/printers/bulk", `[{"name": "a", "period": 5, "color": "#00FF00"}, {"name": "b"}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if a, _ := p.Get("a"); a.Period != 5 || a.Color != "#00FF00" {
+		t.Errorf("a has the period %d and color %s, want 5 and #00FF00", a.Period, a.Color)
+	}
+	if b, ok := p.Get("b"); !ok || b.Period != 1 {
+		t.Errorf("b has the period %d, want the default one", b.Period)
+	}
+	// A string period is parsed like in the form.
+	if w := serve(t, newTestServer(p), http.MethodPost, "/api/printers/bulk", `[{"name": "c", "period": "2m"}, {"name": "d", "period": "every 30 seconds"}]`); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if c, _ := p.Get("c"); c.Period != 120 {
+		t.Errorf("c has the period %d, want 120", c.Period)
+	}
+	if d, _ := p.Get("d"); d.Period != 30 {
+		t.Errorf("d has the period %d, want 30", d.Period)
+	}
+	if w := serve(t, newTestServer(p), http.MethodPost, "/api/printers/bulk", `{"name": "e"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("an object instead of an array: status %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only moves with Advance, firing the timers
+// and tickers that are due on the way, in order.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 3, 18, 12, 0, 0, 0, time.UTC)}
+}
+
+// fakeTimer is a timer, a ticker when period is set, or a function to call
+// when f is set.
+type fakeTimer struct {
+	clock  *fakeClock
+	c      chan time.Time
+	at     time.Time
+	period time.Duration
+	f      func()
+	active bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) add(d, period time.Duration, f func()) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1), at: c.now.Add(d), period: period, f: f, active: true}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return c.add(d, d, nil)
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer { return c.add(d, 0, nil) }
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer { return c.add(d, 0, f) }
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Reset(d time.Duration) {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.at, t.active = t.clock.now.Add(d), true
+	if t.period > 0 {
+		t.period = d
+	}
+}
+
+func (t *fakeTimer) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.active = false
+}
+
+// Advance moves the time forward by d. Like the real ones, the timers and
+// tickers whose channel is full drop the tick.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := c.now.Add(d)
+	for {
+		due := make([]*fakeTimer, 0, len(c.timers))
+		for _, t := range c.timers {
+			if t.active && !t.at.After(end) {
+				due = append(due, t)
+			}
+		}
+		if len(due) == 0 {
+			break
+		}
+		sort.SliceStable(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+		t := due[0]
+		c.now = t.at
+		switch {
+		case t.f != nil:
+			t.active = false
+			go t.f()
+		default:
+			select {
+			case t.c <- c.now:
+			default:
+			}
+			if t.period > 0 {
+				t.at = t.at.Add(t.period)
+			} else {
+				t.active = false
+			}
+		}
+	}
+	c.now = end
+}
+
+// Active returns the number of timers and tickers that will fire.
+func (c *fakeClock) Active() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, t := range c.timers {
+		if t.active {
+			n++
+		}
+	}
+	return n
+}
+
+// waitTimers waits for at least n timers and tickers to be active, such as
+// the ones of the printers once their goroutine started.
+func waitTimers(t *testing.T, c *fakeClock, n int) {
+	t.Helper()
+	waitFor(t, "the timers", func() bool { return c.Active() >= n })
+}
+
+// tick advances the clock by d, and waits for the sink to have `lines` lines.
+func tick(t *testing.T, c *fakeClock, d time.Duration, sk *testSink, lines int) {
+	t.Helper()
+	c.Advance(d)
+	waitFor(t, "the lines", func() bool { return len(sk.Lines()) >= lines })
+}
+
+func TestFakeClock(t *testing.T) {
+	c := newFakeClock()
+	start := c.Now()
+	ticker := c.NewTicker(time.Second)
+	timer := c.NewTimer(1500 * time.Millisecond)
+	called := make(chan time.Time, 1)
+	c.AfterFunc(2*time.Second, func() { called <- c.Now() })
+
+	c.Advance(time.Second)
+	if got := <-ticker.C(); !got.Equal(start.Add(time.Second)) {
+		t.Errorf("ticked at %s, want +1s", got.Sub(start))
+	}
+	select {
+	case <-timer.C():
+		t.Fatal("the timer fired early")
+	default:
+	}
+	c.Advance(time.Second)
+	if got := <-timer.C(); !got.Equal(start.Add(1500 * time.Millisecond)) {
+		t.Errorf("timer fired at %s, want +1.5s", got.Sub(start))
+	}
+	if got := <-called; !got.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("function called at %s, want +2s", got.Sub(start))
+	}
+	<-ticker.C()
+
+	// A ticker that isn't read drops the ticks past the first one.
+	c.Advance(3 * time.Second)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Fatal("got a second tick, want them dropped")
+	default:
+	}
+
+	ticker.Stop()
+	c.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("a stopped ticker ticked")
+	default:
+	}
+	if got := c.Now().Sub(start); got != 6*time.Second {
+		t.Errorf("now is +%s, want +6s", got)
+	}
+}
+
+func TestPrintersOnFakeClock(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "fast", Period: 1}, spec{Name: "slow", Period: 3})
+	waitTimers(t, c, 2)
+
+	for i := 1; i <= 3; i++ {
+		tick(t, c, time.Second, sk, i)
+	}
+	waitFor(t, "slow", func() bool { return len(sk.Lines()) == 4 })
+	want := []string{"0001 fast", "0002 fast", "0003 fast", "0003 slow"}
+	got := sk.Lines()
+	// The lines of the same second can come in any order.
+	sort.Strings(got[2:])
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+
+	"zgo.at/zli"
+)
+
+// Color depths accepted by -colordepth.
+var colorDepths = []string{"truecolor", "256", "16", "auto"}
+
+// colorDepth is how the colors are written to the terminal, one of colorDepths
+// other than "auto", set once the flags are parsed.
+var colorDepth = "truecolor"
+
+// resolveColorDepth returns the color depth of -colordepth, detecting it from the
+// COLORTERM and TERM environment variables for "auto".
+func resolveColorDepth(depth, colorterm, term string) string {
+	if depth != "auto" {
+		return depth
+	}
+	switch {
+	case colorterm == "truecolor" || colorterm == "24bit":
+		return "truecolor"
+	case strings.Contains(term, "256color"):
+		return "256"
+	case term == "":
+		// Such as the Windows console, which supports true colors.
+		return "truecolor"
+	default:
+		return "16"
+	}
+}
+
+// hexColor returns the color as #RRGGBB at the color depth, the closest one when
+// it has fewer colors.
+func hexColor(hex string) zli.Color {
+	c := zli.ColorHex(hex)
+	if colorDepth == "truecolor" || c == zli.ColorError {
+		return c
+	}
+	rgb := uint64(c>>zli.ColorOffsetFg) & 0xffffff
+	r, g, b := int(rgb&0xff), int(rgb>>8&0xff), int(rgb>>16&0xff)
+	if colorDepth == "256" {
+		return zli.Color256(nearest256(r, g, b))
+	}
+	return zli.Color(nearest16(r, g, b))<<zli.ColorOffsetFg | zli.ColorMode16Fg
+}
+
+// The 16 base colors, as xterm renders them by default: the normal ones, then the bright ones.
+var basePalette = [16][3]int{
+	{0x00, 0x00, 0x00}, {0xcd, 0x00, 0x00}, {0x00, 0xcd, 0x00}, {0xcd, 0xcd, 0x00},
+	{0x00, 0x00, 0xee}, {0xcd, 0x00, 0xcd}, {0x00, 0xcd, 0xcd}, {0xe5, 0xe5, 0xe5},
+	{0x7f, 0x7f, 0x7f}, {0xff, 0x00, 0x00}, {0x00, 0xff, 0x00}, {0xff, 0xff, 0x00},
+	{0x5c, 0x5c, 0xff}, {0xff, 0x00, 0xff}, {0x00, 0xff, 0xff}, {0xff, 0xff, 0xff},
+}
+
+// nearest16 returns the index of the base color closest to the color.
+func nearest16(r, g, b int) uint8 {
+	best, bestDist := 0, -1
+	for i, c := range basePalette {
+		if d := colorDist(r, g, b, c[0], c[1], c[2]); bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return uint8(best)
+}
+
+// Levels of each channel in the 6x6x6 cube of the 256 colors, which starts at 16.
+var cubeLevels = [6]int{0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+
+// nearest256 returns the index of the color of the cube or of the grayscale
+// ramp closest to the color. The first 16 aren't used, as terminals render
+// them differently.
+func nearest256(r, g, b int) uint8 {
+	level := func(v int) int {
+		best := 0
+		for i, l := range cubeLevels {
+			if abs(v-l) < abs(v-cubeLevels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	ri, gi, bi := level(r), level(g), level(b)
+	cube := 16 + 36*ri + 6*gi + bi
+	cubeDist := colorDist(r, g, b, cubeLevels[ri], cubeLevels[gi], cubeLevels[bi])
+
+	// The grayscale ramp goes from 8 to 238 by steps of 10, from 232 to 255.
+	gray := min(max((r+g+b)/3-8+5, 0)/10, 23)
+	v := 8 + 10*gray
+	if colorDist(r, g, b, v, v, v) < cubeDist {
+		return uint8(232 + gray)
+	}
+	return uint8(cube)
+}
+
+// colorDist returns the squared distance between two colors.
+func colorDist(r1, g1, b1, r2, g2, b2 int) int {
+	dr, dg, db := r1-r2, g1-g2, b1-b2
+	return dr*dr + dg*dg + db*db
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"zgo.at/zli"
+)
+
+// withColorDepth sets the color depth for the duration of the test.
+func withColorDepth(t *testing.T, depth string) {
+	old := colorDepth
+	colorDepth = depth
+	t.Cleanup(func() { colorDepth = old })
+}
+
+func TestNearest16(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want uint8
+	}{
+		{"#000000", 0},
+		{"#CD0000", 1},
+		{"#FF0000", 9},
+		{"#F00000", 9},
+		{"#C00000", 1},
+		{"#00FF00", 10},
+		{"#0000FF", 4},
+		{"#6060FF", 12},
+		{"#808080", 8},
+		{"#C0C0C0", 7},
+		{"#FFFFFF", 15},
+		{"#FF8800", 3},
+		{"#FF5F87", 5},
+		{"#5FD7FF", 14},
+		{"#400000", 0},
+	}
+	for _, tt := range tests {
+		c := uint64(zli.ColorHex(tt.hex)>>zli.ColorOffsetFg) & 0xffffff
+		if got := nearest16(int(c&0xff), int(c>>8&0xff), int(c>>16&0xff)); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.hex, got, tt.want)
+		}
+	}
+}
+
+func TestNearest256(t *testing.T) {
+	tests := []struct {
+		r, g, b int
+		want    uint8
+	}{
+		{0, 0, 0, 16},
+		{255, 255, 255, 231},
+		{255, 0, 0, 196},
+		{0x5f, 0x87, 0xaf, 67},
+		// The grays are closer on the ramp than in the cube.
+		{0x80, 0x80, 0x80, 244},
+		{0x08, 0x08, 0x08, 232},
+	}
+	for _, tt := range tests {
+		if got := nearest256(tt.r, tt.g, tt.b); got != tt.want {
+			t.Errorf("#%02x%02x%02x: got %d, want %d", tt.r, tt.g, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestResolveColorDepth(t *testing.T) {
+	tests := []struct {
+		depth, colorterm, term string
+		want                   string
+	}{
+		{"16", "truecolor", "xterm-256color", "16"},
+		{"auto", "truecolor", "xterm", "truecolor"},
+		{"auto", "24bit", "", "truecolor"},
+		{"auto", "", "xterm-256color", "256"},
+		{"auto", "", "xterm", "16"},
+		{"auto", "", "linux", "16"},
+		{"auto", "", "", "truecolor"},
+	}
+	for _, tt := range tests {
+		if got := resolveColorDepth(tt.depth, tt.colorterm, tt.term); got != tt.want {
+			t.Errorf("%s with COLORTERM=%q TERM=%q: got %s, want %s", tt.depth, tt.colorterm, tt.term, got, tt.want)
+		}
+	}
+}
+
+func TestHexColor(t *testing.T) {
+	withColors(t)
+	tests := []struct {
+		depth string
+		// Escape of #FF0000 at the depth.
+		want string
+	}{
+		{"truecolor", "\x1b[38;2;255;0;0m"},
+		{"256", "\x1b[38;5;196m"},
+		{"16", "\x1b[91m"},
+	}
+	for _, tt := range tests {
+		withColorDepth(t, tt.depth)
+		if got := zli.Colorize("a", hexColor("#FF0000")); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: got %q, want it to start with %q", tt.depth, got, tt.want)
+		}
+		// Invalid colors stay invalid at every depth.
+		if c := hexColor("red"); c != zli.ColorError {
+			t.Errorf("%s: got %v for an invalid color", tt.depth, c)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// config is the configuration of the program, set by the command-line flags.
+// The JSON names of the fields are the names of their flags.
+type config struct {
+	// Addresses to listen on, defaultListen if none is given.
+	Listen listenFlags `json:"http"`
+	// Allows printers to run guard commands.
+	AllowExec bool `json:"allow-exec"`
+	// Printers to launch at startup.
+	Printers printerFlags `json:"printer"`
+	// Period used when none, or an invalid one, is given.
+	DefaultPeriod int `json:"defaultperiod"`
+	// Enables debug logs.
+	Verbose bool `json:"verbose"`
+	// Serves HTTP/2 over cleartext connections.
+	HTTP2 bool `json:"http2"`
+	// Prints without colors.
+	NoColor bool `json:"nocolor"`
+	// Prints the color of the names given as arguments or on stdin, and exits.
+	ListColors bool `json:"listcolors"`
+	// Serves the API without the HTML page.
+	APIOnly bool `json:"apionly"`
+	// Path every route is served under.
+	BasePath string `json:"basepath"`
+	// Theme of the HTML page.
+	Theme string `json:"theme"`
+	// Rejects every request that would change the printers.
+	ReadOnly bool `json:"readonly"`
+	// Limits the number of printers, and of simultaneous HTTP connections.
+	MaxPrinters int `json:"max"`
+	MaxConns    int `json:"maxconns"`
+	// Timeouts of the HTTP server, against slow clients.
+	ReadHeaderTimeout time.Duration `json:"readheadertimeout"`
+	ReadTimeout       time.Duration `json:"readtimeout"`
+	WriteTimeout      time.Duration `json:"writetimeout"`
+	IdleTimeout       time.Duration `json:"idletimeout"`
+	// File where the printers are saved, to restore them at startup.
+	StateFile string `json:"state"`
+	// Format of the state file.
+	StateFormat string `json:"stateformat"`
+	// Compresses the large HTTP responses.
+	Gzip bool `json:"gzip"`
+	// How long the printers keep ticking after POST /api/drain.
+	DrainGrace time.Duration `json:"draingrace"`
+	// Restarts the stalled printers.
+	Supervise bool `json:"supervise"`
+	// Time printed before the names, and its time zone when absolute.
+	Timestamps string `json:"timestamps"`
+	TZ         string `json:"tz"`
+	// Format of the lines printed to stdout, and style of their time prefix.
+	OutFormat   string `json:"outformat"`
+	PrefixColor string `json:"prefixcolor"`
+	ColorDepth  string `json:"colordepth"`
+	// Maximum number of lines printed per second, and what to do with the ones past it.
+	MaxRate  int    `json:"maxrate"`
+	Overflow string `json:"overflow"`
+	// File to load the presets from.
+	PresetsFile string `json:"presets"`
+	// Launches the demo printers at startup.
+	Demo bool `json:"demo"`
+	// Text file of printers to launch at startup.
+	ImportFile string `json:"import"`
+	// Destinations of the printed lines, in addition to stdout.
+	OutFile string `json:"out"`
+	Syslog  bool   `json:"syslog"`
+	Net     string `json:"net"`
+	// Destinations the printers can write to instead of the ones above, by name.
+	Sinks    sinkFlags `json:"sink"`
+	NoStdout bool      `json:"nostdout"`
+	// Rotation of the -out file, in megabytes for the size.
+	OutMaxSize    int           `json:"out-maxsize"`
+	OutMaxAge     time.Duration `json:"out-maxage"`
+	OutMaxBackups int           `json:"out-maxbackups"`
+	// Colors of the printers whose name matches a pattern, the first match wins.
+	ColorRules colorRules `json:"colorrules"`
+	// Maximum size of the request bodies, in bytes.
+	MaxBody int64 `json:"maxbody"`
+	// What to do when a printer is added through the API with a name that is taken.
+	Dupes string `json:"dupes"`
+	// How the names of the printers are normalized when they are added.
+	Normalize string `json:"normalize"`
+	// Endpoints and features of the printers turned off.
+	Disable string `json:"disable"`
+	// What the printers do with the tick handled when the system resumes from sleep.
+	Resume string `json:"resume"`
+	// Bearer token the requests must be sent with, and whether the reads don't need it.
+	Token        string `json:"token"`
+	ReadonlyOpen bool   `json:"readonly-open"`
+	// Serves the goroutine stacks.
+	Debug bool `json:"debug"`
+	// URL the events of the printers are posted to, and which ones.
+	Webhook       string `json:"webhook"`
+	WebhookEvents string `json:"webhook-events"`
+}
+
+// cfg is the configuration of the program, set once the flags are parsed.
+var cfg config
+
+// register defines the flags setting the fields of the configuration.
+func (c *config) register(fs *flag.FlagSet) {
+	fs.Var(&c.Listen, "http", "address to listen on, as addr, or addr=readonly to only allow reads on it (repeatable, default "+defaultListen+")")
+	fs.BoolVar(&c.AllowExec, "allow-exec", false, "allow printers to run shell guard commands")
+	fs.Var(&c.Printers, "printer", "printer to launch at startup, as name:period or name for the default period (repeatable)")
+	fs.IntVar(&c.DefaultPeriod, "defaultperiod", 1, "period in seconds used when none or an invalid one is given")
+	fs.BoolVar(&c.Verbose, "verbose", false, "enable debug logs")
+	fs.BoolVar(&c.HTTP2, "http2", false, "serve HTTP/2 over cleartext (h2c), for use behind a TLS-terminating proxy")
+	fs.BoolVar(&c.NoColor, "nocolor", false, "print without colors")
+	fs.BoolVar(&c.ListColors, "listcolors", false, "print the color of each argument, or of each line of stdin, and exit")
+	fs.BoolVar(&c.APIOnly, "apionly", false, "only serve the API and the health check, without the HTML page")
+	fs.StringVar(&c.BasePath, "basepath", "", "serve every route under this path, such as /ticker, when behind a reverse proxy")
+	fs.StringVar(&c.Theme, "theme", "plain", "theme of the HTML page: "+strings.Join(themes, " or "))
+	fs.BoolVar(&c.ReadOnly, "readonly", false, "only allow reading the printers, for sharing a dashboard")
+	fs.IntVar(&c.MaxPrinters, "max", 0, "maximum number of printers, 0 for no limit")
+	fs.IntVar(&c.MaxConns, "maxconns", 0, "maximum number of simultaneous HTTP connections, 0 for no limit; others wait to be accepted")
+	fs.DurationVar(&c.ReadHeaderTimeout, "readheadertimeout", 5*time.Second, "maximum time to read the headers of a request, 0 for no limit")
+	fs.DurationVar(&c.ReadTimeout, "readtimeout", 30*time.Second, "maximum time to read a whole request, 0 for no limit")
+	fs.DurationVar(&c.WriteTimeout, "writetimeout", 30*time.Second, "maximum time to handle a request and write its response, 0 for no limit")
+	fs.DurationVar(&c.IdleTimeout, "idletimeout", 2*time.Minute, "maximum time to keep an idle keep-alive connection open, 0 for no limit")
+	fs.StringVar(&c.StateFile, "state", "", "save the printers to this file, and restore them at startup")
+	fs.StringVar(&c.StateFormat, "stateformat", "auto", "format the -state file is written in: json, gob, which is faster with many printers, or auto for gob if the file ends in .gob and JSON otherwise; both are read")
+	fs.BoolVar(&c.Gzip, "gzip", false, "compress the large HTTP responses for the clients accepting gzip")
+	fs.DurationVar(&c.DrainGrace, "draingrace", defaultDrainGrace, "how long the printers keep ticking after POST /api/drain, before the server shuts down")
+	fs.BoolVar(&c.Supervise, "supervise", false, "restart the printers that missed their ticks for more than twice their period")
+	fs.StringVar(&c.Timestamps, "timestamps", "elapsed", "time printed before the names: elapsed seconds since the start, or absolute time of the tick")
+	fs.StringVar(&c.TZ, "tz", "Local", "IANA time zone of the absolute timestamps, such as Europe/Paris")
+	fs.StringVar(&c.OutFormat, "outformat", "ansi", "format of the lines printed to stdout, and to -out too for ndjson: "+strings.Join(outFormats, ", "))
+	fs.StringVar(&c.PrefixColor, "prefixcolor", "", "style of the time prefix of the colored lines: dim, or a color as #RRGGBB; plain by default")
+	fs.StringVar(&c.ColorDepth, "colordepth", "truecolor", "how the colors are written to the terminal: "+strings.Join(colorDepths, ", ")+", which detects it from COLORTERM and TERM")
+	fs.IntVar(&c.MaxRate, "maxrate", 0, "maximum number of lines printed per second by all the printers together, 0 for no limit")
+	fs.StringVar(&c.Overflow, "overflow", "queue", "what to do with the lines past -maxrate: "+strings.Join(overflowPolicies, " or "))
+	fs.StringVar(&c.PresetsFile, "presets", "", "load presets of printers from this JSON file")
+	fs.BoolVar(&c.Demo, "demo", false, "launch a few demo printers at startup: "+demoNames())
+	fs.StringVar(&c.ImportFile, "import", "", "launch the printers of this text file at startup, one name and period per line")
+	fs.StringVar(&c.OutFile, "out", "", "also append the printed lines, without colors, to this file or FIFO")
+	fs.BoolVar(&c.Syslog, "syslog", false, "also send the printed lines to syslog")
+	fs.StringVar(&c.Net, "net", "", "also send the printed lines, without colors, to this address, as tcp://host:port or udp://host:port")
+	fs.Var(&c.Sinks, "sink", "destination that printers can choose with their sink field instead of the default ones, as name=target, with stdout, stderr, tcp://host:port, udp://host:port or a file as the target (repeatable)")
+	fs.BoolVar(&c.NoStdout, "nostdout", false, "don't print the lines to stdout, only to -out, -syslog, -net, the -webhook and the shadow printers")
+	fs.IntVar(&c.OutMaxSize, "out-maxsize", 0, "rotate the -out file once it would grow past this many megabytes, 0 for no limit")
+	fs.DurationVar(&c.OutMaxAge, "out-maxage", 0, "rotate the -out file once it is this old, 0 for no limit")
+	fs.IntVar(&c.OutMaxBackups, "out-maxbackups", 0, "number of rotated -out files to keep, 0 to keep them all")
+	fs.Var(&c.ColorRules, "colorrules", "color of the printers whose name matches a regular expression, as pattern=#RRGGBB, before the one derived from the name; the first matching rule wins (repeatable)")
+	fs.Int64Var(&c.MaxBody, "maxbody", defaultMaxBody, "maximum size of the request bodies in bytes, larger ones are rejected with a 413; 0 for no limit")
+	fs.StringVar(&c.Dupes, "dupes", "reject", "what to do when a printer is added with a name that is taken: reject it with a 409, or suffix the name with (2), (3)...")
+	fs.StringVar(&c.Normalize, "normalize", "none", "how the names of the added printers are normalized, so that the ones that only differ by it are the same printer: "+strings.Join(normalizeModes, ", "))
+	fs.StringVar(&c.Disable, "disable", "", "comma-separated endpoints answering 404 and fields of the printers rejected with a 403, among: "+strings.Join(append(slices.Clone(disableEndpoints), disableFeatures...), ", "))
+	fs.StringVar(&c.Resume, "resume", "catchup", "what the printers do with their tick that is late because the system slept: catchup prints it on resume, skip waits for the next one")
+	fs.StringVar(&c.Token, "token", "", "require an Authorization: Bearer header with this token on every request but the health checks")
+	fs.BoolVar(&c.ReadonlyOpen, "readonly-open", false, "let the GET and HEAD requests through without the -token, such as the page")
+	fs.BoolVar(&c.Debug, "debug", false, "serve the stacks of every goroutine on GET /debug/stacks, to diagnose a stuck server")
+	fs.StringVar(&c.Webhook, "webhook", "", "post a JSON event to this URL when a printer is added or stopped, without blocking them")
+	fs.StringVar(&c.WebhookEvents, "webhook-events", "add,stop", "comma-separated events posted to the -webhook: "+strings.Join(webhookEvents, ", ")+", tick being limited to one per second")
+}
+
+// validate checks every flag and the files they name, and returns an error for
+// each invalid one, starting with the name of its flag, and warnings about the flags that are valid but
+// have no effect with the others.
+func (c *config) validate() (errs []error, warnings []string) {
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if !slices.Contains(themes, c.Theme) {
+		invalid("-theme %q: expected %s", c.Theme, strings.Join(themes, " or "))
+	}
+	if _, err := cleanBasePath(c.BasePath); err != nil {
+		invalid("-basepath %q: %s", c.BasePath, err)
+	}
+	if !slices.Contains(outFormats, c.OutFormat) {
+		invalid("-outformat %q: expected %s", c.OutFormat, strings.Join(outFormats, ", "))
+	}
+	if c.PrefixColor != "" && c.PrefixColor != "dim" && !colorRe.MatchString(c.PrefixColor) {
+		invalid("-prefixcolor %q: expected dim or a color as #RRGGBB", c.PrefixColor)
+	}
+	if !slices.Contains(stateFormats, c.StateFormat) {
+		invalid("-stateformat %q: expected %s", c.StateFormat, strings.Join(stateFormats, ", "))
+	}
+	if !slices.Contains(colorDepths, c.ColorDepth) {
+		invalid("-colordepth %q: expected %s", c.ColorDepth, strings.Join(colorDepths, ", "))
+	}
+	if !slices.Contains(timestampFormats, c.Timestamps) {
+		invalid("-timestamps %q: expected %s", c.Timestamps, strings.Join(timestampFormats, " or "))
+	}
+	if _, err := time.LoadLocation(c.TZ); err != nil {
+		invalid("-tz %q: %s", c.TZ, err)
+	}
+	if c.MaxRate < 0 {
+		invalid("-maxrate %d: must be a positive number of lines per second, or 0", c.MaxRate)
+	}
+	if !slices.Contains(overflowPolicies, c.Overflow) {
+		invalid("-overflow %q: expected %s", c.Overflow, strings.Join(overflowPolicies, " or "))
+	}
+	for _, t := range []struct {
+		name string
+		d    time.Duration
+	}{{"readheadertimeout", c.ReadHeaderTimeout}, {"readtimeout", c.ReadTimeout}, {"writetimeout", c.WriteTimeout}, {"idletimeout", c.IdleTimeout}, {"draingrace", c.DrainGrace}, {"out-maxage", c.OutMaxAge}} {
+		if t.d < 0 {
+			invalid("-%s %s: must be positive, or 0", t.name, t.d)
+		}
+	}
+	if c.OutMaxSize < 0 {
+		invalid("-out-maxsize %d: must be positive, or 0", c.OutMaxSize)
+	}
+	if c.OutMaxBackups < 0 {
+		invalid("-out-maxbackups %d: must be positive, or 0", c.OutMaxBackups)
+	}
+	if _, err := parseWebhookEvents(c.WebhookEvents); err != nil {
+		invalid("-webhook-events %q: %s", c.WebhookEvents, err)
+	}
+	if c.Net != "" {
+		if _, _, err := parseNetAddr(c.Net); err != nil {
+			invalid("-net %q: %s", c.Net, err)
+		}
+	}
+	if c.Webhook != "" {
+		if err := validateWebhookURL(c.Webhook); err != nil {
+			invalid("-webhook %q: %s", c.Webhook, err)
+		}
+	}
+	if !slices.Contains(dupesModes, c.Dupes) {
+		invalid("-dupes %q: expected %s", c.Dupes, strings.Join(dupesModes, " or "))
+	}
+	if !slices.Contains(normalizeModes, c.Normalize) {
+		invalid("-normalize %q: expected %s", c.Normalize, strings.Join(normalizeModes, ", "))
+	}
+	if _, err := parseDisable(c.Disable); err != nil {
+		invalid("-disable %q: %s", c.Disable, err)
+	}
+	if !slices.Contains(resumePolicies, c.Resume) {
+		invalid("-resume %q: expected %s", c.Resume, strings.Join(resumePolicies, " or "))
+	}
+	if c.MaxBody < 0 {
+		invalid("-maxbody %d: must be a positive number of bytes, or 0", c.MaxBody)
+	}
+	if c.DefaultPeriod < 1 {
+		invalid("-defaultperiod %d: must be a positive number of seconds", c.DefaultPeriod)
+	}
+	// The files are read too, so that a missing or broken one is reported with
+	// the flags before anything starts. main reads them again to use them.
+	if c.PresetsFile != "" {
+		if _, err := loadPresets(c.PresetsFile); err != nil {
+			invalid("-presets %q: %s", c.PresetsFile, err)
+		}
+	}
+	if c.ImportFile != "" {
+		if _, _, err := loadImport(c.ImportFile); err != nil {
+			invalid("-import %q: %s", c.ImportFile, err)
+		}
+	}
+	if c.StateFile != "" {
+		if _, err := (&state{path: c.StateFile}).Load(); err != nil {
+			invalid("-state %q: %s", c.StateFile, err)
+		}
+	}
+
+	warn := func(flags, msg string) {
+		warnings = append(warnings, flags+" "+msg)
+	}
+	if c.StateFile == "" && c.StateFormat != "auto" {
+		warn("-stateformat", "has no effect without -state")
+	}
+	if c.WriteTimeout > 0 && c.WriteTimeout <= pollTimeout {
+		warn("-writetimeout", fmt.Sprintf("cuts off the long polls of /api/poll, which wait up to %s", pollTimeout))
+	}
+	if c.OutFile == "" && (c.OutMaxSize > 0 || c.OutMaxAge > 0 || c.OutMaxBackups > 0) {
+		warn("-out-maxsize, -out-maxage and -out-maxbackups", "have no effect without -out")
+	}
+	if c.OutMaxBackups > 0 && c.OutMaxSize == 0 && c.OutMaxAge == 0 {
+		warn("-out-maxbackups", "has no effect without -out-maxsize or -out-maxage")
+	}
+	if c.TZ != "Local" && c.Timestamps != "absolute" {
+		warn("-tz", "has no effect without -timestamps absolute")
+	}
+	if c.PrefixColor != "" && (c.OutFormat == "plain" || c.OutFormat == "ndjson" || c.NoColor) {
+		warn("-prefixcolor", "has no effect without colors")
+	}
+	if c.Overflow != "queue" && c.MaxRate == 0 {
+		warn("-overflow", "has no effect without -maxrate")
+	}
+	if c.Webhook == "" && c.WebhookEvents != "add,stop" {
+		warn("-webhook-events", "has no effect without -webhook")
+	}
+	if c.NoStdout && c.OutFile == "" && !c.Syslog && c.Net == "" && c.Webhook == "" {
+		warn("-nostdout", "leaves the lines printed nowhere, without -out, -syslog, -net or -webhook")
+	}
+	if c.ReadonlyOpen && c.Token == "" {
+		warn("-readonly-open", "has no effect without -token")
+	}
+	if c.Debug && (c.ReadOnly || slices.ContainsFunc(c.Listen, func(la listenAddr) bool { return la.readOnly })) {
+		warn("-debug", "serves the goroutine stacks on the read-only listeners too")
+	}
+	if c.ReadOnly && c.Dupes != "reject" {
+		warn("-dupes", "has no effect with -readonly, nothing can be added")
+	}
+	return errs, warnings
+}
+
+// MarshalJSON writes the durations as strings such as "30s", like their flags
+// take them, instead of numbers of nanoseconds.
+func (c config) MarshalJSON() ([]byte, error) {
+	// Without the method, to not recurse.
+	type fields config
+	if c.Printers == nil {
+		c.Printers = printerFlags{}
+	}
+	return json.Marshal(struct {
+		fields
+		ReadHeaderTimeout string `json:"readheadertimeout"`
+		ReadTimeout       string `json:"readtimeout"`
+		WriteTimeout      string `json:"writetimeout"`
+		IdleTimeout       string `json:"idletimeout"`
+		DrainGrace        string `json:"draingrace"`
+		OutMaxAge         string `json:"out-maxage"`
+	}{
+		fields:            fields(c),
+		ReadHeaderTimeout: c.ReadHeaderTimeout.String(),
+		ReadTimeout:       c.ReadTimeout.String(),
+		WriteTimeout:      c.WriteTimeout.String(),
+		IdleTimeout:       c.IdleTimeout.String(),
+		DrainGrace:        c.DrainGrace.String(),
+		OutMaxAge:         c.OutMaxAge.String(),
+	})
+}
+
+// handleConfig returns the configuration the server runs with, with the -token
+// and the credentials of the -webhook URL redacted.
+func (s *server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	c := *s.config
+	if c.Token != "" {
+		c.Token = "redacted"
+	}
+	c.Webhook = redactURL(c.Webhook)
+	writeJSON(w, r, http.StatusOK, c)
+}
+
+// redactURL returns the URL without its password and with the values of its
+// query removed, as either can be a secret, or "redacted" if it can't be parsed.
+func redactURL(s string) string {
+	if s == "" {
+		return ""
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "redacted"
+	}
+	q := u.Query()
+	for k := range q {
+		q[k] = []string{""}
+	}
+	u.RawQuery = q.Encode()
+	return u.Redacted()
+}
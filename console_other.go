@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// enableColors reports whether the terminal will render colors, which is
+// always the case outside of Windows.
+func enableColors() bool {
+	return true
+}
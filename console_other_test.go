@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "testing"
+
+func TestEnableColors(t *testing.T) {
+	if !enableColors() {
+		t.Error("colors are disabled outside of Windows")
+	}
+}
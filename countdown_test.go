@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCountdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		period int
+		// Lines printed by the end of each second.
+		want [][]string
+	}{
+		{"countdown", 5, [][]string{
+			{},
+			{"0002 launch 3..."},
+			{"0003 launch 2..."},
+			{"0004 launch 1..."},
+			{"0005 launch"},
+			{},
+			{"0007 launch 3..."},
+			{"0008 launch 2..."},
+			{"0009 launch 1..."},
+			{"0010 launch"},
+		}},
+		{"just long enough", 4, [][]string{
+			{"0001 launch 3..."},
+			{"0002 launch 2..."},
+			{"0003 launch 1..."},
+			{"0004 launch"},
+			{"0005 launch 3..."},
+		}},
+		{"too short", 3, [][]string{{}, {}, {"0003 launch"}, {}, {}, {"0006 launch"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClock()
+			p, sk := newTestPrinters(t, c)
+			mustAdd(t, p, spec{Name: "launch", Period: tt.period, Countdown: true})
+			timers := 1
+			if tt.period > countdownSteps {
+				timers++
+			}
+			waitTimers(t, c, timers)
+			var want []string
+			for i, lines := range tt.want {
+				want = append(want, lines...)
+				c.Advance(time.Second)
+				if len(lines) == 0 {
+					time.Sleep(10 * time.Millisecond)
+				}
+				waitFor(t, "the lines", func() bool { return len(sk.Lines()) >= len(want) })
+				if got := sk.Lines(); !slices.Equal(got, want) {
+					t.Fatalf("after %ds, got %q, want %q", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCountdownPaused(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "launch", Period: 5, Countdown: true})
+	waitTimers(t, c, 2)
+	if err := p.SetPaused("launch", true); err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		c.Advance(time.Second)
+		time.Sleep(2 * time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if got := sk.Lines(); len(got) != 0 {
+		t.Errorf("a paused printer printed %q", got)
+	}
+}
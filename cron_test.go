@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCronOnFakeClock(t *testing.T) {
+	c := newFakeClock()
+	start := c.Now()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "cron", Cron: "*/5 * * * *"})
+	waitTimers(t, c, 1)
+
+	next := func() time.Time {
+		info, _ := p.Get("cron")
+		if info.Next == nil {
+			t.Fatal("no next time")
+		}
+		return *info.Next
+	}
+	if got := next(); !got.Equal(start.Add(5 * time.Minute)) {
+		t.Errorf("next at %s, want 12:05", got)
+	}
+	c.Advance(4 * time.Minute)
+	time.Sleep(10 * time.Millisecond)
+	if got := sk.Lines(); len(got) != 0 {
+		t.Fatalf("printed %q before the schedule", got)
+	}
+	tick(t, c, time.Minute, sk, 1)
+	waitFor(t, "the next time", func() bool { return next().Equal(start.Add(10 * time.Minute)) })
+	tick(t, c, 5*time.Minute, sk, 2)
+	if got := sk.Lines(); len(got) != 2 || got[0] != "0300 cron" || got[1] != "0600 cron" {
+		t.Errorf("got %q, want lines at 12:05 and 12:10", got)
+	}
+}
+
+func TestCronValidation(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`[{"name": "ok", "cron": "0 9 * * 1-5"}]`, http.StatusOK},
+		{`[{"name": "bad", "cron": "every weekday"}]`, http.StatusBadRequest},
+		{`[{"name": "bad", "cron": "61 * * * *"}]`, http.StatusBadRequest},
+		{`[{"name": "bad", "cron": "* * * * *", "precise": true}]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			if w := serve(t, newTestServer(p), http.MethodPost, "/api/printers/bulk", tt.body); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Most colors in the palette of a cycling printer.
+const maxPalette = 16
+
+// validateCycle checks the palette of a printer cycling through colors.
+func validateCycle(sp spec) error {
+	switch {
+	case len(sp.Palette) == 0:
+		return nil
+	case !sp.Cycle:
+		return errors.New("palette only applies to printers with cycle")
+	case len(sp.Palette) > maxPalette:
+		return fmt.Errorf("too many colors in the palette, at most %d", maxPalette)
+	}
+	for _, c := range sp.Palette {
+		if !colorRe.MatchString(c) {
+			return fmt.Errorf("invalid color %q in the palette: expected #RRGGBB", c)
+		}
+	}
+	return nil
+}
+
+// defaultPalette returns the palette of a printer cycling without one: its
+// color, then the same color with its channels rotated, which is as bright.
+func defaultPalette(color string) []string {
+	if len(color) != 7 {
+		return []string{color}
+	}
+	r, g, b := color[1:3], color[3:5], color[5:7]
+	return []string{color, "#" + g + b + r, "#" + b + r + g}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDefaultPalette(t *testing.T) {
+	tests := []struct {
+		color string
+		want  []string
+	}{
+		{"#112233", []string{"#112233", "#223311", "#331122"}},
+		{"#FF8800", []string{"#FF8800", "#8800FF", "#00FF88"}},
+		{"", []string{""}},
+	}
+	for _, tt := range tests {
+		if got := defaultPalette(tt.color); !slices.Equal(got, tt.want) {
+			t.Errorf("defaultPalette(%q) = %q, want %q", tt.color, got, tt.want)
+		}
+	}
+}
+
+func TestCycle(t *testing.T) {
+	tests := []struct {
+		name string
+		sp   spec
+		want []string
+	}{
+		{"palette", spec{Name: "a", Period: 1, Cycle: true, Palette: []string{"#FF0000", "#00FF00"}}, []string{"#FF0000", "#00FF00", "#FF0000", "#00FF00"}},
+		{"default palette", spec{Name: "a", Period: 1, Color: "#112233", Cycle: true}, []string{"#112233", "#223311", "#331122", "#112233"}},
+		{"fixed", spec{Name: "a", Period: 1, Color: "#112233"}, []string{"#112233", "#112233", "#112233", "#112233"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClock()
+			p, sk := newTestPrinters(t, c)
+			p.out.format = "ndjson"
+			mustAdd(t, p, tt.sp)
+			waitTimers(t, c, 1)
+			for i := range tt.want {
+				tick(t, c, time.Second, sk, i+1)
+			}
+			var got []string
+			for _, l := range sk.Lines() {
+				var jl jsonLine
+				if err := json.Unmarshal([]byte(l), &jl); err != nil {
+					t.Fatalf("%q: %s", l, err)
+				}
+				got = append(got, jl.Color)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got the colors %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCycleValidation(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`[{"name": "a", "period": 1, "cycle": true}]`, http.StatusOK},
+		{`[{"name": "a", "period": 1, "cycle": true, "palette": ["#FF0000", "#00FF00"]}]`, http.StatusOK},
+		{`[{"name": "a", "period": 1, "cycle": "yes"}]`, http.StatusBadRequest},
+		{`[{"name": "a", "period": 1, "palette": ["#FF0000"]}]`, http.StatusBadRequest},
+		{`[{"name": "a", "period": 1, "cycle": true, "palette": ["red"]}]`, http.StatusBadRequest},
+		{`[{"name": "a", "period": 1, "cycle": true, "palette": "#FF0000"}]`, http.StatusBadRequest},
+		{`[{"name": "a", "period": 1, "cycle": true, "palette": ["#000000", "#000001", "#000002", "#000003", "#000004", "#000005", "#000006", "#000007", "#000008", "#000009", "#00000A", "#00000B", "#00000C", "#00000D", "#00000E", "#00000F", "#000010"]}]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			if w := serve(t, newTestServer(p), http.MethodPost, "/api/printers/bulk", tt.body); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestCycleAPI(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 5, Cycle: true, Palette: []string{"#FF0000", "#00FF00"}}, spec{Name: "b", Period: 5})
+	w := serve(t, newTestServer(p), http.MethodGet, "/api/printers", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var got []struct {
+		Name    string
+		Cycle   bool
+		Palette []string
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got[0].Cycle || !slices.Equal(got[0].Palette, []string{"#FF0000", "#00FF00"}) || got[1].Cycle || got[1].Palette != nil {
+		t.Errorf("got %+v, want a cycling with its palette and b fixed", got)
+	}
+}
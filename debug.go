@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+)
+
+// handleStacks returns the stacks of every goroutine, like a SIGQUIT prints them
+// but without killing the server, to find where it is stuck.
+func (s *server) handleStacks(w http.ResponseWriter, r *http.Request) {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(buf)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStacks(t *testing.T) {
+	tests := []struct {
+		name            string
+		debug, readOnly bool
+		want            int
+	}{
+		{"without -debug", false, false, http.StatusNotFound},
+		{"without -debug, read-only", false, true, http.StatusNotFound},
+		{"with -debug", true, false, http.StatusOK},
+		{"with -debug, read-only", true, true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			mustAdd(t, p, spec{Name: "a", Period: 60})
+			p.waitRunning(startTimeout)
+			s := newTestServer(p)
+			s.debug, s.readOnly = tt.debug, tt.readOnly
+			w := serve(t, s, http.MethodGet, "/debug/stacks", "")
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d", w.Code, tt.want)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+				t.Errorf("Content-Type %q, want text/plain", ct)
+			}
+			// Every goroutine is there, such as the one of the printer.
+			if body := w.Body.String(); !strings.HasPrefix(body, "goroutine ") || !strings.Contains(body, "runPrinter") {
+				t.Errorf("got %.200q, want the stacks of every goroutine", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+)
+
+// specDiff is what would change to go from a set of printers to another one.
+type specDiff struct {
+	Add    []spec       `json:"add"`
+	Remove []string     `json:"remove"`
+	Modify []specChange `json:"modify"`
+}
+
+// specChange lists the fields that differ between two printers with the same name.
+type specChange struct {
+	Name    string        `json:"name"`
+	Changes []fieldChange `json:"changes"`
+}
+
+type fieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// diffSpecs compares the current specs with the wanted ones, by name.
+// The names of the wanted specs must be unique.
+func diffSpecs(current, wanted []spec) specDiff {
+	d := specDiff{Add: []spec{}, Remove: []string{}, Modify: []specChange{}}
+	byName := make(map[string]spec, len(current))
+	for _, sp := range current {
+		byName[sp.Name] = sp
+	}
+	for _, w := range wanted {
+		c, ok := byName[w.Name]
+		if !ok {
+			d.Add = append(d.Add, w)
+			continue
+		}
+		delete(byName, w.Name)
+		if changes := specChanges(c, w); len(changes) > 0 {
+			d.Modify = append(d.Modify, specChange{Name: w.Name, Changes: changes})
+		}
+	}
+	for name := range byName {
+		d.Remove = append(d.Remove, name)
+	}
+
+	sort.Slice(d.Add, func(i, j int) bool { return d.Add[i].Name < d.Add[j].Name })
+	sort.Strings(d.Remove)
+	sort.Slice(d.Modify, func(i, j int) bool { return d.Modify[i].Name < d.Modify[j].Name })
+	return d
+}
+
+// specChanges returns the fields of `to` that differ from `from`. The period of
+// printers following a cron schedule on both sides is ignored, as it isn't used.
+func specChanges(from, to spec) []fieldChange {
+	var changes []fieldChange
+	add := func(field string, a, b any) {
+		if a != b {
+			changes = append(changes, fieldChange{Field: field, From: a, To: b})
+		}
+	}
+	if from.Cron == "" || to.Cron == "" {
+		add("period", from.Period, to.Period)
+	}
+	add("cron", from.Cron, to.Cron)
+	add("guard", from.Guard, to.Guard)
+	add("window", from.Window, to.Window)
+	add("priority", from.Priority, to.Priority)
+	add("color", from.Color, to.Color)
+	if !maps.Equal(from.Fields, to.Fields) {
+		changes = append(changes, fieldChange{Field: "fields", From: from.Fields, To: to.Fields})
+	}
+	add("precise", from.Precise, to.Precise)
+	add("dim", from.Dim, to.Dim)
+	add("text", from.Text, to.Text)
+	add("align", from.Align, to.Align)
+	add("offset", from.Offset, to.Offset)
+	add("countdown", from.Countdown, to.Countdown)
+	add("pinned", from.Pinned, to.Pinned)
+	add("minperiod", from.MinPeriod, to.MinPeriod)
+	add("maxperiod", from.MaxPeriod, to.MaxPeriod)
+	add("mirror", from.Mirror, to.Mirror)
+	add("sink", from.Sink, to.Sink)
+	add("cycle", from.Cycle, to.Cycle)
+	add("printevery", from.Every, to.Every)
+	if !slices.Equal(from.Palette, to.Palette) {
+		changes = append(changes, fieldChange{Field: "palette", From: from.Palette, To: to.Palette})
+	}
+	return changes
+}
+
+// handleDiff compares the current printers with a JSON array of printers in the
+// format of the bulk API, and returns what adding the new ones and stopping the
+// missing ones would change, without changing anything.
+func (s *server) handleDiff(w http.ResponseWriter, r *http.Request) {
+	var items []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		bodyError(w, err, "Invalid JSON body: expected an array of printers")
+		return
+	}
+
+	specs, errs := validateSpecs(items)
+	seen := make(map[string]bool, len(specs))
+	for i, sp := range specs {
+		if seen[sp.Name] {
+			errs = append(errs, fieldError{Index: i, Field: "name", Message: "is a duplicate"})
+		}
+		seen[sp.Name] = true
+	}
+	if len(errs) > 0 {
+		writeJSON(w, r, http.StatusBadRequest, map[string][]fieldError{"errors": errs})
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, diffSpecs(s.printers.Specs(), specs))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDiffSpecs(t *testing.T) {
+	tests := []struct {
+		name            string
+		current, wanted []spec
+		want            specDiff
+	}{
+		{
+			"unchanged",
+			[]spec{{Name: "a", Period: 5}},
+			[]spec{{Name: "a", Period: 5}},
+			specDiff{Add: []spec{}, Remove: []string{}, Modify: []specChange{}},
+		},
+		{
+			"added and removed, sorted",
+			[]spec{{Name: "z", Period: 1}, {Name: "y", Period: 1}},
+			[]spec{{Name: "c", Period: 2}, {Name: "b", Period: 3}},
+			specDiff{
+				Add:    []spec{{Name: "b", Period: 3}, {Name: "c", Period: 2}},
+				Remove: []string{"y", "z"},
+				Modify: []specChange{},
+			},
+		},
+		{
+			"modified fields",
+			[]spec{{Name: "a", Period: 5, Color: "#112233"}},
+			[]spec{{Name: "a", Period: 10, Color: "#112233", Pinned: true}},
+			specDiff{Add: []spec{}, Remove: []string{}, Modify: []specChange{{Name: "a", Changes: []fieldChange{
+				{Field: "period", From: 5, To: 10},
+				{Field: "pinned", From: false, To: true},
+			}}}},
+		},
+		{
+			"cron period ignored",
+			[]spec{{Name: "a", Period: 60, Cron: "* * * * *"}},
+			[]spec{{Name: "a", Cron: "* * * * *"}},
+			specDiff{Add: []spec{}, Remove: []string{}, Modify: []specChange{}},
+		},
+		{
+			"fields",
+			[]spec{{Name: "a", Period: 5, Fields: map[string]string{"k": "1"}}},
+			[]spec{{Name: "a", Period: 5, Fields: map[string]string{"k": "2"}}},
+			specDiff{Add: []spec{}, Remove: []string{}, Modify: []specChange{{Name: "a", Changes: []fieldChange{
+				{Field: "fields", From: map[string]string{"k": "1"}, To: map[string]string{"k": "2"}},
+			}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffSpecs(tt.current, tt.wanted); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffEndpoint(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "keep", Period: 60}, spec{Name: "change", Period: 60}, spec{Name: "drop", Period: 60})
+	s := newTestServer(p)
+
+	w := serve(t, s, http.MethodPost, "/api/diff", `[{"name": "keep", "period": 60}, {"name": "change", "period": "2m", "color": "#00FF00"}, {"name": "new", "period": 5}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var got struct {
+		Add    []spec
+		Remove []string
+		Modify []struct {
+			Name    string
+			Changes []fieldChange
+		}
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Add) != 1 || got.Add[0].Name != "new" || got.Add[0].Period != 5 {
+		t.Errorf("add %+v, want new", got.Add)
+	}
+	if !reflect.DeepEqual(got.Remove, []string{"drop"}) {
+		t.Errorf("remove %q, want drop", got.Remove)
+	}
+	if len(got.Modify) != 1 || got.Modify[0].Name != "change" {
+		t.Fatalf("modify %+v, want change", got.Modify)
+	}
+	fields := map[string]fieldChange{}
+	for _, c := range got.Modify[0].Changes {
+		fields[c.Field] = c
+	}
+	if c := fields["period"]; c.From != 60.0 || c.To != 120.0 {
+		t.Errorf("period change %+v, want from 60 to 120", c)
+	}
+	if c := fields["color"]; c.To != "#00FF00" {
+		t.Errorf("color change %+v, want to #00FF00", c)
+	}
+
+	// The diff changes nothing.
+	if _, ok := p.Get("drop"); !ok || len(p.List()) != 3 {
+		t.Error("the printers changed")
+	}
+	if info, _ := p.Get("change"); info.Period != 60 {
+		t.Errorf("change has the period %d, want still 60", info.Period)
+	}
+
+	for _, body := range []string{`{"name": "a"}`, `[{"period": 5}]`, `[{"name": "a", "period": 1}, {"name": "a", "period": 2}]`} {
+		if w := serve(t, s, http.MethodPost, "/api/diff", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Endpoints that -disable can turn off, each one covering a few routes, see routes.
+var disableEndpoints = []string{
+	"export", "colors", "stop-matching", "bulk", "period-matching", "boost", "presets",
+	"resync", "diff", "stats", "audit", "errors", "rate", "config", "status", "last", "poll",
+	"freeze", "pause-all", "drain", "selftest", "compact",
+}
+
+// Fields of the printers that -disable can turn off.
+var disableFeatures = []string{"guard", "cron", "mirror", "sink"}
+
+// parseDisable parses the comma-separated list of endpoints and features of -disable.
+func parseDisable(s string) (map[string]bool, error) {
+	disabled := make(map[string]bool)
+	for _, k := range strings.Split(s, ",") {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		if !slices.Contains(disableEndpoints, k) && !slices.Contains(disableFeatures, k) {
+			return nil, fmt.Errorf("unknown endpoint or feature %q, expected %s", k, strings.Join(append(slices.Clone(disableEndpoints), disableFeatures...), ", "))
+		}
+		disabled[k] = true
+	}
+	return disabled, nil
+}
+
+// checkFeatures returns an error wrapping ErrDisabled if the spec uses a feature
+// turned off by -disable.
+func checkFeatures(sp spec, disabled map[string]bool) error {
+	for _, f := range []struct {
+		name string
+		used bool
+	}{{"guard", sp.Guard != ""}, {"cron", sp.Cron != ""}, {"mirror", sp.Mirror != ""}, {"sink", sp.Sink != ""}} {
+		if f.used && disabled[f.name] {
+			return fmt.Errorf("%w: %s", ErrDisabled, f.name)
+		}
+	}
+	return nil
+}
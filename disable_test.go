@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseDisable(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  []string
+		valid bool
+	}{
+		{"", nil, true},
+		{"bulk", []string{"bulk"}, true},
+		{" bulk , guard,", []string{"bulk", "guard"}, true},
+		{"bulk,exec", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseDisable(tt.in)
+		if (err == nil) != tt.valid {
+			t.Errorf("%q: got %v, want valid %t", tt.in, err, tt.valid)
+			continue
+		}
+		if tt.valid && len(got) != len(tt.want) {
+			t.Errorf("%q: got %v, want %q", tt.in, got, tt.want)
+		}
+		for _, k := range tt.want {
+			if !got[k] {
+				t.Errorf("%q: %s isn't disabled", tt.in, k)
+			}
+		}
+	}
+}
+
+func TestDisabledEndpoints(t *testing.T) {
+	tests := []struct {
+		endpoint       string
+		method, target string
+		body, accept   string
+	}{
+		{"bulk", http.MethodPost, "/api/printers/bulk", `[{"name": "b", "period": 60}]`, ""},
+		{"export", http.MethodGet, "/api/printers.csv", "", ""},
+		{"export", http.MethodGet, "/api/printers", "", "text/csv"},
+		{"stats", http.MethodGet, "/api/stats", "", ""},
+		{"last", http.MethodGet, "/api/last/a", "", ""},
+		{"boost", http.MethodPost, "/api/printers/a/boost", `{"period": 1, "duration": 3}`, ""},
+		{"freeze", http.MethodPost, "/api/unfreeze", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint+" "+tt.target, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			mustAdd(t, p, spec{Name: "a", Period: 60})
+			s := newTestServer(p)
+			for _, disabled := range []bool{true, false} {
+				s.disabled = map[string]bool{tt.endpoint: disabled}
+				w := serve(t, s, tt.method, tt.target, tt.body, "Accept", tt.accept)
+				if (w.Code == http.StatusNotFound) != disabled {
+					t.Errorf("disabled %t: status %d", disabled, w.Code)
+				}
+			}
+		})
+	}
+	// The printers can still be listed as JSON without the exports.
+	p, _ := newTestPrinters(t, realClock{})
+	s := newTestServer(p)
+	s.disabled = map[string]bool{"export": true}
+	if w := serve(t, s, http.MethodGet, "/api/printers", ""); w.Code != http.StatusOK {
+		t.Errorf("status %d listing the printers, want 200", w.Code)
+	}
+}
+
+func TestDisabledFeatures(t *testing.T) {
+	withConfig(t, config{AllowExec: true})
+	tests := []struct {
+		feature string
+		sp      spec
+		form    url.Values
+	}{
+		{"guard", spec{Name: "g", Period: 60, Guard: "true"}, url.Values{"text": {"g"}, "period": {"60"}, "guard": {"true"}}},
+		{"cron", spec{Name: "c", Cron: "* * * * *"}, url.Values{"text": {"c"}, "cron": {"* * * * *"}}},
+		{"mirror", spec{Name: "m", Mirror: "a"}, url.Values{"text": {"m"}, "mirror": {"a"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.feature, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			p.disabled = map[string]bool{tt.feature: true}
+			mustAdd(t, p, spec{Name: "a", Period: 60})
+			if err := p.Add(tt.sp); !errors.Is(err, ErrDisabled) {
+				t.Errorf("got %v, want %v", err, ErrDisabled)
+			}
+			w := httptest.NewRecorder()
+			newTestServer(p).routes().ServeHTTP(w, formRequest(tt.form))
+			if w.Code != http.StatusForbidden {
+				t.Errorf("form: status %d, want 403: %s", w.Code, w.Body)
+			}
+			if n := len(p.List()); n != 1 {
+				t.Errorf("%d printers, want only a", n)
+			}
+			// The printers without the feature are still added.
+			mustAdd(t, p, spec{Name: "b", Period: 60})
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// Default value of -draingrace.
+const defaultDrainGrace = 10 * time.Second
+
+// Drain makes Add fail with ErrDraining, lets the printers tick for `grace`, and
+// then calls `done`, which shuts the server down. Unlike Freeze, the printers
+// are not stopped, and it can't be undone. It returns the time `done` is called at,
+// and false if the printers were already draining.
+func (p *printers) Drain(grace time.Duration, done func()) (until time.Time, started bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.drainUntil.IsZero() {
+		return p.drainUntil, false
+	}
+	p.drainUntil = p.clock.Now().Add(grace)
+	p.clock.AfterFunc(grace, done)
+	return p.drainUntil, true
+}
+
+// Draining reports whether Drain was called.
+func (p *printers) Draining() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.drainUntil.IsZero()
+}
+
+// handleDrain starts draining the printers before shutting down, see Drain, and
+// returns right away with when the server shuts down.
+func (s *server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if s.quit == nil {
+		http.Error(w, "Draining is not supported by this server", http.StatusNotImplemented)
+		return
+	}
+	until, started := s.printers.Drain(s.drainGrace, s.quit)
+	if started {
+		s.audit(r, "drain", "", map[string]string{"grace": s.drainGrace.String()})
+	}
+	writeJSON(w, r, http.StatusAccepted, struct {
+		Until time.Time `json:"until"`
+	}{until})
+}
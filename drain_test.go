@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "a", Period: 1})
+	waitTimers(t, c, 1)
+	s := newTestServer(p)
+	s.drainGrace = 10 * time.Second
+	var quit atomic.Int32
+	s.quit = func() { quit.Add(1) }
+
+	w := serve(t, s, http.MethodPost, "/api/drain", "")
+	var resp struct{ Until time.Time }
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	until := c.Now().Add(10 * time.Second)
+	if w.Code != http.StatusAccepted || !resp.Until.Equal(until) {
+		t.Errorf("status %d until %s, want 202 until %s", w.Code, resp.Until, until)
+	}
+	// Draining again doesn't push the shutdown back.
+	c.Advance(time.Second)
+	waitFor(t, "the first line", func() bool { return len(sk.Lines()) == 1 })
+	if w := serve(t, s, http.MethodPost, "/api/drain", ""); w.Code != http.StatusAccepted {
+		t.Errorf("draining again: status %d", w.Code)
+	} else if json.NewDecoder(w.Body).Decode(&resp); !resp.Until.Equal(until) {
+		t.Errorf("draining again until %s, want %s", resp.Until, until)
+	}
+
+	if w := serve(t, s, http.MethodPost, "/api/printers/bulk", `[{"name": "b", "period": 1}]`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("add while draining: status %d, want 503", w.Code)
+	}
+	// Unlike a freeze, a drain can't be undone.
+	serve(t, s, http.MethodPost, "/api/unfreeze", "")
+	if err := p.Add(spec{Name: "b", Period: 1}); !errors.Is(err, ErrDraining) {
+		t.Errorf("add after unfreezing: %v, want ErrDraining", err)
+	}
+	if st := p.Stats(); !st.Draining || st.DrainRemaining != 9 {
+		t.Errorf("draining %t with %gs left, want 9s", st.Draining, st.DrainRemaining)
+	}
+
+	// The printers keep ticking until the end of the grace period.
+	for i := 2; i <= 9; i++ {
+		tick(t, c, time.Second, sk, i)
+	}
+	if n := quit.Load(); n != 0 {
+		t.Fatalf("shut down %d times before the end of the grace", n)
+	}
+	tick(t, c, time.Second, sk, 10)
+	waitFor(t, "the shutdown", func() bool { return quit.Load() == 1 })
+	drains := 0
+	for _, e := range s.auditLog.Entries() {
+		if e.Op == "drain" {
+			drains++
+		}
+	}
+	if drains != 1 {
+		t.Errorf("%d drains in the audit log, want only the first one", drains)
+	}
+}
+
+func TestDrainUnsupported(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	// Without a way to shut down, the printers don't start draining.
+	if w := serve(t, newTestServer(p), http.MethodPost, "/api/drain", ""); w.Code != http.StatusNotImplemented {
+		t.Errorf("status %d, want 501", w.Code)
+	}
+	if p.Draining() {
+		t.Error("the printers are draining")
+	}
+}
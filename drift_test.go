@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDrift(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "a", Period: 2})
+	waitTimers(t, c, 1)
+
+	tests := []struct {
+		// How far the clock is advanced, past the tick handled.
+		advance time.Duration
+		// In seconds.
+		drift, maxDrift, maxGap float64
+	}{
+		{2 * time.Second, 0, 0, 0},
+		{2 * time.Second, 0, 0, 2},
+		// The tick due at 6s is only handled at 7s.
+		{3 * time.Second, 1, 1, 2},
+		{time.Second, 1, 1, 2},
+		{3 * time.Second, 2, 1, 2},
+		// With a period of 5s from 11s on, the next tick is at 16s.
+		{5 * time.Second, 2, 1, 6},
+	}
+	for i, tt := range tests {
+		if i == len(tests)-1 {
+			if err := p.SetPeriod("a", 5*time.Second); err != nil {
+				t.Fatal(err)
+			}
+			waitTicker(t, c, 5*time.Second)
+		}
+		tick(t, c, tt.advance, sk, i+1)
+		var info printerInfo
+		waitFor(t, "the tick", func() bool {
+			info, _ = p.Get("a")
+			return info.LastTick != nil && !info.LastTick.Before(c.Now().Add(-tt.advance))
+		})
+		if info.Drift != tt.drift || info.MaxDrift != tt.maxDrift || info.MaxGap != tt.maxGap {
+			t.Errorf("tick %d: drift %g, max %g and max gap %g, want %g, %g and %g", i+1, info.Drift, info.MaxDrift, info.MaxGap, tt.drift, tt.maxDrift, tt.maxGap)
+		}
+	}
+
+	w := serve(t, newTestServer(p), http.MethodGet, "/api/printers/a", "")
+	var got map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got["drift_seconds"] != 2.0 || got["max_drift_seconds"] != 1.0 || got["max_gap_seconds"] != 6.0 {
+		t.Errorf("got %v, want the drift in the API", got)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestDupes(t *testing.T) {
+	tests := []struct {
+		dupes string
+		// Names the printers are added with, and the number of errors.
+		added []string
+		errs  int
+	}{
+		{"reject", []string{"a"}, 2},
+		{"suffix", []string{"a", "a (2)", "a (3)"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dupes, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			s := newTestServer(p)
+			s.dupes = tt.dupes
+			w := serve(t, s, http.MethodPost, "/api/printers/bulk", `[{"name": "a", "period": 60}, {"name": "a", "period": 60}, {"name": "a", "period": 60}]`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Added  []string
+				Errors []fieldError
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(resp.Added, tt.added) || len(resp.Errors) != tt.errs {
+				t.Errorf("added %q with the errors %+v, want %q and %d errors", resp.Added, resp.Errors, tt.added, tt.errs)
+			}
+			// The text stays the one given, only the name changes.
+			for _, name := range tt.added {
+				if info, ok := p.Get(name); !ok || info.Text != "a" {
+					t.Errorf("%s has the text %q, want a", name, info.Text)
+				}
+			}
+		})
+	}
+}
+
+func TestAddSuffixed(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 60}, spec{Name: "a (2)", Period: 60})
+	// The first free number is used.
+	if name, err := p.AddSuffixed(spec{Name: "a", Period: 60}); err != nil || name != "a (3)" {
+		t.Errorf("got %q and %v, want a (3)", name, err)
+	}
+	if name, err := p.AddSuffixed(spec{Name: "b", Period: 60}); err != nil || name != "b" {
+		t.Errorf("got %q and %v, want the free name b", name, err)
+	}
+	// The name of a stopped printer is free again.
+	p.Stop("a (2)", false)
+	if name, err := p.AddSuffixed(spec{Name: "a (2)", Period: 60}); err != nil || name != "a (2)" {
+		t.Errorf("got %q and %v, want the name of the stopped printer", name, err)
+	}
+	if err := p.Add(spec{Name: "a", Period: 60}); !errors.Is(err, ErrExists) {
+		t.Errorf("got %v without suffixing, want %v", err, ErrExists)
+	}
+}
+
+func TestDupesValidation(t *testing.T) {
+	tests := []struct {
+		args  []string
+		valid bool
+	}{
+		{nil, true},
+		{[]string{"-dupes", "suffix"}, true},
+		{[]string{"-dupes", "rename"}, false},
+	}
+	for _, tt := range tests {
+		c := parseFlags(t, tt.args...)
+		if errs, _ := c.validate(); (len(errs) == 0) != tt.valid {
+			t.Errorf("%q: errors %v, want valid %t", tt.args, errs, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Number of errors kept by the error log, the oldest ones are dropped first.
+const errorLogSize = 200
+
+// errorEvent is an error that happened outside of a request, such as a failed
+// guard or a line that couldn't be written.
+type errorEvent struct {
+	Time time.Time `json:"time"`
+	// Where it happened: "printer", "output", "net" or "webhook".
+	Source string `json:"source"`
+	// Printer it is about, if any.
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+// errorLog keeps the last errors in a ring buffer, like the audit log.
+type errorLog struct {
+	clock Clock
+
+	mu     sync.Mutex
+	events []errorEvent
+	// Index of the next event to overwrite once the buffer is full.
+	next int
+}
+
+func newErrorLog(size int, clock Clock) *errorLog {
+	return &errorLog{clock: clock, events: make([]errorEvent, 0, size)}
+}
+
+// add records an error at the current time. It does nothing on a nil log.
+func (l *errorLog) add(source, name string, err error) {
+	if l == nil {
+		return
+	}
+	e := errorEvent{Time: l.clock.Now(), Source: source, Name: name, Message: err.Error()}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.events) < cap(l.events) {
+		l.events = append(l.events, e)
+		return
+	}
+	l.events[l.next] = e
+	l.next = (l.next + 1) % len(l.events)
+}
+
+// Events returns the errors, oldest first.
+func (l *errorLog) Events() []errorEvent {
+	if l == nil {
+		return []errorEvent{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := make([]errorEvent, 0, len(l.events))
+	s = append(s, l.events[l.next:]...)
+	return append(s, l.events[:l.next]...)
+}
+
+// handleErrors returns the recent errors, oldest first.
+func (s *server) handleErrors(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, s.printers.errors.Events())
+}
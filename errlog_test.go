@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorLogRing(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		want []string
+	}{
+		{"empty", 0, []string{}},
+		{"not full", 2, []string{"error 1", "error 2"}},
+		{"full", 3, []string{"error 1", "error 2", "error 3"}},
+		{"oldest dropped", 5, []string{"error 3", "error 4", "error 5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newErrorLog(3, newFakeClock())
+			for i := 1; i <= tt.n; i++ {
+				l.add("printer", "a", fmt.Errorf("error %d", i))
+			}
+			got := []string{}
+			for _, e := range l.Events() {
+				got = append(got, e.Message)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// A nil log records nothing, and has no errors.
+	var none *errorLog
+	none.add("printer", "a", errors.New("lost"))
+	if evs := none.Events(); evs == nil || len(evs) != 0 {
+		t.Errorf("got %v, want an empty list", evs)
+	}
+}
+
+func TestErrorsEndpoint(t *testing.T) {
+	c := newFakeClock()
+	errs := newErrorLog(errorLogSize, c)
+	// The lines of the printer "broken" can't be written.
+	out := newOutput(failingSink{}, realClock{}, 0)
+	out.format = "plain"
+	out.errors = errs
+	go out.run()
+	p := newPrinters(c, out)
+	p.errors = errs
+	t.Cleanup(func() {
+		p.StopAll(5 * time.Second)
+		out.Close()
+	})
+	mustAdd(t, p, spec{Name: "guarded", Period: 1, Guard: "echo no network >&2; false"}, spec{Name: "broken", Period: 1})
+	waitTimers(t, c, 2)
+	c.Advance(time.Second)
+	waitFor(t, "the errors", func() bool { return len(errs.Events()) == 2 })
+
+	w := serve(t, newTestServer(p), http.MethodGet, "/api/errors", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var got []errorEvent
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	bySource := make(map[string]errorEvent)
+	for _, e := range got {
+		bySource[e.Source] = e
+	}
+	if e := bySource["printer"]; e.Name != "guarded" || !strings.Contains(e.Message, "no network") || !e.Time.Equal(c.Now()) {
+		t.Errorf("got %+v, want the failed guard of guarded", e)
+	}
+	if e := bySource["output"]; e.Name != "broken" || !strings.Contains(e.Message, "broken pipe") {
+		t.Errorf("got %+v, want the failed write of broken", e)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPrintEvery(t *testing.T) {
+	tests := []struct {
+		name  string
+		every int
+		// The ticks printed among the first 6.
+		want []string
+	}{
+		{"unset", 0, []string{"0001 a", "0002 a", "0003 a", "0004 a", "0005 a", "0006 a"}},
+		{"every tick", 1, []string{"0001 a", "0002 a", "0003 a", "0004 a", "0005 a", "0006 a"}},
+		{"every third tick", 3, []string{"0003 a", "0006 a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClock()
+			p, sk := newTestPrinters(t, c)
+			mustAdd(t, p, spec{Name: "a", Period: 1, Every: tt.every})
+			waitTimers(t, c, 1)
+			for i := int64(1); i <= 6; i++ {
+				c.Advance(time.Second)
+				// The counter advances on every tick, printed or not.
+				waitFor(t, "the tick", func() bool {
+					info, _ := p.Get("a")
+					return info.Ticked == i
+				})
+			}
+			waitFor(t, "the lines", func() bool { return len(sk.Lines()) >= len(tt.want) })
+			time.Sleep(10 * time.Millisecond)
+			if got := sk.Lines(); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if got := p.Stats().Ticks; got != int64(len(tt.want)) {
+				t.Errorf("%d ticks printed, want %d", got, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestPrintEveryPaused(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "a", Period: 1, Every: 2})
+	waitTimers(t, c, 1)
+	// tickAndWait advances the clock by a tick, and waits for the printer to handle it.
+	tickAndWait := func() {
+		c.Advance(time.Second)
+		waitFor(t, "the tick", func() bool {
+			info, _ := p.Get("a")
+			return info.LastTick != nil && info.LastTick.Equal(c.Now())
+		})
+	}
+	tickAndWait()
+	tickAndWait()
+	if err := p.SetPaused("a", true); err != nil {
+		t.Fatal(err)
+	}
+	// The ticks skipped while paused aren't counted.
+	for i := 0; i < 3; i++ {
+		tickAndWait()
+	}
+	if err := p.SetPaused("a", false); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := p.Get("a"); info.Ticked != 2 {
+		t.Errorf("%d ticks counted, want the 2 before pausing", info.Ticked)
+	}
+	tickAndWait()
+	tickAndWait()
+	waitFor(t, "the lines", func() bool { return len(sk.Lines()) >= 2 })
+	if got := sk.Lines(); !slices.Equal(got, []string{"0002 a", "0007 a"}) {
+		t.Errorf("got %q, want the second tick and the second one after resuming", got)
+	}
+}
+
+func TestPrintEveryValidation(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`[{"name": "a", "period": 1, "printevery": 3}]`, http.StatusOK},
+		{`[{"name": "a", "period": 1, "printevery": -1}]`, http.StatusBadRequest},
+		{`[{"name": "a", "period": 1, "printevery": 1.5}]`, http.StatusBadRequest},
+		{`[{"name": "a", "period": 1, "printevery": "3"}]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			if w := serve(t, newTestServer(p), http.MethodPost, "/api/printers/bulk", tt.body); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	// The form takes it too.
+	for _, tt := range []struct {
+		every string
+		want  int
+		ok    bool
+	}{{"3", 3, true}, {"", 0, true}, {"x", 0, false}} {
+		sp, err := specFromForm(formRequest(url.Values{"text": {"a"}, "period": {"5"}, "printevery": {tt.every}}))
+		if (err == nil) != tt.ok || sp.Every != tt.want {
+			t.Errorf("printevery %q: got %d and %v, want %d", tt.every, sp.Every, err, tt.want)
+		}
+	}
+
+	p, _ := newTestPrinters(t, realClock{})
+	if err := p.Add(spec{Name: "a", Period: 5, Every: -2}); err == nil {
+		t.Error("added a printer printing every -2 ticks")
+	}
+	mustAdd(t, p, spec{Name: "a", Period: 5, Every: 3})
+	var got []struct {
+		Name  string `json:"name"`
+		Every int    `json:"printevery"`
+	}
+	if err := json.NewDecoder(serve(t, newTestServer(p), http.MethodGet, "/api/printers", "").Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Every != 3 {
+		t.Errorf("listed %+v, want printevery 3", got)
+	}
+}
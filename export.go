@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// handleExportScript returns a shell script recreating the current printers
+// through the bulk API, with one curl call per printer posting it with every
+// field, so that a printer failing to be added doesn't stop the others and no
+// body goes over the -maxbody of the server. The server to send them to defaults
+// to this one, and can be changed with TICKER_URL; TICKER_TOKEN is sent as the
+// -token of the server if set. The script exits with 1 if any printer failed.
+func (s *server) handleExportScript(w http.ResponseWriter, r *http.Request) {
+	// The shadow printers are posted after their source. The running printers
+	// can't mirror each other in a cycle.
+	sorted, _ := sortMirrors(s.printers.Specs())
+	lines := make([]string, len(sorted))
+	for i, sp := range sorted {
+		body, err := json.Marshal([]spec{sp})
+		if err != nil {
+			requestLogger(r).Error("encoding the printers", "err", err)
+			http.Error(w, "Error encoding the printers", http.StatusInternalServerError)
+			return
+		}
+		lines[i] = "add " + shellQuote(sp.Name) + " " + shellQuote(string(body))
+	}
+	w.Header().Set("Content-Type", "text/x-shellscript; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="export.sh"`)
+
+	fmt.Fprintln(w, "#!/bin/sh")
+	fmt.Fprintf(w, "url=${TICKER_URL:-%s}\n", shellQuote("http://"+r.Host+s.basePath+"/"))
+	fmt.Fprintln(w, "status=0")
+	// The bulk API answers 200 with the errors of the printers it didn't add.
+	fmt.Fprintln(w, `# add posts the printer $1 from its spec $2, and reports if it wasn't added.
+add() {
+	if ! resp=$(curl -fsS -H 'Content-Type: application/json' ${TICKER_TOKEN:+-H "Authorization: Bearer $TICKER_TOKEN"} --data-binary "$2" "${url%/}/api/printers/bulk" 2>&1) ||
+		case $resp in *'"errors"'*) true ;; *) false ;; esac; then
+		echo "Failed to add printer $1: $resp" >&2
+		status=1
+	fi
+}`)
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+	fmt.Fprintln(w, `exit $status`)
+}
+
+// shellQuote quotes s for a POSIX shell, in single quotes so that nothing in it
+// is expanded.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", "''"},
+		{"plain", "'plain'"},
+		{"with space", "'with space'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME `id` \"q\"", "'$HOME `id` \"q\"'"},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// replay runs the script exporting the printers of `from` against the server
+// `to`, and returns what it printed.
+func replay(t *testing.T, from *printers, to *server) ([]byte, error) {
+	t.Helper()
+	for _, tool := range []string{"sh", "curl"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s isn't installed", tool)
+		}
+	}
+	w := serve(t, newTestServer(from), http.MethodGet, "/api/export.sh", "")
+	script := filepath.Join(t.TempDir(), "export.sh")
+	if err := os.WriteFile(script, w.Body.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("sh", "-n", script).CombinedOutput(); err != nil {
+		t.Fatalf("invalid script: %v: %s", err, out)
+	}
+	ts := httptest.NewServer(to.routes())
+	defer ts.Close()
+	cmd := exec.Command("sh", script)
+	cmd.Env = append(os.Environ(), "TICKER_URL="+ts.URL+"/")
+	return cmd.CombinedOutput()
+}
+
+func TestExportScriptReplays(t *testing.T) {
+	tricky := "it's \"$HOME\" `id` \\ done"
+	from, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, from,
+		spec{Name: tricky, Period: 5, Color: "#123456"},
+		spec{Name: "svc", Period: 60, Text: "the service", Fields: map[string]string{"status": "ok"}, Pinned: true},
+		spec{Name: "shadow", Mirror: "svc"},
+	)
+	to, _ := newTestPrinters(t, realClock{})
+	if out, err := replay(t, from, newTestServer(to)); err != nil {
+		t.Fatalf("running the script: %v: %s", err, out)
+	}
+
+	want, got := from.Specs(), to.Specs()
+	if len(got) != len(want) {
+		t.Fatalf("replayed %+v, want %+v", got, want)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Name != w.Name || g.Period != w.Period || g.Color != w.Color || g.Text != w.Text || g.Mirror != w.Mirror || g.Pinned != w.Pinned || g.Fields["status"] != w.Fields["status"] {
+			t.Errorf("replayed %+v, want %+v", g, w)
+		}
+	}
+}
+
+func TestExportScriptPerPrinter(t *testing.T) {
+	from, _ := newTestPrinters(t, realClock{})
+	for i := 0; i < 100; i++ {
+		mustAdd(t, from, spec{Name: fmt.Sprintf("p-%d", i), Period: 60, Text: strings.Repeat("x", 100)})
+	}
+	to, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, to, spec{Name: "p-1", Period: 5})
+	s := newTestServer(to)
+	// All of them together are larger than the limit, each one isn't.
+	s.maxBody = 1024
+
+	out, err := replay(t, from, s)
+	if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != 1 {
+		t.Fatalf("got %v: %s, want the exit code 1 for the printer that exists", err, out)
+	}
+	if !strings.Contains(string(out), "Failed to add printer p-1: ") || !strings.Contains(string(out), "printer already exists") || strings.Count(string(out), "Failed to add") != 1 {
+		t.Errorf("got %s, want p-1 reported only", out)
+	}
+	if n := len(to.List()); n != 100 {
+		t.Errorf("%d printers replayed, want 100", n)
+	}
+	if info, _ := to.Get("p-1"); info.Period != 5 {
+		t.Errorf("the existing p-1 has the period %d, want it unchanged", info.Period)
+	}
+}
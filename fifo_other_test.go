@@ -0,0 +1,98 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// mkfifo returns the path of a new FIFO.
+func mkfifo(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ticks")
+	if err := syscall.Mkfifo(path, 0o600); err != nil {
+		t.Skipf("can't create a FIFO: %s", err)
+	}
+	return path
+}
+
+func TestOpenOutFIFO(t *testing.T) {
+	withColors(t)
+	path := mkfifo(t)
+	lines := make(chan []string, 1)
+	go func() {
+		f, err := os.Open(path)
+		if err != nil {
+			lines <- nil
+			return
+		}
+		defer f.Close()
+		var got []string
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			got = append(got, sc.Text())
+		}
+		lines <- got
+	}()
+
+	f, err := openOut(path, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Like a file, the FIFO gets the lines without colors.
+	sk := writerSink{w: f}
+	for _, name := range []string{"a", "b"} {
+		if err := printWithTime(sk, line{name: name, color: "#FF8800"}, "ansi", nil, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+	select {
+	case got := <-lines:
+		if strings.Join(got, "|") != "0000 a|0000 b" {
+			t.Errorf("read %q, want the plain lines", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the reader got nothing")
+	}
+}
+
+func TestOpenOutFIFONoReader(t *testing.T) {
+	path := mkfifo(t)
+	start := time.Now()
+	_, err := openOut(path, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "no process opened the FIFO") {
+		t.Errorf("got %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("gave up after %s, want 50ms", elapsed)
+	}
+	// A reader coming late meets the open that was given up on, which then closes
+	// the FIFO rather than leaving it open forever: the reader gets EOF.
+	read := make(chan error, 1)
+	go func() {
+		r, err := os.Open(path)
+		if err != nil {
+			read <- err
+			return
+		}
+		defer r.Close()
+		_, err = r.Read(make([]byte, 1))
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		if err != io.EOF {
+			t.Errorf("the late reader got %v, want EOF", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the FIFO was left open")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// printerFlags collects the printers given with repeated `-printer name:period` flags.
+// A printer given without a period has a period of 0, to be replaced by the default one.
+type printerFlags []spec
+
+func (f *printerFlags) String() string {
+	var s []string
+	for _, sp := range *f {
+		if sp.Period == 0 {
+			s = append(s, sp.Name)
+			continue
+		}
+		s = append(s, fmt.Sprintf("%s:%d", sp.Name, sp.Period))
+	}
+	return strings.Join(s, ",")
+}
+
+// Set parses one `name:period` or `name` entry. The period is after the last colon,
+// so names containing colons need an explicit period. It is parsed by parsePeriod.
+func (f *printerFlags) Set(v string) error {
+	i := strings.LastIndex(v, ":")
+	if i < 0 {
+		if v == "" {
+			return errors.New("empty name")
+		}
+		*f = append(*f, spec{Name: v})
+		return nil
+	}
+	name, rawPeriod := v[:i], v[i+1:]
+	if name == "" {
+		return errors.New("empty name")
+	}
+	period, err := parsePeriod(rawPeriod)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, spec{Name: name, Period: int(period / time.Second)})
+	return nil
+}
+
+// Address served on when -http isn't given.
+const defaultListen = ":8080"
+
+// listenAddr is an address to serve on, and whether its listener only allows reads.
+type listenAddr struct {
+	addr     string
+	readOnly bool
+}
+
+func (a listenAddr) String() string {
+	if a.readOnly {
+		return a.addr + "=readonly"
+	}
+	return a.addr
+}
+
+// listenFlags collects the addresses given with repeated `-http addr` or
+// `-http addr=readonly` flags, each served by its own listener.
+type listenFlags []listenAddr
+
+func (f *listenFlags) String() string {
+	var s []string
+	for _, a := range *f {
+		s = append(s, a.String())
+	}
+	return strings.Join(s, ",")
+}
+
+// Set parses one `addr` or `addr=readonly` entry.
+func (f *listenFlags) Set(v string) error {
+	addr, mode, hasMode := strings.Cut(v, "=")
+	if addr == "" {
+		return errors.New("empty address")
+	}
+	if hasMode && mode != "readonly" {
+		return fmt.Errorf("unknown mode %q, expected readonly", mode)
+	}
+	*f = append(*f, listenAddr{addr: addr, readOnly: hasMode})
+	return nil
+}
+
+// MarshalJSON writes the addresses like the flags take them.
+func (f listenFlags) MarshalJSON() ([]byte, error) {
+	s := make([]string, len(f))
+	for i, a := range f {
+		s[i] = a.String()
+	}
+	return json.Marshal(s)
+}
+
+// colorRule gives the printers whose name matches a pattern a color.
+type colorRule struct {
+	re    *regexp.Regexp
+	color string
+}
+
+// colorRules collects the rules given with repeated `-colorrules pattern=#RRGGBB`
+// flags, in order.
+type colorRules []colorRule
+
+func (c *colorRules) String() string {
+	var s []string
+	for _, r := range *c {
+		s = append(s, r.re.String()+"="+r.color)
+	}
+	return strings.Join(s, ",")
+}
+
+// Set parses one `pattern=#RRGGBB` rule. The color is after the last equal sign,
+// so patterns can contain some.
+func (c *colorRules) Set(v string) error {
+	i := strings.LastIndex(v, "=")
+	if i < 0 {
+		return errors.New("expected pattern=#RRGGBB")
+	}
+	pattern, color := v[:i], v[i+1:]
+	if !colorRe.MatchString(color) {
+		return fmt.Errorf("invalid color %q: expected #RRGGBB", color)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	*c = append(*c, colorRule{re: re, color: color})
+	return nil
+}
+
+// color returns the color of the first rule matching the name, or the one
+// derived from the name if none does.
+func (c colorRules) color(name string) string {
+	for _, r := range c {
+		if r.re.MatchString(name) {
+			return r.color
+		}
+	}
+	return stringToColor(name)
+}
+
+// MarshalJSON writes the rules as they are given to the flag, for the configuration.
+func (c colorRules) MarshalJSON() ([]byte, error) {
+	s := make([]string, len(c))
+	for i, r := range c {
+		s[i] = r.re.String() + "=" + r.color
+	}
+	return json.Marshal(s)
+}
+
+// namedSink is a destination given with -sink, that printers can write to instead
+// of the default ones.
+type namedSink struct {
+	name string
+	// "stdout", "stderr", tcp://host:port, udp://host:port or the path of a file.
+	target string
+}
+
+// sinkFlags collects the destinations given with repeated `-sink name=target`
+// flags, in order.
+type sinkFlags []namedSink
+
+func (f *sinkFlags) String() string {
+	var s []string
+	for _, ns := range *f {
+		s = append(s, ns.name+"="+ns.target)
+	}
+	return strings.Join(s, ",")
+}
+
+// Set parses one `name=target` destination. The name is before the first equal
+// sign, so targets can contain some.
+func (f *sinkFlags) Set(v string) error {
+	name, target, ok := strings.Cut(v, "=")
+	if !ok || name == "" || target == "" {
+		return errors.New("expected name=target")
+	}
+	if err := validateName(name); err != nil {
+		return fmt.Errorf("invalid name: %w", err)
+	}
+	for _, ns := range *f {
+		if ns.name == name {
+			return fmt.Errorf("the sink %q is given twice", name)
+		}
+	}
+	if strings.Contains(target, "://") {
+		if _, _, err := parseNetAddr(target); err != nil {
+			return err
+		}
+	}
+	*f = append(*f, namedSink{name: name, target: target})
+	return nil
+}
+
+// MarshalJSON writes the destinations as they are given to the flag, for the configuration.
+func (f sinkFlags) MarshalJSON() ([]byte, error) {
+	s := make([]string, len(f))
+	for i, ns := range f {
+		s[i] = ns.name + "=" + ns.target
+	}
+	return json.Marshal(s)
+}
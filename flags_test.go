@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPrinterFlags(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    spec
+		wantErr bool
+	}{
+		{in: "foo:5", want: spec{Name: "foo", Period: 5}},
+		{in: "foo:2m", want: spec{Name: "foo", Period: 120}},
+		{in: "foo", want: spec{Name: "foo"}},
+		{in: "a:b:10", want: spec{Name: "a:b", Period: 10}},
+		{in: "", wantErr: true},
+		{in: ":5", wantErr: true},
+		{in: "foo:", wantErr: true},
+		{in: "foo:0", wantErr: true},
+		{in: "foo:-3", wantErr: true},
+		{in: "foo:1.5s", wantErr: true},
+		{in: "foo:often", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var f printerFlags
+			err := f.Set(tt.in)
+			if tt.wantErr {
+				if err == nil || len(f) != 0 {
+					t.Errorf("got %+v, want an error", f)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f) != 1 || f[0].Name != tt.want.Name || f[0].Period != tt.want.Period {
+				t.Errorf("got %+v, want %+v", f, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrinterFlagsRepeated(t *testing.T) {
+	var f printerFlags
+	fs := flag.NewFlagSet("ticker-printer", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(&f, "printer", "")
+	if err := fs.Parse([]string{"-printer", "foo:5", "-printer", "bar:10"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.String(); got != "foo:5,bar:10" {
+		t.Errorf("String is %q", got)
+	}
+	if err := fs.Parse([]string{"-printer", "bad:x"}); err == nil {
+		t.Error("a malformed printer was accepted")
+	}
+}
+
+func TestDemo(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []printerInfo
+	}{
+		{"off", nil, []printerInfo{}},
+		{"on", []string{"-demo"}, []printerInfo{
+			{Name: "ping", Period: 5, Color: "#AFFF5F"},
+			{Name: "tick", Period: 1, Color: "#FF5F87"},
+			{Name: "tock", Period: 2, Color: "#5FD7FF"},
+		}},
+		{"with -printer", []string{"-demo", "-printer", "mine:7", "-printer", "tick:3"}, []printerInfo{
+			{Name: "mine", Period: 7},
+			{Name: "ping", Period: 5},
+			// Given first, the printer of -printer wins.
+			{Name: "tick", Period: 3},
+			{Name: "tock", Period: 2},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := parseFlags(t, tt.args...)
+			specs, _, err := startupSpecs(&c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, _ := newTestPrinters(t, realClock{})
+			p.addStartup(specs, c.DefaultPeriod)
+			got := p.List()
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d printers, want %d", len(got), len(tt.want))
+			}
+			for i, info := range got {
+				w := tt.want[i]
+				if info.Name != w.Name || info.Period != w.Period || (w.Color != "" && info.Color != w.Color) {
+					t.Errorf("printer %d is %s every %ds in %s, want %+v", i, info.Name, info.Period, info.Color, w)
+				}
+			}
+		})
+	}
+}
+
+func TestDemoPrintersStop(t *testing.T) {
+	c := parseFlags(t, "-demo")
+	specs, _, _ := startupSpecs(&c)
+	p, _ := newTestPrinters(t, realClock{})
+	p.addStartup(specs, c.DefaultPeriod)
+	// They are not part of the configuration, but are stopped like any other.
+	if len(c.Printers) != 0 {
+		t.Errorf("-demo added %d printers to the configuration", len(c.Printers))
+	}
+	if w := serve(t, newTestServer(p), http.MethodDelete, "/api/printers/tick", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("status %d", w.Code)
+	}
+	waitFor(t, "tick to stop", func() bool { _, ok := p.Get("tick"); return !ok })
+	if n := len(p.List()); n != 2 {
+		t.Errorf("%d printers left, want tock and ping", n)
+	}
+}
+
+func TestStartupImport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "printers.txt")
+	if err := os.WriteFile(path, []byte("a 5\nb\nbad soon\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := parseFlags(t, "-import", path, "-defaultperiod", "9")
+	specs, warnings, err := startupSpecs(&c)
+	if err != nil || len(warnings) != 1 {
+		t.Fatalf("got the warnings %v and %v, want one warning", warnings, err)
+	}
+	p, _ := newTestPrinters(t, realClock{})
+	p.addStartup(specs, c.DefaultPeriod)
+	if a, _ := p.Get("a"); a.Period != 5 {
+		t.Errorf("a has the period %d, want 5", a.Period)
+	}
+	if b, _ := p.Get("b"); b.Period != 9 {
+		t.Errorf("b has the period %d, want the default one", b.Period)
+	}
+	c = parseFlags(t, "-import", filepath.Join(t.TempDir(), "missing.txt"))
+	if _, _, err := startupSpecs(&c); err == nil {
+		t.Error("a missing import file was accepted")
+	}
+}
+
+func TestColorRules(t *testing.T) {
+	c := parseFlags(t, "-colorrules", "^err.*=#FF0000", "-colorrules", "^e=#00FF00", "-colorrules", "a=b=#0000FF")
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"error", "#FF0000"},
+		// The first matching rule wins.
+		{"err", "#FF0000"},
+		{"echo", "#00FF00"},
+		{"xa=b", "#0000FF"},
+		{"web", stringToColor("web")},
+		{"", stringToColor("")},
+	}
+	for _, tt := range tests {
+		if got := c.ColorRules.color(tt.name); got != tt.want {
+			t.Errorf("color(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if got := c.ColorRules.String(); got != "^err.*=#FF0000,^e=#00FF00,a=b=#0000FF" {
+		t.Errorf("String() = %q", got)
+	}
+
+	for _, v := range []string{"err", "err=red", "err=#FF00", "(err=#FF0000"} {
+		var rules colorRules
+		if err := rules.Set(v); err == nil || len(rules) != 0 {
+			t.Errorf("%q was accepted", v)
+		}
+	}
+}
+
+func TestColorRulesAdd(t *testing.T) {
+	c := parseFlags(t, "-colorrules", "^err=#FF0000")
+	p, _ := newTestPrinters(t, realClock{})
+	p.colorRules = c.ColorRules
+	mustAdd(t, p, spec{Name: "errors", Period: 60}, spec{Name: "error-blue", Period: 60, Color: "#0000FF"}, spec{Name: "web", Period: 60})
+	tests := []struct {
+		name, want string
+		// Whether the color is kept in the specs, as chosen rather than derived.
+		kept bool
+	}{
+		{"errors", "#FF0000", false},
+		{"error-blue", "#0000FF", true},
+		{"web", stringToColor("web"), false},
+	}
+	specs := p.Specs()
+	for _, tt := range tests {
+		if info, _ := p.Get(tt.name); info.Color != tt.want {
+			t.Errorf("%s has the color %s, want %s", tt.name, info.Color, tt.want)
+		}
+		i := slices.IndexFunc(specs, func(sp spec) bool { return sp.Name == tt.name })
+		if kept := specs[i].Color != ""; kept != tt.kept {
+			t.Errorf("%s: color %q in the specs, want it kept %t", tt.name, specs[i].Color, tt.kept)
+		}
+	}
+}
@@ -47,7 +47,7 @@
               # To begin with it is recommended to set this, but one must
               # remember to bump this hash when your dependencies change.
               # vendorSha256 = pkgs.lib.fakeSha256;
-              vendorSha256 = "sha256-vYfzRcBGa/a7FhCnYo9oPQgZFFJqbTLRU2pv2nFsMSI=";
+              vendorSha256 = "sha256-Pm5CU4uIx7vYYyiNJ77nlT60RJfAgzAwdUGnvt4N6Vw=";
               CGO_ENABLED = 0;
             };
 
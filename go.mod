@@ -1,10 +1,15 @@
 module github.com/lucas-deangelis/ticker-printer
 
-go 1.21.3
+go 1.22
 
-require zgo.at/zli v0.0.0-20231124215953-c6675b0b020a
+require (
+	github.com/robfig/cron/v3 v3.0.1
+	golang.org/x/net v0.30.0
+	golang.org/x/sys v0.26.0
+	zgo.at/zli v0.0.0-20231124215953-c6675b0b020a
+)
 
 require (
-	golang.org/x/sys v0.14.0 // indirect
-	golang.org/x/term v0.14.0 // indirect
+	golang.org/x/term v0.25.0 // indirect
+	golang.org/x/text v0.19.0 // indirect
 )
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Maximum time a guard command may run before being killed.
+const guardTimeout = 5 * time.Second
+
+// runGuard runs the guard command through the shell and returns nil if it exited with 0.
+// Otherwise the error includes what the command wrote on stderr, if anything.
+func runGuard(guard string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), guardTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", guard)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("guard timed out after %s", guardTimeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("guard: %w: %s", err, msg)
+		}
+		return fmt.Errorf("guard: %w", err)
+	}
+	return nil
+}
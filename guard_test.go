@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunGuard(t *testing.T) {
+	tests := []struct {
+		guard   string
+		wantErr string
+	}{
+		{"true", ""},
+		{"exit 0", ""},
+		{"false", "exit status 1"},
+		{"echo nope >&2; exit 3", "exit status 3: nope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.guard, func(t *testing.T) {
+			err := runGuard(tt.guard)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("got %v, want no error", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got %v, want an error with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGuardedPrinters(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "yes", Period: 1, Guard: "true"}, spec{Name: "no", Period: 1, Guard: "false"})
+	waitTimers(t, c, 2)
+
+	tick(t, c, time.Second, sk, 1)
+	waitFor(t, "the failed guard", func() bool {
+		info, _ := p.Get("no")
+		return info.Error != ""
+	})
+	if got := sk.Lines(); len(got) != 1 || got[0] != "0001 yes" {
+		t.Errorf("got %q, want only the printer whose guard succeeded", got)
+	}
+	if info, _ := p.Get("yes"); info.Error != "" {
+		t.Errorf("the succeeding guard has the error %q", info.Error)
+	}
+}
+
+func TestGuardNeedsAllowExec(t *testing.T) {
+	for _, allow := range []bool{false, true} {
+		withConfig(t, config{AllowExec: allow})
+		p, _ := newTestPrinters(t, realClock{})
+		w := serve(t, newTestServer(p), http.MethodPost, "/api/printers/bulk", `[{"name": "g", "period": 60, "guard": "true"}]`)
+		want := http.StatusForbidden
+		if allow {
+			want = http.StatusOK
+		}
+		if w.Code != want {
+			t.Errorf("with allow-exec %t: status %d, want %d", allow, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip", true},
+		{"gzip;q=0.5", true},
+		{"gzip; q=1", true},
+		{"gzip;q=0", false},
+		{"gzip;q=0.0", false},
+		{"br", false},
+		{"x-gzip", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", tt.header)
+		if got := acceptsGzip(r); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %t, want %t", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGzip(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	for i := range 50 {
+		mustAdd(t, p, spec{Name: fmt.Sprint("printer-", i), Period: 60})
+	}
+	mustAdd(t, p, spec{Name: "a", Period: 60})
+	s := newTestServer(p)
+	s.gzip = true
+	var want []printerInfo
+	if err := json.NewDecoder(serve(t, s, http.MethodGet, "/api/printers", "").Body).Decode(&want); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		gzip     bool
+		target   string
+		accept   string
+		wantGzip bool
+	}{
+		{"accepted", true, "/api/printers", "gzip", true},
+		{"not accepted", true, "/api/printers", "", false},
+		{"refused", true, "/api/printers", "gzip;q=0", false},
+		{"too small", true, "/api/printers/a", "gzip", false},
+		{"disabled", false, "/api/printers", "gzip", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.gzip = tt.gzip
+			w := serve(t, s, http.MethodGet, tt.target, "", "Accept-Encoding", tt.accept)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d", w.Code)
+			}
+			if got := w.Header().Get("Content-Encoding") == "gzip"; got != tt.wantGzip {
+				t.Fatalf("compressed %t, want %t", got, tt.wantGzip)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Errorf("content type %q", ct)
+			}
+			if tt.gzip && w.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Vary %q, want Accept-Encoding", w.Header().Get("Vary"))
+			}
+			var body io.Reader = w.Body
+			if tt.wantGzip {
+				gz, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gz
+			}
+			if tt.target != "/api/printers" {
+				return
+			}
+			var got []printerInfo
+			if err := json.NewDecoder(body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(want) || got[0].Name != want[0].Name {
+				t.Errorf("got %d printers, want %d", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestGzipSkipsStreams(t *testing.T) {
+	large := strings.Repeat("x", 2*gzipMinSize)
+	tests := []struct {
+		contentType string
+		wantGzip    bool
+	}{
+		{"text/csv", true},
+		{"text/html; charset=utf-8", true},
+		{"text/event-stream", false},
+		{"application/octet-stream", false},
+		{"image/png", false},
+	}
+	for _, tt := range tests {
+		h := withGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			io.WriteString(w, large)
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got := w.Header().Get("Content-Encoding") == "gzip"; got != tt.wantGzip {
+			t.Errorf("%s: compressed %t, want %t", tt.contentType, got, tt.wantGzip)
+		}
+		if !tt.wantGzip && w.Body.String() != large {
+			t.Errorf("%s: the body changed", tt.contentType)
+		}
+	}
+}
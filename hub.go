@@ -0,0 +1,123 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tickEvent is a line printed by a printer on a tick, as passed to the subscribers.
+type tickEvent struct {
+	// Position of the event among all the events published, starting at 1.
+	Seq int64 `json:"seq"`
+	// Name of the printer, and what it printed.
+	Name string    `json:"name"`
+	Text string    `json:"text"`
+	Time time.Time `json:"time"`
+}
+
+// subscriber receives the tick events on C. The events that don't fit in C
+// are dropped rather than blocking the printers, and counted.
+type subscriber struct {
+	C chan tickEvent
+	// Only receives the ticks of this printer, or of all of them if empty.
+	name    string
+	dropped atomic.Int64
+}
+
+// Number of the last events kept for the long polls.
+const hubRecent = 256
+
+// hub passes the tick events of the printers to their subscribers.
+type hub struct {
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+	// Sequence number of the last event.
+	seq int64
+	// Last events, for the long polls, with the index of the next one to
+	// overwrite once the buffer is full.
+	recent []tickEvent
+	next   int
+	// Closed and replaced on each event, to wake up the long polls.
+	published chan struct{}
+	// Events dropped for all the subscribers, including the ones that are gone.
+	dropped atomic.Int64
+}
+
+func newHub() *hub {
+	return &hub{
+		subs:      make(map[*subscriber]struct{}),
+		recent:    make([]tickEvent, 0, hubRecent),
+		published: make(chan struct{}),
+	}
+}
+
+// subscribe returns a subscriber to the ticks of the printer `name`, or of every
+// printer if `name` is empty, with room for `size` events. It must be passed
+// to unsubscribe once done.
+func (h *hub) subscribe(name string, size int) *subscriber {
+	sub := &subscriber{C: make(chan tickEvent, size), name: name}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe stops sending events to the subscriber. Its channel isn't closed,
+// so that a publish in progress never sends on a closed channel.
+func (h *hub) unsubscribe(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, sub)
+}
+
+// publish sends an event to the subscribers of its printer without blocking, so
+// that a slow subscriber can't stall the printer: the events that don't fit in
+// its channel are dropped for it and counted.
+func (h *hub) publish(ev tickEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ev.Seq = h.seq
+	if len(h.recent) < cap(h.recent) {
+		h.recent = append(h.recent, ev)
+	} else {
+		h.recent[h.next] = ev
+		h.next = (h.next + 1) % len(h.recent)
+	}
+	close(h.published)
+	h.published = make(chan struct{})
+
+	for sub := range h.subs {
+		if sub.name != "" && sub.name != ev.Name {
+			continue
+		}
+		select {
+		case sub.C <- ev:
+		default:
+			sub.dropped.Add(1)
+			h.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped returns the number of events dropped for all the subscribers.
+func (h *hub) Dropped() int64 {
+	return h.dropped.Load()
+}
+
+// since returns the events kept after the sequence number `seq`, oldest first,
+// and the sequence number of the last event. If there are none, the returned
+// channel is closed on the next event.
+func (h *hub) since(seq int64) ([]tickEvent, int64, <-chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var evs []tickEvent
+	for _, ev := range slices.Concat(h.recent[h.next:], h.recent[:h.next]) {
+		if ev.Seq > seq {
+			evs = append(evs, ev)
+		}
+	}
+	return evs, h.seq, h.published
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHubPublish(t *testing.T) {
+	h := newHub()
+	all := h.subscribe("", 10)
+	onlyA := h.subscribe("a", 10)
+	// Never read, with room for a single event.
+	slow := h.subscribe("", 1)
+	gone := h.subscribe("", 10)
+	h.unsubscribe(gone)
+
+	for _, name := range []string{"a", "b", "a"} {
+		h.publish(tickEvent{Name: name})
+	}
+	tests := []struct {
+		name    string
+		sub     *subscriber
+		events  int
+		dropped int64
+	}{
+		{"all", all, 3, 0},
+		{"only a", onlyA, 2, 0},
+		{"slow", slow, 1, 2},
+		{"unsubscribed", gone, 0, 0},
+	}
+	for _, tt := range tests {
+		if n := len(tt.sub.C); n != tt.events || tt.sub.dropped.Load() != tt.dropped {
+			t.Errorf("%s: %d events and %d dropped, want %d and %d", tt.name, n, tt.sub.dropped.Load(), tt.events, tt.dropped)
+		}
+	}
+	if n := h.Dropped(); n != 2 {
+		t.Errorf("%d events dropped in all, want 2", n)
+	}
+	// The events are numbered in the order they were published.
+	for i := int64(1); i <= 3; i++ {
+		if ev := <-all.C; ev.Seq != i {
+			t.Errorf("got the event %d, want %d", ev.Seq, i)
+		}
+	}
+}
+
+func TestHubRecent(t *testing.T) {
+	h := newHub()
+	for range hubRecent + 10 {
+		h.publish(tickEvent{Name: "a"})
+	}
+	evs, seq, _ := h.since(0)
+	if len(evs) != hubRecent || evs[0].Seq != 11 || seq != hubRecent+10 {
+		t.Errorf("got %d events from %d up to %d, want the last %d", len(evs), evs[0].Seq, seq, hubRecent)
+	}
+	if evs, _, _ := h.since(hubRecent + 8); len(evs) != 2 {
+		t.Errorf("got %d events after %d, want 2", len(evs), hubRecent+8)
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	// Subscribed to every printer, and never read.
+	p.hub.subscribe("", 1)
+	mustAdd(t, p, spec{Name: "a", Period: 1}, spec{Name: "b", Period: 1})
+	waitTimers(t, c, 2)
+
+	// The printers keep printing while the subscriber is full.
+	for i := 1; i <= 5; i++ {
+		tick(t, c, time.Second, sk, 2*i)
+	}
+	// The lines are printed before the events are published.
+	waitFor(t, "the drops", func() bool { return p.Stats().SubscriberDropped == 9 })
+	var st struct {
+		Dropped int64 `json:"subscriber_events_dropped_total"`
+	}
+	if err := json.NewDecoder(serve(t, newTestServer(p), http.MethodGet, "/api/stats", "").Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Dropped != 9 {
+		t.Errorf("%d events dropped in the stats, want all but the first", st.Dropped)
+	}
+}
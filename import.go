@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// loadImport reads the printers of the text file of -import.
+func loadImport(path string) ([]spec, []error, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return parseImport(f)
+}
+
+// parseImport reads one printer per line, as its name and optionally its period,
+// separated by spaces or tabs. The period is the rest of the line, parsed by
+// parsePeriod so that phrases such as "every 5 minutes" work, and a printer
+// without one has a period of 0, to be replaced by the default one. Blank lines
+// are skipped, and so is what follows a "#" starting a word. The lines that can't
+// be parsed are skipped too, and returned as warnings with their line number.
+func parseImport(r io.Reader) ([]spec, []error, error) {
+	var specs []spec
+	var warnings []error
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		words := strings.Fields(sc.Text())
+		for i, w := range words {
+			if strings.HasPrefix(w, "#") {
+				words = words[:i]
+				break
+			}
+		}
+
+		if len(words) == 0 {
+			continue
+		}
+		sp := spec{Name: words[0]}
+		if err := validateName(sp.Name); err != nil {
+			warnings = append(warnings, fmt.Errorf("line %d: invalid name: %w", n, err))
+			continue
+		}
+		if len(words) > 1 {
+			period, err := parsePeriod(strings.Join(words[1:], " "))
+			if err != nil {
+				warnings = append(warnings, fmt.Errorf("line %d: %w", n, err))
+				continue
+			}
+			sp.Period = int(period / time.Second)
+		}
+		specs = append(specs, sp)
+	}
+	return specs, warnings, sc.Err()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseImport(t *testing.T) {
+	in := strings.Join([]string{
+		"# printers of the demo",
+		"",
+		"tick 1",
+		"  tock\t5s  ",
+		"slow every 5 minutes # the period is a phrase",
+		"default",
+		"bad soon",
+		"# a comment",
+		"\t",
+		"half 1.5s",
+		"last 10#not a comment",
+	}, "\n")
+	specs, warnings, err := parseImport(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []spec{{Name: "tick", Period: 1}, {Name: "tock", Period: 5}, {Name: "slow", Period: 300}, {Name: "default"}}
+	if len(specs) != len(want) {
+		t.Fatalf("got %+v, want %+v", specs, want)
+	}
+	for i, sp := range specs {
+		if sp.Name != want[i].Name || sp.Period != want[i].Period {
+			t.Errorf("printer %d is %+v, want %+v", i, sp, want[i])
+		}
+	}
+	wantWarnings := []string{"line 7: invalid period", "line 10:", "line 11: invalid period"}
+	if len(warnings) != len(wantWarnings) {
+		t.Fatalf("got the warnings %v, want %q", warnings, wantWarnings)
+	}
+	for i, w := range warnings {
+		if !strings.HasPrefix(w.Error(), wantWarnings[i]) {
+			t.Errorf("warning %d is %q, want it to start with %q", i, w, wantWarnings[i])
+		}
+	}
+}
+
+func TestParseImportInvalidName(t *testing.T) {
+	specs, warnings, err := parseImport(strings.NewReader("ok 1\n\x1b[2J 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 1 || len(warnings) != 1 || !strings.HasPrefix(warnings[0].Error(), "line 2: invalid name") {
+		t.Errorf("got %+v and %v, want ok and a warning for line 2", specs, warnings)
+	}
+}
+
+func TestLoadImport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "printers.txt")
+	if err := os.WriteFile(path, []byte("a 1\nb 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if specs, _, err := loadImport(path); err != nil || len(specs) != 2 {
+		t.Errorf("got %+v and %v, want a and b", specs, err)
+	}
+	if _, _, err := loadImport(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("a missing file was loaded")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLast(t *testing.T) {
+	c := newFakeClock()
+	start := c.Now()
+	p, _ := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "a", Period: 1})
+	waitTimers(t, c, 1)
+	s := newTestServer(p)
+
+	last := func() (*string, *time.Time) {
+		t.Helper()
+		w := serve(t, s, http.MethodGet, "/api/last/a", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var got lastLine
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got.Line, got.Time
+	}
+	if line, at := last(); line != nil || at != nil {
+		t.Errorf("got %v at %v before any tick, want null values", line, at)
+	}
+
+	tests := []struct {
+		name string
+		// Applied before the tick.
+		change func()
+		want   string
+		// Seconds since the start of the last line.
+		at int
+	}{
+		{"first tick", func() {}, "0001 a", 1},
+		{"second tick", func() {}, "0002 a", 2},
+		{"new text", func() { p.SetText("a", "renamed") }, "0003 renamed", 3},
+		// A paused printer prints nothing, the last line stays.
+		{"paused", func() { p.SetPaused("a", true) }, "0003 renamed", 3},
+	}
+	for _, tt := range tests {
+		tt.change()
+		c.Advance(time.Second)
+		waitFor(t, "the tick", func() bool {
+			info, _ := p.Get("a")
+			l, _ := p.Last("a")
+			return info.LastTick != nil && info.LastTick.Equal(c.Now()) && l.Line != nil && *l.Line == tt.want
+		})
+		line, at := last()
+		if line == nil || *line != tt.want || !at.Equal(start.Add(time.Duration(tt.at)*time.Second)) {
+			t.Errorf("%s: got %v at %v, want %q at %ds", tt.name, line, at, tt.want, tt.at)
+		}
+	}
+
+	if w := serve(t, s, http.MethodGet, "/api/last/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("status %d for a missing printer, want 404", w.Code)
+	}
+}
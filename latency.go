@@ -0,0 +1,94 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Number of the last write durations kept per printer to compute the quantiles.
+const latencySamples = 256
+
+// latencySummary is what the stats report of the write durations of a printer.
+type latencySummary struct {
+	Count int64   `json:"count"`
+	P50   float64 `json:"p50_seconds"`
+	P99   float64 `json:"p99_seconds"`
+}
+
+// reservoir keeps the last `latencySamples` durations in a ring buffer.
+type reservoir struct {
+	samples []time.Duration
+	next    int
+	count   int64
+}
+
+func (r *reservoir) add(d time.Duration) {
+	r.count++
+	if len(r.samples) < latencySamples {
+		r.samples = append(r.samples, d)
+		return
+	}
+	r.samples[r.next] = d
+	r.next = (r.next + 1) % len(r.samples)
+}
+
+func (r *reservoir) summary() latencySummary {
+	sorted := slices.Clone(r.samples)
+	slices.Sort(sorted)
+	quantile := func(q float64) float64 {
+		if len(sorted) == 0 {
+			return 0
+		}
+		return sorted[int(q*float64(len(sorted)-1))].Seconds()
+	}
+	return latencySummary{Count: r.count, P50: quantile(0.5), P99: quantile(0.99)}
+}
+
+// latencies records how long the writes of the lines of each printer took,
+// to find the slow sinks. Only the printers tracked are recorded: a line of a
+// stopped printer can still be written after it is forgotten, such as from the
+// batch of the output, and must not bring it back.
+type latencies struct {
+	mu sync.Mutex
+	m  map[string]*reservoir
+}
+
+// track starts recording the durations of a printer once it is added.
+func (l *latencies) track(printer string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.m == nil {
+		l.m = make(map[string]*reservoir)
+	}
+	l.m[printer] = &reservoir{}
+}
+
+func (l *latencies) add(printer string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r, ok := l.m[printer]; ok {
+		r.add(d)
+	}
+}
+
+// forget drops the durations of a printer once it is stopped.
+func (l *latencies) forget(printer string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.m, printer)
+}
+
+// Summaries returns the quantiles of the write durations, by printer, for the
+// printers that wrote lines.
+func (l *latencies) Summaries() map[string]latencySummary {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := make(map[string]latencySummary, len(l.m))
+	for k, r := range l.m {
+		if r.count > 0 {
+			s[k] = r.summary()
+		}
+	}
+	return s
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReservoir(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []time.Duration
+		want    latencySummary
+	}{
+		{"empty", nil, latencySummary{}},
+		{"one", []time.Duration{time.Second}, latencySummary{Count: 1, P50: 1, P99: 1}},
+		{"unsorted", []time.Duration{3 * time.Second, time.Second, 2 * time.Second}, latencySummary{Count: 3, P50: 2, P99: 2}},
+	}
+	for _, tt := range tests {
+		var r reservoir
+		for _, d := range tt.samples {
+			r.add(d)
+		}
+		if got := r.summary(); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// Only the last samples are kept, but all of them are counted.
+	var r reservoir
+	for range latencySamples {
+		r.add(time.Hour)
+	}
+	for range latencySamples {
+		r.add(time.Millisecond)
+	}
+	if got := r.summary(); got.Count != 2*latencySamples || got.P99 != time.Millisecond.Seconds() {
+		t.Errorf("got %+v, want %d samples counted and only the last ones kept", got, 2*latencySamples)
+	}
+}
+
+// slowSink takes `delay` to write the lines of the printer named `slow`.
+type slowSink struct {
+	testSink
+	delay time.Duration
+}
+
+func (s *slowSink) Write(colored, plain string) error {
+	if strings.HasSuffix(plain, " slow\n") {
+		time.Sleep(s.delay)
+	}
+	return s.testSink.Write(colored, plain)
+}
+
+func TestWriteLatency(t *testing.T) {
+	c := newFakeClock()
+	sk := &slowSink{delay: 20 * time.Millisecond}
+	// The printers tick on the fake clock, their writes are timed for real.
+	out := newOutput(sk, realClock{}, 0)
+	out.format = "plain"
+	go out.run()
+	p := newPrinters(c, out)
+	t.Cleanup(func() {
+		p.StopAll(5 * time.Second)
+		out.Close()
+	})
+	mustAdd(t, p, spec{Name: "slow", Period: 1}, spec{Name: "fast", Period: 1})
+	waitTimers(t, c, 2)
+	for i := 1; i <= 3; i++ {
+		c.Advance(time.Second)
+		waitFor(t, "the lines", func() bool { return len(sk.Lines()) == 2*i })
+	}
+
+	w := serve(t, newTestServer(p), http.MethodGet, "/api/stats", "")
+	var st struct {
+		WriteLatency map[string]latencySummary `json:"write_latency"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	slow, fast := st.WriteLatency["slow"], st.WriteLatency["fast"]
+	if slow.Count != 3 || slow.P50 < sk.delay.Seconds() || slow.P99 < sk.delay.Seconds() {
+		t.Errorf("slow: %+v, want 3 writes of at least %s", slow, sk.delay)
+	}
+	if fast.Count != 3 || fast.P99 >= sk.delay.Seconds() {
+		t.Errorf("fast: %+v, want 3 writes faster than %s", fast, sk.delay)
+	}
+
+	p.Stop("slow", false)
+	waitFor(t, "slow to stop", func() bool { _, ok := p.Get("slow"); return !ok })
+	if _, ok := p.Stats().WriteLatency["slow"]; ok {
+		t.Error("the latencies of a stopped printer are still reported")
+	}
+}
+
+func TestWriteLatencyStopped(t *testing.T) {
+	c := newFakeClock()
+	// The lines are batched on a clock of their own, to stop the printer while
+	// its line is still in the batch.
+	batch := newFakeClock()
+	sk := &testSink{}
+	out := newOutput(sk, batch, 50*time.Millisecond)
+	out.format = "plain"
+	go out.run()
+	p := newPrinters(c, out)
+	t.Cleanup(func() {
+		p.StopAll(5 * time.Second)
+		out.Close()
+	})
+	mustAdd(t, p, spec{Name: "a", Period: 1})
+	waitTimers(t, c, 1)
+	c.Advance(time.Second)
+	waitTimers(t, batch, 1)
+
+	p.Stop("a", false)
+	waitFor(t, "a to stop", func() bool { _, ok := p.Get("a"); return !ok })
+	batch.Advance(50 * time.Millisecond)
+	waitFor(t, "the line", func() bool { return len(sk.Lines()) == 1 })
+	if got := p.Stats().WriteLatency; len(got) != 0 {
+		t.Errorf("got the latencies %+v, want none for the stopped printer", got)
+	}
+
+	// A printer added again with the same name starts over.
+	mustAdd(t, p, spec{Name: "a", Period: 1})
+	waitTimers(t, c, 1)
+	c.Advance(time.Second)
+	waitTimers(t, batch, 1)
+	batch.Advance(50 * time.Millisecond)
+	waitFor(t, "the line", func() bool { return len(sk.Lines()) == 2 })
+	if got := p.Stats().WriteLatency["a"]; got.Count != 1 {
+		t.Errorf("got %+v, want the write of the new printer", got)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "time"
+
+// limiter is a token bucket letting through `rate` events per second on average,
+// and bursts of up to `rate` events. It isn't safe for concurrent use.
+type limiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter returns a limiter with a full bucket, or nil if rate is 0.
+func newLimiter(rate int, now time.Time) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{rate: float64(rate), tokens: float64(rate), last: now}
+}
+
+// allow takes a token and returns true if there is one.
+func (l *limiter) allow(now time.Time) bool {
+	l.refill(now)
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// wait returns how long until there is a token.
+func (l *limiter) wait(now time.Time) time.Duration {
+	l.refill(now)
+	if l.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+func (l *limiter) refill(now time.Time) {
+	if now.After(l.last) {
+		l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	if newLimiter(0, time.Time{}) != nil {
+		t.Error("a limiter without a rate isn't nil")
+	}
+	start := time.Date(2024, 3, 18, 12, 0, 0, 0, time.UTC)
+	l := newLimiter(4, start)
+	allowed := 0
+	for range 10 {
+		if l.allow(start) {
+			allowed++
+		}
+	}
+	if allowed != 4 {
+		t.Errorf("%d allowed at once, want a burst of 4", allowed)
+	}
+	if got := l.wait(start); got != 250*time.Millisecond {
+		t.Errorf("wait %s, want 250ms for the next token", got)
+	}
+	if l.allow(start.Add(200*time.Millisecond)) || !l.allow(start.Add(250*time.Millisecond)) {
+		t.Error("the token isn't back after 250ms")
+	}
+	// The bucket never holds more than a second of tokens.
+	later := start.Add(time.Hour)
+	allowed = 0
+	for range 10 {
+		if l.allow(later) {
+			allowed++
+		}
+	}
+	if allowed != 4 {
+		t.Errorf("%d allowed after an hour, want 4", allowed)
+	}
+}
+
+func TestMaxRate(t *testing.T) {
+	for _, overflow := range overflowPolicies {
+		t.Run(overflow, func(t *testing.T) {
+			c := newFakeClock()
+			sk := &testSink{}
+			// The printers tick on the fake clock, the output limits them for real.
+			out := newOutput(sk, realClock{}, 0)
+			out.format = "plain"
+			start := time.Now()
+			out.limit = newLimiter(5, start)
+			out.overflow = overflow
+			go out.run()
+			p := newPrinters(c, out)
+			for i := range 20 {
+				mustAdd(t, p, spec{Name: fmt.Sprint("fast", i), Period: 1})
+			}
+			waitTimers(t, c, 20)
+			for i := range 3 {
+				c.Advance(time.Second)
+				waitFor(t, "the ticks", func() bool { return p.Stats().Ticks == int64(20*(i+1)) })
+			}
+			waitFor(t, "the lines", func() bool {
+				dropped, queued := out.Counts()
+				return int64(len(sk.Lines()))+dropped+queued == 60
+			})
+			written, elapsed := len(sk.Lines()), time.Since(start)
+			if limit := 5 + int(elapsed.Seconds()*5) + 1; written > limit {
+				t.Errorf("%d lines written in %s, want at most %d", written, elapsed, limit)
+			}
+
+			p.StopAll(5 * time.Second)
+			out.Close()
+			dropped, queued := out.Counts()
+			switch overflow {
+			case "drop":
+				if dropped == 0 || queued != 0 || len(sk.Lines()) != written {
+					t.Errorf("%d dropped and %d queued, want the lines past the limit dropped", dropped, queued)
+				}
+			case "queue":
+				// Closing writes the queued lines regardless of the limit.
+				if dropped != 0 || queued == 0 || len(sk.Lines()) != 60 {
+					t.Errorf("%d dropped, %d queued and %d written once closed, want every line written", dropped, queued, len(sk.Lines()))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"zgo.at/zli"
+)
+
+// listColors writes each name in the color it would be printed with, following
+// the rules, followed by the color in hexadecimal, separated by a tab. Without
+// colors, only the mapping is left.
+func listColors(w io.Writer, names []string, rules colorRules) {
+	for _, name := range names {
+		color := rules.color(name)
+		fmt.Fprintf(w, "%s\t%s\n", zli.Colorize(stripUnsafe(name), hexColor(color)), color)
+	}
+}
+
+// readLines returns the non-empty lines of r.
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if sc.Text() != "" {
+			lines = append(lines, sc.Text())
+		}
+	}
+	return lines, sc.Err()
+}
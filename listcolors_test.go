@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStringToColor(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", "#C59D9C"},
+		{"foo", "#93DE8F"},
+		{"bar", "#A0B699"},
+		{"web-1", "#C7F793"},
+	}
+	for _, tt := range tests {
+		if got := stringToColor(tt.in); got != tt.want {
+			t.Errorf("stringToColor(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+		if !colorRe.MatchString(stringToColor(tt.in)) {
+			t.Errorf("stringToColor(%q) isn't #RRGGBB", tt.in)
+		}
+	}
+}
+
+func TestListColors(t *testing.T) {
+	var rules colorRules
+	if err := rules.Set("^db-=#112233"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	// The tests don't write to a terminal, so there are no colors like with -nocolor.
+	listColors(&buf, []string{"foo", "db-1", "bar"}, rules)
+	want := "foo\t#93DE8F\ndb-1\t#112233\nbar\t#A0B699\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	got, err := readLines(strings.NewReader("foo\n\nbar baz\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "foo" || got[1] != "bar baz" {
+		t.Errorf("got %q, want the non-empty lines", got)
+	}
+}
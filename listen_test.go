@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListenFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-http", ":8080"}, ":8080"},
+		{[]string{"-http", "127.0.0.1:9000", "-http", ":8080=readonly"}, "127.0.0.1:9000,:8080=readonly"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		c := parseFlags(t, tt.args...)
+		if got := c.Listen.String(); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.args, got, tt.want)
+		}
+	}
+	for _, v := range []string{"", "=readonly", ":8080=readwrite"} {
+		var f listenFlags
+		if err := f.Set(v); err == nil {
+			t.Errorf("%q: no error", v)
+		}
+	}
+}
+
+func TestListenHost(t *testing.T) {
+	tests := []struct{ addr, want string }{
+		{":8080", "localhost:8080"},
+		{"127.0.0.1:9000", "127.0.0.1:9000"},
+		{"[::1]:9000", "[::1]:9000"},
+		{"not an address", "not an address"},
+	}
+	for _, tt := range tests {
+		if got := listenHost(tt.addr); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestListeners(t *testing.T) {
+	// Stopped by the shutdown, with its output.
+	out := newOutput(&testSink{}, realClock{}, 0)
+	go out.run()
+	p := newPrinters(realClock{}, out)
+	mustAdd(t, p, spec{Name: "a", Period: 60})
+	s := newTestServer(p)
+	addrs := []listenAddr{{addr: "127.0.0.1:0"}, {addr: "127.0.0.1:0", readOnly: true}}
+
+	servers := make([]*http.Server, len(addrs))
+	urls := make([]string, len(addrs))
+	errc := make(chan error, len(addrs))
+	for i, la := range addrs {
+		servers[i] = s.listenerServer(la, s.config)
+		l, err := listen(la.addr, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls[i] = "http://" + l.Addr().String()
+		go func() { errc <- servers[i].Serve(l) }()
+	}
+
+	tests := []struct {
+		listener int
+		name     string
+		// Status of a read, and of adding the printer.
+		get, add int
+	}{
+		{0, "b", http.StatusOK, http.StatusOK},
+		{1, "c", http.StatusOK, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(urls[tt.listener] + "/api/printers/a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.get {
+			t.Errorf("listener %d: GET status %d, want %d", tt.listener, resp.StatusCode, tt.get)
+		}
+		resp, err = http.Post(urls[tt.listener]+"/api/printers/bulk", "application/json", strings.NewReader(`[{"name": "`+tt.name+`", "period": 60}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.add {
+			t.Errorf("listener %d: POST status %d, want %d", tt.listener, resp.StatusCode, tt.add)
+		}
+	}
+	// Both listeners serve the same printers.
+	if _, ok := p.Get("b"); !ok {
+		t.Error("the printer added on the first listener is missing")
+	}
+	if _, ok := p.Get("c"); ok {
+		t.Error("the printer was added on the read-only listener")
+	}
+
+	// The shutdown closes every listener.
+	shutdown(servers, p, nil, slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)), time.Second)
+	for range addrs {
+		if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("got %v, want the server closed", err)
+		}
+	}
+	for _, u := range urls {
+		if _, err := net.DialTimeout("tcp", strings.TrimPrefix(u, "http://"), time.Second); err == nil {
+			t.Errorf("%s still accepts connections", u)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// logfmt formats the name and the fields as logfmt key=value pairs, the name first
+// and then the fields sorted by key. It returns the pairs with the keys colorized
+// and the values escaped by the given functions, and as is.
+func logfmt(name string, fields map[string]string, colorize, escape func(string) string) (colored, plain string) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var c, p strings.Builder
+	pair := func(k, v string) {
+		if p.Len() > 0 {
+			c.WriteByte(' ')
+			p.WriteByte(' ')
+		}
+		v = logfmtValue(v)
+		c.WriteString(colorize(k) + "=" + escape(v))
+		p.WriteString(k + "=" + v)
+	}
+	pair("name", name)
+	for _, k := range keys {
+		pair(k, fields[k])
+	}
+	return c.String(), p.String()
+}
+
+// logfmtValue quotes a value if it is empty or contains spaces, quotes, equal
+// signs or unprintable characters.
+func logfmtValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\\") {
+		return strconv.Quote(v)
+	}
+	for _, r := range v {
+		if !strconv.IsPrint(r) {
+			return strconv.Quote(v)
+		}
+	}
+	return v
+}
+
+// validateFields checks that the keys of the fields can be printed unquoted.
+func validateFields(fields map[string]string) error {
+	for k := range fields {
+		if k == "" {
+			return errors.New("empty field key")
+		}
+		if k == "name" {
+			return errors.New(`the "name" field key is reserved`)
+		}
+		for _, r := range k {
+			if r == '=' || r == '"' || r == ' ' || !strconv.IsPrint(r) {
+				return fmt.Errorf("field key %q contains %q", k, r)
+			}
+		}
+	}
+	return nil
+}
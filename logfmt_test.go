@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLogfmt(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]string
+		want   string
+	}{
+		{"foo", nil, "name=foo"},
+		{"foo", map[string]string{"status": "ok", "count": "3"}, "name=foo count=3 status=ok"},
+		{"my printer", map[string]string{"msg": "hello world"}, `name="my printer" msg="hello world"`},
+		{"foo", map[string]string{"empty": ""}, `name=foo empty=""`},
+		{"foo", map[string]string{"q": `say "hi"`, "eq": "a=b", "bs": `C:\dir`}, `name=foo bs="C:\\dir" eq="a=b" q="say \"hi\""`},
+		{"foo", map[string]string{"tab": "a\tb", "nl": "a\nb"}, `name=foo nl="a\nb" tab="a\tb"`},
+		{"foo", map[string]string{"unicode": "héllo"}, "name=foo unicode=héllo"},
+	}
+	for _, tt := range tests {
+		colored, plain := logfmt(tt.name, tt.fields, func(s string) string { return "<" + s + ">" }, func(s string) string { return "[" + s + "]" })
+		if plain != tt.want {
+			t.Errorf("plain %s, want %s", plain, tt.want)
+		}
+		if tt.fields == nil && colored != "<name>=[foo]" {
+			t.Errorf("colored %s, want the key colorized and the value escaped", colored)
+		}
+	}
+}
+
+func TestValidateFields(t *testing.T) {
+	tests := []struct {
+		fields map[string]string
+		ok     bool
+	}{
+		{map[string]string{"status": "ok", "x.y-z": "anything \" goes"}, true},
+		{map[string]string{"": "v"}, false},
+		{map[string]string{"name": "v"}, false},
+		{map[string]string{"a b": "v"}, false},
+		{map[string]string{"a=b": "v"}, false},
+		{map[string]string{`a"b`: "v"}, false},
+		{map[string]string{"a\nb": "v"}, false},
+	}
+	for _, tt := range tests {
+		if err := validateFields(tt.fields); (err == nil) != tt.ok {
+			t.Errorf("validateFields(%q) = %v, want ok %t", tt.fields, err, tt.ok)
+		}
+	}
+}
+
+func TestFieldsPrinter(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	s := newTestServer(p)
+	if w := serve(t, s, http.MethodPost, "/api/printers/bulk", `[{"name": "svc", "period": 1, "fields": {"status": "ok", "msg": "all good"}}]`); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if info, _ := p.Get("svc"); info.Fields["status"] != "ok" {
+		t.Errorf("fields %q, want them in the API", info.Fields)
+	}
+	waitTimers(t, c, 1)
+	tick(t, c, time.Second, sk, 1)
+	if got := sk.Lines()[0]; got != `0001 name=svc msg="all good" status=ok` {
+		t.Errorf("got %q", got)
+	}
+	if w := serve(t, s, http.MethodPost, "/api/printers/bulk", `[{"name": "bad", "period": 1, "fields": {"a b": "c"}}]`); w.Code != http.StatusBadRequest {
+		t.Errorf("an invalid key: status %d, want 400", w.Code)
+	}
+}
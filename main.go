@@ -1,222 +1,1924 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"hash/fnv"
+	"html"
+	"io"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"net"
 	"net/http"
-	"strconv"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
-	"text/template"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	// Used for colorizing CLI output.
 	"zgo.at/zli"
+
+	"github.com/robfig/cron/v3"
 )
 
 type printers struct {
 	mu sync.Mutex
 
-	l map[string]printer
+	l map[string]*printer
+	// Index of the names by id, kept in sync with `l`.
+	ids    map[int64]string
+	lastID atomic.Int64
+	clock  Clock
+	out    *output
+	// When the printers were created, the printed times are relative to it.
+	start time.Time
+	// Called when a printer was added, removed or changed, without the lock held.
+	onChange func()
+	// Maximum number of printers, 0 for no limit.
+	max int
+	// Colors of the printers added without one, before the one derived from the name.
+	colorRules colorRules
+	// How the names are normalized when added, one of normalizeModes.
+	normalize string
+	// Features of the printers turned off by -disable, Add rejects them.
+	disabled map[string]bool
+	// Where the add, stop and tick events are sent, nil for nowhere.
+	webhook *webhook
+	// Sink of -net, if any, for its counters.
+	net *netSink
+	// Passes the ticks to the shadow printers.
+	hub *hub
+	// Where the errors of the printers are recorded, such as failed guards.
+	errors *errorLog
+	// Number of calls to Stop that didn't stop anything.
+	stopErrors atomic.Int64
+	// Number of lines printed by every printer since the start.
+	ticks atomic.Int64
+	// Number of stalled printers restarted by the supervisor.
+	restarts atomic.Int64
+	// What to do with the tick handled when the system resumes, one of
+	// resumePolicies, and how many times it happened.
+	resume  string
+	resumes atomic.Int64
+	// Set by Freeze, Add fails until Unfreeze.
+	frozen bool
+	// Set by Drain to when the server shuts down, Add fails once set.
+	drainUntil time.Time
+}
+
+// newPrinters returns an empty list of printers using `clock` as its source of time,
+// and writing their lines to `out`.
+func newPrinters(clock Clock, out *output) *printers {
+	return &printers{
+		l:     make(map[string]*printer),
+		ids:   make(map[int64]string),
+		clock: clock,
+		out:   out,
+		start: clock.Now(),
+		hub:   newHub(),
+	}
 }
 
 type printer struct {
-	// Channel to cancel a printing goroutine.
-	done   chan struct{}
-	period int
+	// Unique and never reused, a shorter handle than the name.
+	id int64
+	// Channel to cancel a printing goroutine, buffered so that signaling never blocks.
+	done chan struct{}
+	// Closed by the printing goroutine once it has started, and once it has returned.
+	running chan struct{}
+	exited  chan struct{}
+	// Set once the printer was asked to stop.
+	stopping bool
+	// Signaled when the period changed and the ticker must be reset.
+	reset  chan struct{}
+	period time.Duration
+	// What the printer prints, its name unless changed by SetText.
+	text  string
+	color string
+	added time.Time
+	// When the current goroutine was started, later than `added` once restarted.
+	started time.Time
+	paused  bool
+	guard   string
+	window  window
+	// Cron expression and its parsed schedule, nil when the printer uses its period.
+	cron     string
+	schedule cron.Schedule
+	// Next time the cron schedule fires.
+	next     time.Time
+	priority int
+	// Never modified once the printer is created.
+	fields map[string]string
+	// Last time the ticker or the schedule fired, even if nothing was printed.
+	lastTick time.Time
+	// Timer restoring the period to `unboosted` at the end of a boost, nil when not boosted.
+	boost     Timer
+	unboosted time.Duration
+	// Last error encountered by the printing goroutine, empty if none.
+	err string
+	// Ticks at absolute times instead of using a ticker, only for printers with a period.
+	precise bool
+	// Sum of how late each tick was handled after it was due, the largest one,
+	// and the longest time between two ticks.
+	drift    time.Duration
+	maxDrift time.Duration
+	maxGap   time.Duration
+	// Prints with a faint style on top of the color.
+	dim bool
+	// Ticks on the multiples of the period since the zero time, plus the offset,
+	// only for printers with a period.
+	align  bool
+	offset time.Duration
+	// Prints a countdown in the seconds before each tick.
+	countdown bool
+	// Only stopped by Stop when forced, can be changed by SetPinned.
+	pinned bool
+	// Range of the random period picked after each tick, zero for a fixed period.
+	// The period is then the maximum.
+	minPeriod, maxPeriod time.Duration
+	// Name of the printer this one ticks with, instead of having a period.
+	mirror string
+	// Name of the sink of -sink the printer writes to, empty for the default one.
+	sink string
+	// Prints each line in the next color of the palette, or of defaultPalette
+	// if it has none, starting over after the last one.
+	cycle   bool
+	palette []string
+	// Number of lines printed while cycling, the next color is the one at
+	// this index in the palette.
+	cycled int
+	// Only prints every `every` ticks, each one for 0 or 1, counting in
+	// ticked the ticks that would have printed otherwise.
+	every  int
+	ticked int64
+	// Neither saved nor sent to the webhook, such as the printer of the self-test.
+	ephemeral bool
+	// Last line printed on a tick, without colors, and when.
+	lastLine   string
+	lastLineAt time.Time
+}
+
+// randomPeriod returns a random period between the minimum and the maximum, both included.
+func (pr *printer) randomPeriod() time.Duration {
+	return pr.minPeriod + rand.N(pr.maxPeriod-pr.minPeriod+1)
+}
+
+// stalled reports whether a printer that is not paused missed its ticks for
+// more than twice its period, which means its goroutine is wedged.
+func (pr *printer) stalled(now time.Time) bool {
+	// A shadow printer has no schedule to be late on.
+	if pr.paused || pr.mirror != "" {
+		return false
+	}
+	grace := 2 * pr.period
+	if pr.schedule != nil {
+		return !pr.next.IsZero() && now.Sub(pr.next) > grace
+	}
+	last := pr.lastTick
+	if last.Before(pr.started) {
+		last = pr.started
+	}
+	return now.Sub(last) > grace
+}
+
+// spec describes a printer to launch.
+type spec struct {
+	Name   string `json:"name"`
+	Period int    `json:"period"`
+	// Optional shell command, the printer only prints when it exits with 0.
+	Guard string `json:"guard,omitempty"`
+	// Optional hours of the day outside of which the printer stays silent.
+	Window window `json:"window"`
+	// Optional cron expression, replacing the period when given.
+	Cron string `json:"cron,omitempty"`
+	// Lines printed at the same time are written by decreasing priority.
+	Priority int `json:"priority,omitempty"`
+	// Optional color as #RRGGBB, instead of the one derived from the name.
+	Color string `json:"color,omitempty"`
+	// Optional fields printed after the name as logfmt key=value pairs.
+	Fields map[string]string `json:"fields,omitempty"`
+	// Ticks at start + n*period, catching up on late ticks instead of skipping them.
+	Precise bool `json:"precise,omitempty"`
+	// Prints in a faint style, to de-emphasize the printer.
+	Dim bool `json:"dim,omitempty"`
+	// Optional text printed instead of the name.
+	Text string `json:"text,omitempty"`
+	// Ticks on the multiples of the period, such as every hour at :00, plus
+	// Offset seconds, which must be less than the period.
+	Align  bool `json:"align,omitempty"`
+	Offset int  `json:"offset,omitempty"`
+	// Prints "3...", "2..." and "1..." in the seconds before each tick.
+	Countdown bool `json:"countdown,omitempty"`
+	// Refuses to be stopped unless forced.
+	Pinned bool `json:"pinned,omitempty"`
+	// Ticks after a random number of seconds between them instead of a fixed
+	// period, both must be given.
+	MinPeriod int `json:"minperiod,omitempty"`
+	MaxPeriod int `json:"maxperiod,omitempty"`
+	// Name of a printer to tick with instead of having a period, the shadow
+	// printer is stopped with it.
+	Mirror string `json:"mirror,omitempty"`
+	// Name of a destination of -sink to write to instead of the default ones.
+	Sink string `json:"sink,omitempty"`
+	// Prints each line in the next color of the palette, made of the color
+	// with its channels rotated if not given, instead of a fixed one.
+	Cycle   bool     `json:"cycle,omitempty"`
+	Palette []string `json:"palette,omitempty"`
+	// Only prints every n-th tick, the others are still counted.
+	Every int `json:"printevery,omitempty"`
 }
 
+// Errors returned by the methods of the printers, to be checked with errors.Is.
+var (
+	// There is no printer with this name.
+	ErrNotFound = errors.New("no such printer")
+	// There is already a printer with this name.
+	ErrExists = errors.New("printer already exists")
+	// The maximum number of printers is reached.
+	ErrLimit = errors.New("too many printers")
+	// The period isn't a positive duration, or the printer follows a cron schedule.
+	ErrInvalidPeriod = errors.New("invalid period")
+	// Printers can't be added between Freeze and Unfreeze.
+	ErrFrozen = errors.New("printers are frozen")
+	// Printers can't be added once Drain is called, the server is shutting down.
+	ErrDraining = errors.New("server is draining before shutting down")
+	// The printer uses a feature turned off by -disable.
+	ErrDisabled = errors.New("disabled on this server")
+)
+
 // Add a new printer if it does not exist for this string,
-// and launch a goroutine that prints every `period` second.
-func (p *printers) Add(s string, period int) {
+// and launch a goroutine that prints every `period` second, or following its cron schedule.
+// It returns ErrExists if there is already one, ErrLimit past the maximum number of
+// printers, ErrFrozen while frozen, ErrDraining once draining, and another error if the spec is invalid.
+func (p *printers) Add(sp spec) error {
+	_, err := p.add(sp, false, false)
+	return err
+}
+
+// AddEphemeral adds a printer like Add, except that it is left out of Specs,
+// so never saved, and that it isn't sent to the webhook.
+func (p *printers) AddEphemeral(sp spec) error {
+	_, err := p.add(sp, false, true)
+	return err
+}
+
+// AddSuffixed adds a printer like Add, except that if there is already one for
+// this string, the name is followed by the first free suffix among " (2)", " (3)"
+// and so on, and it still prints the name it was given. It returns the name
+// the printer was added with.
+func (p *printers) AddSuffixed(sp spec) (string, error) {
+	return p.add(sp, true, false)
+}
+
+func (p *printers) add(sp spec, suffix, ephemeral bool) (string, error) {
+	if name := normalizeName(sp.Name, p.normalize); name != sp.Name {
+		// The name is still printed as it was given.
+		if sp.Text == "" {
+			sp.Text = sp.Name
+		}
+		sp.Name = name
+	}
+	sp.Mirror = normalizeName(sp.Mirror, p.normalize)
+	if err := validateName(sp.Name); err != nil {
+		return "", err
+	}
+	if err := checkFeatures(sp, p.disabled); err != nil {
+		return "", err
+	}
+
+	var schedule cron.Schedule
+	if sp.Cron != "" {
+		var err error
+		if schedule, err = cron.ParseStandard(sp.Cron); err != nil {
+			return "", fmt.Errorf("invalid cron expression: %w", err)
+		}
+		if sp.Precise {
+			return "", errors.New("precise only applies to printers with a period, not a cron expression")
+		}
+		if sp.Align {
+			return "", errors.New("align only applies to printers with a period, not a cron expression")
+		}
+	} else if sp.Mirror == "" && sp.Period < 1 {
+		return "", fmt.Errorf("%w: must be a positive number of seconds", ErrInvalidPeriod)
+	}
+	if err := validateOffset(sp); err != nil {
+		return "", err
+	}
+	if err := validateRange(sp); err != nil {
+		return "", err
+	}
+	if err := validateMirror(sp); err != nil {
+		return "", err
+	}
+	if err := validateCycle(sp); err != nil {
+		return "", err
+	}
+	if sp.Every < 0 {
+		return "", errors.New("printevery must be a positive number of ticks")
+	}
+	period := time.Duration(sp.Period) * time.Second
+	switch {
+	case sp.MaxPeriod > 0:
+		period = time.Duration(sp.MaxPeriod) * time.Second
+	case sp.Mirror != "":
+		period = 0
+	}
+	if sp.Countdown && sp.Cron == "" && sp.Period <= countdownSteps {
+		slog.Warn("the period is too short for a countdown, the printer won't have one", "name", sp.Name, "period", sp.Period)
+	}
+
+	color := sp.Color
+	if color == "" {
+		color = p.colorRules.color(sp.Name)
+	} else if !colorRe.MatchString(color) {
+		return "", fmt.Errorf("invalid color %q: expected #RRGGBB", color)
+	}
+
+	if err := validateFields(sp.Fields); err != nil {
+		return "", err
+	}
+	if sp.Sink != "" && !p.out.hasSink(sp.Sink) {
+		return "", fmt.Errorf("unknown sink %q, expected one of -sink", sp.Sink)
+	}
+	text := sp.Name
+	if sp.Text != "" {
+		if err := validateName(sp.Text); err != nil {
+			return "", fmt.Errorf("invalid text: %w", err)
+		}
+		text = sp.Text
+	}
+	var fields map[string]string
+	if len(sp.Fields) > 0 {
+		fields = maps.Clone(sp.Fields)
+	}
+
+	// A printer being stopped stays in the list until its goroutine exits, wait for it
+	// so that a quick Stop then Add never leaves two goroutines for the same name.
+	for {
+		p.mu.Lock()
+		old, ok := p.l[sp.Name]
+		if !ok {
+			break
+		}
+		if suffix && !old.stopping {
+			sp.Name = p.freeName(sp.Name)
+			break
+		}
+		p.mu.Unlock()
+		// Return early if we already have one printer for that string.
+		if !old.stopping {
+			return "", ErrExists
+		}
+		<-old.exited
+	}
+	if p.frozen {
+		p.mu.Unlock()
+		return "", ErrFrozen
+	}
+	if !p.drainUntil.IsZero() {
+		p.mu.Unlock()
+		return "", ErrDraining
+	}
+	if p.max > 0 && len(p.l) >= p.max {
+		p.mu.Unlock()
+		return "", ErrLimit
+	}
+	if src, ok := p.l[sp.Mirror]; sp.Mirror != "" && (!ok || src.stopping) {
+		p.mu.Unlock()
+		return "", fmt.Errorf("%w: no printer %q to mirror", ErrNotFound, sp.Mirror)
+	}
+
+	now := p.clock.Now()
+	pr := &printer{
+		id:        p.lastID.Add(1),
+		done:      make(chan struct{}, 1),
+		running:   make(chan struct{}),
+		exited:    make(chan struct{}),
+		reset:     make(chan struct{}, 1),
+		period:    period,
+		text:      text,
+		color:     color,
+		added:     now,
+		started:   now,
+		guard:     sp.Guard,
+		window:    sp.Window,
+		cron:      sp.Cron,
+		schedule:  schedule,
+		priority:  sp.Priority,
+		fields:    fields,
+		precise:   sp.Precise,
+		dim:       sp.Dim,
+		align:     sp.Align,
+		offset:    time.Duration(sp.Offset) * time.Second,
+		countdown: sp.Countdown,
+		pinned:    sp.Pinned,
+		minPeriod: time.Duration(sp.MinPeriod) * time.Second,
+		maxPeriod: time.Duration(sp.MaxPeriod) * time.Second,
+		mirror:    sp.Mirror,
+		sink:      sp.Sink,
+		cycle:     sp.Cycle,
+		palette:   slices.Clone(sp.Palette),
+		every:     sp.Every,
+		ephemeral: ephemeral,
+	}
+	p.l[sp.Name] = pr
+	p.ids[pr.id] = sp.Name
+	p.out.latency.track(sp.Name)
+	go p.runPrinter(sp.Name, pr)
+	p.mu.Unlock()
+
+	if !ephemeral {
+		p.changed()
+		p.webhook.send(webhookEvent{Event: "add", Name: sp.Name, Time: now, Spec: &sp})
+	}
+	return sp.Name, nil
+}
+
+// freeName returns `name` followed by the first suffix among " (2)", " (3)"...
+// for which there is no printer. The lock must be held.
+func (p *printers) freeName(name string) string {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+		if _, ok := p.l[candidate]; !ok {
+			return candidate
+		}
+	}
+}
+
+// validateOffset checks the offset of an aligned printer.
+func validateOffset(sp spec) error {
+	switch {
+	case sp.Offset == 0:
+		return nil
+	case !sp.Align:
+		return errors.New("offset only applies to aligned printers")
+	case sp.Offset < 0 || sp.Offset >= sp.Period:
+		return fmt.Errorf("invalid offset %d: must be between 0 and the period, %d seconds", sp.Offset, sp.Period)
+	}
+	return nil
+}
+
+// validateRange checks the range of a printer with a random period.
+func validateRange(sp spec) error {
+	switch {
+	case sp.MinPeriod == 0 && sp.MaxPeriod == 0:
+		return nil
+	case sp.MinPeriod == 0 || sp.MaxPeriod == 0:
+		return errors.New("minperiod and maxperiod must be given together")
+	case sp.MinPeriod < 1:
+		return fmt.Errorf("%w: minperiod must be a positive number of seconds", ErrInvalidPeriod)
+	case sp.MinPeriod > sp.MaxPeriod:
+		return fmt.Errorf("%w: minperiod %d is more than maxperiod %d", ErrInvalidPeriod, sp.MinPeriod, sp.MaxPeriod)
+	case sp.Cron != "" || sp.Precise || sp.Align:
+		return errors.New("a random period can't be combined with a cron expression, precise or align")
+	}
+	return nil
+}
+
+// validateMirror checks the settings of a shadow printer, which only has its source.
+func validateMirror(sp spec) error {
+	switch {
+	case sp.Mirror == "":
+		return nil
+	case sp.Mirror == sp.Name:
+		return errors.New("a printer can't mirror itself")
+	case sp.Cron != "" || sp.Precise || sp.Align || sp.MaxPeriod != 0 || sp.Countdown:
+		return errors.New("mirror can't be combined with a cron expression, precise, align, a random period or a countdown")
+	}
+	return nil
+}
+
+// sortMirrors returns the specs with every shadow printer after the printer it
+// mirrors, so that they can be added in order. The shadow printers whose source
+// is missing are left at the end, for Add to report it. The ones mirroring each
+// other in a cycle could never be added, they are left out and reported in the
+// error.
+func sortMirrors(specs []spec) ([]spec, error) {
+	sorted := make([]spec, 0, len(specs))
+	added := make(map[string]bool)
+	for len(specs) > 0 {
+		var rest []spec
+		for _, sp := range specs {
+			if sp.Mirror == "" || added[sp.Mirror] {
+				sorted = append(sorted, sp)
+				added[sp.Name] = true
+			} else {
+				rest = append(rest, sp)
+			}
+		}
+		if len(rest) == len(specs) {
+			missing, err := mirrorCycles(rest)
+			return append(sorted, missing...), err
+		}
+		specs = rest
+	}
+	return sorted, nil
+}
+
+// mirrorCycles splits the shadow printers that sortMirrors couldn't order into
+// the ones in a cycle, returned in an error such as "a -> b -> a", and the others,
+// whose source is missing, or mirrors one in a cycle.
+func mirrorCycles(specs []spec) (missing []spec, err error) {
+	byName := make(map[string]spec, len(specs))
+	for _, sp := range specs {
+		byName[sp.Name] = sp
+	}
+	inCycle := make(map[string]bool)
+	var errs []error
+	for _, sp := range specs {
+		// Follow the sources until one is missing, or is already on the way.
+		var path []string
+		for cur, ok := sp, true; ok && !inCycle[cur.Name]; cur, ok = byName[cur.Mirror] {
+			if i := slices.Index(path, cur.Name); i >= 0 {
+				cycle := path[i:]
+				for _, name := range cycle {
+					inCycle[name] = true
+				}
+				errs = append(errs, fmt.Errorf("printers mirroring each other: %s -> %s", strings.Join(cycle, " -> "), cur.Name))
+				break
+			}
+			path = append(path, cur.Name)
+		}
+	}
+	for _, sp := range specs {
+		if !inCycle[sp.Name] {
+			missing = append(missing, sp)
+		}
+	}
+	return missing, errors.Join(errs...)
+}
+
+// changed calls the onChange hook, if any, unless the printers are frozen, so
+// that the printers stopped by Freeze are still saved and restored after a
+// restart. The lock must not be held.
+func (p *printers) changed() {
+	if p.onChange != nil && !p.Frozen() {
+		p.onChange()
+	}
+}
+
+// Specs returns the specs to launch the current printers again, sorted by name.
+// Boosts are not included.
+func (p *printers) Specs() []spec {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	// Return early if we already have one printer for that string.
-	if _, ok := p.l[s]; ok {
-		return
+	specs := make([]spec, 0, len(p.l))
+	for k, v := range p.l {
+		if v.ephemeral {
+			continue
+		}
+		sp := spec{
+			Name:      k,
+			Period:    int(v.period / time.Second),
+			Guard:     v.guard,
+			Window:    v.window,
+			Cron:      v.cron,
+			Priority:  v.priority,
+			Fields:    v.fields,
+			Precise:   v.precise,
+			Dim:       v.dim,
+			Align:     v.align,
+			Offset:    int(v.offset / time.Second),
+			Countdown: v.countdown,
+			Pinned:    v.pinned,
+			MinPeriod: int(v.minPeriod / time.Second),
+			MaxPeriod: int(v.maxPeriod / time.Second),
+			Mirror:    v.mirror,
+			Sink:      v.sink,
+			Cycle:     v.cycle,
+			Palette:   slices.Clone(v.palette),
+			Every:     v.every,
+		}
+		if v.text != k {
+			sp.Text = v.text
+		}
+		if v.boost != nil {
+			sp.Period = int(v.unboosted / time.Second)
+		}
+		// Only keep the colors that were explicitly chosen.
+		if v.color != p.colorRules.color(k) {
+			sp.Color = v.color
+		}
+		specs = append(specs, sp)
 	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs
+}
 
-	ch := make(chan struct{})
-	p.l[s] = printer{
-		done:   ch,
-		period: period,
+// validateName checks that a name can be printed and listed safely.
+// Control characters such as newlines would corrupt the line-based outputs,
+// and escape sequences could take over the terminal the printers write to.
+func validateName(name string) error {
+	if name == "" {
+		return errors.New("empty name")
+	}
+	// Invalid bytes could make a terminal swallow the color reset after the name.
+	if !utf8.ValidString(name) {
+		return errors.New("name is not valid UTF-8")
+	}
+	for _, r := range name {
+		if unsafeRune(r) {
+			return fmt.Errorf("name contains the control character %U", r)
+		}
 	}
-	go runPrinter(s, period, ch, stringToColor(s))
+	return nil
+}
+
+// Modes accepted by -normalize.
+var normalizeModes = []string{"none", "trim", "trim+lower"}
+
+// normalizeName returns the name the printer is known by for a name given to
+// Add: as is, without the spaces around it, or also in lower case.
+func normalizeName(name, mode string) string {
+	switch mode {
+	case "trim":
+		return strings.TrimSpace(name)
+	case "trim+lower":
+		return strings.ToLower(strings.TrimSpace(name))
+	default:
+		return name
+	}
+}
+
+// unsafeRune reports whether r is a control character, including the bidirectional
+// overrides that can make a line display differently from what it contains.
+func unsafeRune(r rune) bool {
+	return unicode.IsControl(r) ||
+		(r >= '\u202A' && r <= '\u202E') ||
+		(r >= '\u2066' && r <= '\u2069')
 }
 
-// Stop a printer if it exists for this string.
-func (p *printers) Stop(s string) {
-	fmt.Printf("Stopping %s\n", s)
+// stripUnsafe removes the runes rejected by validateName from s, and replaces
+// invalid UTF-8 with U+FFFD, so that the result is always whole runes.
+func stripUnsafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unsafeRune(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// stopResult is the outcome of Stop.
+type stopResult int
+
+const (
+	stopped stopResult = iota
+	stopNotFound
+	stopAlreadyStopping
+	stopPinned
+)
+
+func (r stopResult) String() string {
+	switch r {
+	case stopped:
+		return "stopped"
+	case stopNotFound:
+		return "not found"
+	case stopAlreadyStopping:
+		return "already stopping"
+	case stopPinned:
+		return "pinned"
+	}
+	return fmt.Sprintf("stopResult(%d)", int(r))
+}
+
+// Stop a printer if it exists for this string and isn't already stopping.
+// A pinned printer is only stopped if `force` is set.
+// The printer is removed from the list by its goroutine once it exits.
+// Stops that don't stop anything are logged and counted in the stats.
+func (p *printers) Stop(s string, force bool) stopResult {
+	fmt.Fprintf(messages, "Stopping %s\n", s)
+	p.mu.Lock()
+	printer, ok := p.l[s]
+	res := stopped
+	switch {
+	case !ok:
+		res = stopNotFound
+	case printer.stopping:
+		res = stopAlreadyStopping
+	case printer.pinned && !force:
+		res = stopPinned
+	default:
+		printer.stopping = true
+		notify(printer.done)
+	}
+	p.mu.Unlock()
+
+	if res != stopped {
+		p.stopErrors.Add(1)
+		slog.Debug("nothing to stop", "name", s, "result", res)
+	}
+	return res
+}
+
+// SetPeriod changes the period of a printer, and cancels its boost if any.
+// It returns ErrNotFound if there is no printer for this string, and ErrInvalidPeriod
+// if the period isn't positive or if the printer follows a cron schedule.
+func (p *printers) SetPeriod(s string, period time.Duration) error {
+	if err := p.setPeriod(s, period); err != nil {
+		return err
+	}
+	p.changed()
+	return nil
+}
+
+// setPeriod is SetPeriod without calling the onChange hook.
+func (p *printers) setPeriod(s string, period time.Duration) error {
+	if period <= 0 {
+		return fmt.Errorf("%w: must be positive", ErrInvalidPeriod)
+	}
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	pr, ok := p.l[s]
+	if !ok {
+		return ErrNotFound
+	}
+	if pr.schedule != nil {
+		return fmt.Errorf("%w: the printer follows a cron schedule", ErrInvalidPeriod)
+	}
+	if pr.maxPeriod > 0 {
+		return fmt.Errorf("%w: the printer has a random period", ErrInvalidPeriod)
+	}
+	if pr.mirror != "" {
+		return fmt.Errorf("%w: the printer mirrors %s", ErrInvalidPeriod, pr.mirror)
+	}
+	pr.cancelBoost()
+	pr.period = period
+	notify(pr.reset)
+	return nil
+}
 
-	printer, ok := p.l[s]
-	if ok {
-		printer.done <- struct{}{}
+// SetPeriodMatching sets the period of every printer whose name matches, like
+// SetPeriod, and returns the names of the updated printers, sorted. The printers
+// following a cron schedule, and the ones being stopped, are left alone.
+func (p *printers) SetPeriodMatching(match func(name string) bool, period time.Duration) ([]string, error) {
+	if period <= 0 {
+		return nil, fmt.Errorf("%w: must be positive", ErrInvalidPeriod)
+	}
+	// Collect the printers under the lock, and update them once it's released.
+	var names []string
+	p.mu.Lock()
+	for k, v := range p.l {
+		if match(k) && !v.stopping && v.schedule == nil && v.maxPeriod == 0 && v.mirror == "" {
+			names = append(names, k)
+		}
+	}
+	p.mu.Unlock()
+
+	updated := names[:0]
+	for _, s := range names {
+		// A printer stopped in between is skipped.
+		if p.setPeriod(s, period) == nil {
+			updated = append(updated, s)
+		}
+	}
+	if len(updated) > 0 {
+		p.changed()
+	}
+	sort.Strings(updated)
+	return updated, nil
+}
+
+// Resync resets the ticker of every printer with a period, so that printers with the same
+// period tick together from now on. It returns how many printers were resynced.
+func (p *printers) Resync() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, v := range p.l {
+		if v.schedule == nil && v.mirror == "" {
+			notify(v.reset)
+			n++
+		}
+	}
+	return n
+}
+
+// StopMatching stops every printer whose name matches, and returns their names sorted.
+// The pinned printers are left alone, unless `force` is set.
+func (p *printers) StopMatching(match func(name string) bool, force bool) []string {
+	// Collect the printers under the lock, and only signal them once it's released.
+	var names []string
+	var toStop []*printer
+	p.mu.Lock()
+	for k, v := range p.l {
+		if match(k) && (force || !v.pinned) {
+			v.stopping = true
+			names = append(names, k)
+			toStop = append(toStop, v)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, v := range toStop {
+		notify(v.done)
 	}
+	sort.Strings(names)
+	return names
 }
 
-type nameAndPeriod struct {
-	Name   string
-	Period int
+// StopAll signals every printer to stop, pinned or not, and waits up to `timeout` for their goroutines to exit.
+// It returns how many printers exited, and the names of the ones that were still running.
+func (p *printers) StopAll(timeout time.Duration) (stopped int, stuck []string) {
+	p.mu.Lock()
+	running := make(map[string]*printer, len(p.l))
+	for k, v := range p.l {
+		v.stopping = true
+		notify(v.done)
+		running[k] = v
+	}
+	p.mu.Unlock()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for k, v := range running {
+		select {
+		case <-v.exited:
+			stopped++
+		case <-deadline.C:
+			// Past the deadline, only count the goroutines that already exited.
+			for k, v := range running {
+				select {
+				case <-v.exited:
+					stopped++
+				default:
+					stuck = append(stuck, k)
+				}
+			}
+			sort.Strings(stuck)
+			return stopped, stuck
+		}
+		delete(running, k)
+	}
+	return stopped, nil
+}
+
+// Freeze stops every printer like StopAll, and makes Add fail until Unfreeze is called.
+func (p *printers) Freeze(timeout time.Duration) (stopped int, stuck []string) {
+	p.mu.Lock()
+	p.frozen = true
+	p.mu.Unlock()
+	return p.StopAll(timeout)
 }
 
-// NamesAndPeriods return the names and periods of the printers.
-func (p *printers) NamesAndPeriods() []nameAndPeriod {
-	var s []nameAndPeriod
+// Unfreeze lets Add launch printers again after Freeze.
+func (p *printers) Unfreeze() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.frozen = false
+}
+
+// Frozen reports whether the printers are frozen.
+func (p *printers) Frozen() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.frozen
+}
+
+// notify sends on a buffered channel without blocking if it was already signaled.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// printerInfo is a snapshot of a printer, used by the templates and the API.
+type printerInfo struct {
+	ID       int64             `json:"id"`
+	Name     string            `json:"name"`
+	Period   int               `json:"period"`
+	Color    string            `json:"color"`
+	Paused   bool              `json:"paused"`
+	Age      float64           `json:"age_seconds"`
+	Guard    string            `json:"guard,omitempty"`
+	Window   window            `json:"window"`
+	Cron     string            `json:"cron,omitempty"`
+	Priority int               `json:"priority,omitempty"`
+	Boosted  bool              `json:"boosted,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	// Next time the cron schedule fires, only for cron printers.
+	Next      *time.Time `json:"next,omitempty"`
+	LastTick  *time.Time `json:"last_tick,omitempty"`
+	Stalled   bool       `json:"stalled"`
+	Error     string     `json:"error,omitempty"`
+	Precise   bool       `json:"precise,omitempty"`
+	Dim       bool       `json:"dim,omitempty"`
+	Text      string     `json:"text"`
+	Align     bool       `json:"align,omitempty"`
+	Offset    int        `json:"offset,omitempty"`
+	Countdown bool       `json:"countdown,omitempty"`
+	Pinned    bool       `json:"pinned,omitempty"`
+	MinPeriod int        `json:"minperiod,omitempty"`
+	MaxPeriod int        `json:"maxperiod,omitempty"`
+	Mirror    string     `json:"mirror,omitempty"`
+	Sink      string     `json:"sink,omitempty"`
+	Cycle     bool       `json:"cycle,omitempty"`
+	Palette   []string   `json:"palette,omitempty"`
+	Every     int        `json:"printevery,omitempty"`
+	// Ticks counted, printed or not, as some aren't with printevery.
+	Ticked int64 `json:"ticks"`
+	// Sum of how late each tick was handled after it was due, the largest one,
+	// and the longest time between two ticks, more than the period when ticks
+	// were dropped.
+	Drift    float64 `json:"drift_seconds"`
+	MaxDrift float64 `json:"max_drift_seconds"`
+	MaxGap   float64 `json:"max_gap_seconds"`
+}
+
+// info returns a snapshot of the printer. The lock of the printers must be held.
+func (v *printer) info(name string, now time.Time) printerInfo {
+	info := printerInfo{
+		ID:        v.id,
+		Name:      name,
+		Period:    int(v.period / time.Second),
+		Color:     v.color,
+		Paused:    v.paused,
+		Age:       now.Sub(v.added).Seconds(),
+		Guard:     v.guard,
+		Window:    v.window,
+		Cron:      v.cron,
+		Priority:  v.priority,
+		Boosted:   v.boost != nil,
+		Fields:    v.fields,
+		Stalled:   v.stalled(now),
+		Error:     v.err,
+		Precise:   v.precise,
+		Dim:       v.dim,
+		Text:      v.text,
+		Align:     v.align,
+		Offset:    int(v.offset / time.Second),
+		Countdown: v.countdown,
+		Pinned:    v.pinned,
+		MinPeriod: int(v.minPeriod / time.Second),
+		MaxPeriod: int(v.maxPeriod / time.Second),
+		Mirror:    v.mirror,
+		Sink:      v.sink,
+		Cycle:     v.cycle,
+		Palette:   v.palette,
+		Every:     v.every,
+		Ticked:    v.ticked,
+		Drift:     v.drift.Seconds(),
+		MaxDrift:  v.maxDrift.Seconds(),
+		MaxGap:    v.maxGap.Seconds(),
+	}
+	if v.schedule != nil && !v.next.IsZero() {
+		next := v.next
+		info.Next = &next
+	}
+	if !v.lastTick.IsZero() {
+		last := v.lastTick
+		info.LastTick = &last
+	}
+	return info
+}
+
+// List returns a snapshot of the printers, sorted by name.
+func (p *printers) List() []printerInfo {
+	now := p.clock.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := make([]printerInfo, 0, len(p.l))
 	for k, v := range p.l {
-		s = append(s, nameAndPeriod{
-			Name:   k,
-			Period: v.period,
-		})
+		s = append(s, v.info(k, now))
 	}
+	sort.Slice(s, func(i, j int) bool { return s[i].Name < s[j].Name })
 	return s
 }
 
-// runPrinter creates a ticker that ticks every n seconds, and loops
-// infinitely on either it or `ch`.
-// If it received a tick, it prints `s` with a color, if it receives
-// anything in the channel it stops.
-func runPrinter(s string, n int, ch chan struct{}, color string) {
-	ticker := time.NewTicker(time.Duration(int64(n)) * time.Second)
-	defer ticker.Stop()
+// Get returns a snapshot of a printer, and false if there is no printer for this string.
+func (p *printers) Get(s string) (printerInfo, bool) {
+	now := p.clock.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	for {
-		select {
-		case <-ticker.C:
-			printWithTime(s, color)
-		case <-ch:
-			break
+	pr, ok := p.l[s]
+	if !ok {
+		return printerInfo{}, false
+	}
+	return pr.info(s, now), true
+}
+
+// lastLine is the last line printed by a printer on a tick.
+type lastLine struct {
+	// Nil until the printer ticked.
+	Line *string    `json:"line"`
+	Time *time.Time `json:"time"`
+}
+
+// Last returns the last line printed by a printer, and false if there is no
+// printer for this string.
+func (p *printers) Last(s string) (lastLine, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pr, ok := p.l[s]
+	if !ok {
+		return lastLine{}, false
+	}
+	if pr.lastLineAt.IsZero() {
+		return lastLine{}, true
+	}
+	line, at := pr.lastLine, pr.lastLineAt
+	return lastLine{Line: &line, Time: &at}, true
+}
+
+// Name returns the name of the printer with this id, and false if there is none.
+func (p *printers) Name(id int64) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	name, ok := p.ids[id]
+	return name, ok
+}
+
+// stats are counters about all the printers.
+type stats struct {
+	Printers   int     `json:"printers"`
+	Stalled    int     `json:"stalled"`
+	Uptime     float64 `json:"uptime_seconds"`
+	StopErrors int64   `json:"stop_errors_total"`
+	Frozen     bool    `json:"frozen"`
+	Draining   bool    `json:"draining"`
+	// Seconds left before the server shuts down, while draining.
+	DrainRemaining float64 `json:"drain_remaining_seconds,omitempty"`
+	Ticks          int64   `json:"ticks_total"`
+	Restarts       int64   `json:"restarts_total"`
+	// Ticks handled late enough for the system to have slept, see -resume.
+	Resumes int64 `json:"resumes_total"`
+	// Lines dropped and queued because of -maxrate.
+	Dropped int64 `json:"lines_dropped_total"`
+	Queued  int64 `json:"lines_queued_total"`
+	// Tick events dropped for the subscribers too slow to receive them, such as
+	// the shadow printers.
+	SubscriberDropped int64 `json:"subscriber_events_dropped_total"`
+	// Durations of the writes of the last lines of each printer.
+	WriteLatency map[string]latencySummary `json:"write_latency"`
+	// Counters of the -webhook, if any.
+	Webhook *webhookStats `json:"webhook,omitempty"`
+	// Counters of the -net sink, if any.
+	Net *netSinkStats `json:"net,omitempty"`
+}
+
+// Stats returns the current counters of the printers.
+func (p *printers) Stats() stats {
+	now := p.clock.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st := stats{
+		Printers:   len(p.l),
+		Uptime:     now.Sub(p.start).Seconds(),
+		StopErrors: p.stopErrors.Load(),
+		Frozen:     p.frozen,
+		Draining:   !p.drainUntil.IsZero(),
+		Ticks:      p.ticks.Load(),
+		Restarts:   p.restarts.Load(),
+		Resumes:    p.resumes.Load(),
+		Webhook:    p.webhook.Stats(),
+		Net:        p.net.Stats(),
+	}
+	st.SubscriberDropped = p.hub.Dropped()
+	if p.out != nil {
+		st.Dropped, st.Queued = p.out.Counts()
+		st.WriteLatency = p.out.latency.Summaries()
+	}
+	if st.Draining {
+		st.DrainRemaining = max(p.drainUntil.Sub(now), 0).Seconds()
+	}
+	for _, v := range p.l {
+		if v.stalled(now) {
+			st.Stalled++
 		}
 	}
+	return st
 }
 
-var start = time.Now()
+// setErr records the last error of a printer, or clears it if err is nil.
+func (p *printers) setErr(s string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-// printWithTime prints `s` prefix with the number of second since the start of the program.
-func printWithTime(s, color string) {
-	co := zli.ColorHex(color)
-	fmt.Printf("%04.0f %s\n", time.Since(start).Seconds(), zli.Colorize(s, co))
+	pr, ok := p.l[s]
+	if !ok {
+		return
+	}
+	if err != nil {
+		pr.err = err.Error()
+		p.errors.add("printer", s, err)
+	} else {
+		pr.err = ""
+	}
 }
 
-// Flag variable to choose the port.
-var port string
+// nextCron records the next time the cron schedule of a printer fires after `now`,
+// and returns how long to wait for it.
+func (p *printers) nextCron(pr *printer, now time.Time) time.Duration {
+	next := pr.schedule.Next(now)
+	p.mu.Lock()
+	pr.next = next
+	p.mu.Unlock()
+	return next.Sub(now)
+}
 
-func main() {
-	flag.StringVar(&port, "http", ":8080", "port")
-	flag.Parse()
+// anchor returns the time the ticks of a printer using a timer are counted from,
+// the next one being due one period after it: now, or for an aligned printer the
+// period before the next multiple of the period plus its offset. The offset is
+// taken modulo the period, which a boost may have shortened.
+func (pr *printer) anchor(now time.Time, d time.Duration) time.Time {
+	if !pr.align {
+		return now
+	}
+	next := now.Truncate(d).Add(pr.offset % d)
+	if !next.After(now) {
+		next = next.Add(d)
+	}
+	return next.Add(-d)
+}
+
+// Number of seconds of the countdown before each tick, one line for each.
+const countdownSteps = 3
+
+// How many ticks a precise printer catches up on, when it fell further behind
+// it starts again from the current time instead.
+const preciseCatchUp = 10
+
+// How late a tick must be handled to be taken as the system resuming from sleep.
+const sleepGap = 30 * time.Second
+
+// Policies accepted by -resume, for the tick handled when the system resumes:
+// print it right away, or skip it and print on the next one.
+var resumePolicies = []string{"catchup", "skip"}
+
+// runPrinter creates a ticker that ticks every `pr.period`, or a timer
+// following the cron schedule, and loops infinitely on either it or `pr.done`.
+// A precise printer uses a timer set to the absolute time of its next tick instead
+// of a ticker, so that the ticks it is late for are caught up on instead of dropped.
+// An aligned printer uses such a timer too, and skips the ticks it is late for
+// unless it is also precise. A printer with a random period resets a timer to a
+// new one after each tick.
+// A shadow printer ticks when the printer it mirrors prints.
+// If it received a tick, it prints `s` with a color, if it receives
+// anything in the channel it removes the printer from the list and stops.
+// Outside of its window or when its guard fails, the printer skips the tick.
+// A printer with a countdown also prints one in the seconds before each tick,
+// unless it is paused or outside of its window.
+func (p *printers) runPrinter(s string, pr *printer) {
+	close(pr.running)
+	period := func() time.Duration {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return pr.period
+	}
+	// A ticker panics on a period that isn't positive, and a timer would spin:
+	// fail is called instead, and the printer is removed on return.
+	fail := func(d time.Duration) {
+		err := fmt.Errorf("invalid period %s", d)
+		p.setErr(s, err)
+		slog.Error("stopping the printer", "name", s, "err", err)
+	}
+
+	defer func() {
+		p.mu.Lock()
+		// Only remove the entry if it is still ours.
+		removed := p.l[s] == pr
+		// The shadow printers go away with their source.
+		var shadows []*printer
+		if removed {
+			delete(p.l, s)
+			delete(p.ids, pr.id)
+			// Under the lock, so that a printer added with the same name is tracked.
+			p.out.latency.forget(s)
+			for _, v := range p.l {
+				if v.mirror == s && !v.stopping {
+					v.stopping = true
+					shadows = append(shadows, v)
+				}
+			}
+		}
+		pr.cancelBoost()
+		p.mu.Unlock()
+		close(pr.exited)
+		for _, v := range shadows {
+			notify(v.done)
+		}
+		if removed && !pr.ephemeral {
+			p.changed()
+			p.webhook.send(webhookEvent{Event: "stop", Name: s, Time: p.clock.Now()})
+		}
+	}()
 
-	myPrinters := printers{
-		l: make(map[string]printer),
+	if d := period(); pr.schedule == nil && pr.mirror == "" && d <= 0 {
+		fail(d)
+		return
+	}
+
+	// Fires for each step of the countdown, nil when none is scheduled.
+	var countdown <-chan time.Time
+	var countdownTimer Timer
+	// Steps of the countdown still to print.
+	var countdownLeft int
+	defer func() {
+		if countdownTimer != nil {
+			countdownTimer.Stop()
+		}
+	}()
+	// When the next tick is due, zero before the first one.
+	var expected time.Time
+	// scheduleCountdown records that the next tick is due at `next`, and schedules
+	// the countdown before it if there is enough time left for all of it.
+	scheduleCountdown := func(next time.Time) {
+		expected = next
+		if !pr.countdown {
+			return
+		}
+		if countdown != nil {
+			// Drop a step of the countdown of the previous tick.
+			select {
+			case <-countdown:
+			default:
+			}
+		}
+		countdown = nil
+		// With no time before the first step, the countdown would start on the
+		// previous tick, so there is none.
+		d := next.Add(-countdownSteps * time.Second).Sub(p.clock.Now())
+		if d <= 0 {
+			return
+		}
+		if countdownTimer == nil {
+			countdownTimer = p.clock.NewTimer(d)
+		} else {
+			countdownTimer.Reset(d)
+		}
+		countdown, countdownLeft = countdownTimer.C(), countdownSteps
 	}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			if err := r.ParseForm(); err != nil {
-				http.Error(w, "Error parsing form data", http.StatusBadRequest)
+	var tick <-chan time.Time
+	// Ticks of the source of a shadow printer, which has no timer of its own.
+	var mirrored <-chan tickEvent
+	var timer Timer
+	var ticker Ticker
+	// The n-th tick of a precise printer is due at anchor + n*period.
+	var anchor time.Time
+	var n int64
+	switch {
+	case pr.mirror != "":
+		sub := p.hub.subscribe(pr.mirror, 1)
+		defer p.hub.unsubscribe(sub)
+		mirrored = sub.C
+	case pr.schedule != nil:
+		now := p.clock.Now()
+		d := p.nextCron(pr, now)
+		timer = p.clock.NewTimer(d)
+		defer timer.Stop()
+		tick = timer.C()
+		scheduleCountdown(now.Add(d))
+	case pr.maxPeriod > 0:
+		d := pr.randomPeriod()
+		timer = p.clock.NewTimer(d)
+		defer timer.Stop()
+		tick = timer.C()
+		scheduleCountdown(p.clock.Now().Add(d))
+	case pr.precise || pr.align:
+		now := p.clock.Now()
+		anchor, n = pr.anchor(now, period()), 1
+		timer = p.clock.NewTimer(anchor.Add(period()).Sub(now))
+		defer timer.Stop()
+		tick = timer.C()
+		scheduleCountdown(anchor.Add(period()))
+	default:
+		ticker = p.clock.NewTicker(period())
+		defer ticker.Stop()
+		tick = ticker.C()
+		scheduleCountdown(p.clock.Now().Add(period()))
+	}
+
+	// printTick prints the tick due at `due` and handled at `now`, unless the
+	// printer is paused, outside of its window or its guard fails.
+	printTick := func(now, due time.Time) {
+		drift := p.clock.Now().Sub(due)
+		p.mu.Lock()
+		if !pr.lastTick.IsZero() {
+			pr.maxGap = max(pr.maxGap, now.Sub(pr.lastTick))
+		}
+		pr.lastTick = now
+		pr.drift += max(drift, 0)
+		pr.maxDrift = max(pr.maxDrift, drift)
+		// Can be changed by SetText, SetColor and SetPaused.
+		text, color, paused := pr.text, pr.color, pr.paused
+		p.mu.Unlock()
+		if paused || !pr.window.open(now) {
+			return
+		}
+		if pr.guard != "" {
+			err := runGuard(pr.guard)
+			p.setErr(s, err)
+			if err != nil {
 				return
 			}
+		}
+		p.mu.Lock()
+		pr.ticked++
+		skip := pr.every > 1 && pr.ticked%int64(pr.every) != 0
+		p.mu.Unlock()
+		if skip {
+			return
+		}
+		if pr.cycle {
+			p.mu.Lock()
+			palette := pr.palette
+			if len(palette) == 0 {
+				palette = defaultPalette(color)
+			}
+			color = palette[pr.cycled%len(palette)]
+			pr.cycled++
+			p.mu.Unlock()
+		}
+		p.ticks.Add(1)
+		l := line{
+			elapsed:  now.Sub(p.start),
+			at:       now,
+			name:     text,
+			printer:  s,
+			color:    color,
+			priority: pr.priority,
+			fields:   pr.fields,
+			dim:      pr.dim,
+			sink:     pr.sink,
+		}
+		p.out.print(l)
+		var last lastSink
+		printWithTime(&last, l, "plain", p.out.loc, "")
+		p.mu.Lock()
+		pr.lastLine, pr.lastLineAt = strings.TrimSuffix(last.plain, "\n"), now
+		p.mu.Unlock()
+		p.hub.publish(tickEvent{Name: s, Text: text, Time: now})
+		if !pr.ephemeral {
+			p.webhook.send(webhookEvent{Event: "tick", Name: s, Time: now})
+		}
+	}
 
-			// If there's a "stop" at true, it means a "stop" button was clicked,
-			// and thus we should try to stop a printer.
-			stop := r.FormValue("stop")
-			fmt.Printf("stop: %s\n", stop)
-			fmt.Printf("item: %s\n", r.FormValue("item"))
-			if stop == "true" {
-				item := r.FormValue("item")
-				if item != "" {
-					myPrinters.Stop(item)
+	for {
+		// Since when the loop waits, so that a tick late because of a slow guard
+		// isn't taken for the system sleeping.
+		waiting := p.clock.Now().Round(0)
+		select {
+		case now := <-tick:
+			// The ticker and the cron timer send the time they were due at.
+			due := now
+			// The timers don't count the time the system sleeps, the wall clock does.
+			received := p.clock.Now().Round(0)
+			late := received.Sub(expected.Round(0))
+			resumed := !expected.IsZero() && late > sleepGap && received.Sub(waiting) > sleepGap
+			switch {
+			case pr.schedule != nil:
+				d := p.nextCron(pr, now)
+				timer.Reset(d)
+				scheduleCountdown(now.Add(d))
+			case pr.maxPeriod > 0:
+				d := pr.randomPeriod()
+				timer.Reset(d)
+				scheduleCountdown(p.clock.Now().Add(d))
+			case pr.precise || pr.align:
+				d := period()
+				due = anchor.Add(time.Duration(n) * d)
+				n++
+				handled := p.clock.Now()
+				next := anchor.Add(time.Duration(n) * d)
+				if (!pr.precise && next.Before(handled)) || handled.Sub(next) > preciseCatchUp*d {
+					anchor, n = pr.anchor(handled, d), 1
+					next = anchor.Add(d)
+				}
+				// A negative duration fires right away, to catch up.
+				timer.Reset(next.Sub(handled))
+				scheduleCountdown(next)
+			default:
+				scheduleCountdown(now.Add(period()))
+			}
+			if resumed {
+				p.resumes.Add(1)
+				slog.Info("a tick is late, the system probably slept", "name", s, "late", late.Round(time.Second), "resume", p.resume)
+				if p.resume == "skip" {
+					continue
 				}
+			}
+			printTick(now, due)
+		case ev := <-mirrored:
+			printTick(ev.Time, ev.Time)
+		case now := <-countdown:
+			if countdownLeft > 1 {
+				countdownTimer.Reset(time.Second)
+			} else {
+				countdown = nil
+			}
+			p.mu.Lock()
+			text, color, paused := pr.text, pr.color, pr.paused
+			p.mu.Unlock()
+			step := countdownLeft
+			countdownLeft--
+			if paused || !pr.window.open(now) {
+				continue
+			}
+			p.out.print(line{
+				elapsed:  now.Sub(p.start),
+				at:       now,
+				name:     fmt.Sprintf("%s %d...", text, step),
+				printer:  s,
+				color:    color,
+				priority: pr.priority,
+				dim:      pr.dim,
+			})
+		case <-pr.reset:
+			if d := period(); pr.schedule == nil && pr.mirror == "" && d <= 0 {
+				fail(d)
 				return
 			}
-
-			// If we don't have a "stop" at true, this is probably a request to add
-			// a printer.
-			toPrint := r.FormValue("text")
-			if toPrint != "" {
-				period, err := strconv.Atoi(r.FormValue("period"))
-				if err != nil {
-					period = 1
+			switch {
+			case ticker != nil:
+				ticker.Reset(period())
+				scheduleCountdown(p.clock.Now().Add(period()))
+			case pr.maxPeriod > 0:
+				// Drop a tick that is due at the previous period.
+				select {
+				case <-tick:
+				default:
+				}
+				d := pr.randomPeriod()
+				timer.Reset(d)
+				scheduleCountdown(p.clock.Now().Add(d))
+			case pr.precise || pr.align:
+				// Drop a tick that is due at the previous period.
+				select {
+				case <-tick:
+				default:
 				}
-				myPrinters.Add(toPrint, period)
+				now := p.clock.Now()
+				anchor, n = pr.anchor(now, period()), 1
+				timer.Reset(anchor.Add(period()).Sub(now))
+				scheduleCountdown(anchor.Add(period()))
 			}
+		case <-pr.done:
+			return
+		}
+	}
+}
+
+// printWithTime prints the name of the line prefix with the number of second elapsed since
+// the start of the program, or the name and the fields as logfmt if the line has fields.
+// Names are validated when added, but are stripped again as a last line of defense
+// against writing escape sequences to the terminal. The color wraps the whole name,
+// and the prefix is ASCII, so its width is the same in bytes and in columns.
+//
+// The colored variant is formatted according to `format`, one of outFormats:
+// with ANSI escapes, without colors, or as HTML spans.
+// If `loc` isn't nil, the prefix is the time of the tick in this location instead.
+// In the colored variant, the prefix is dimmed if `prefixColor` is "dim", in its color
+// if it is one as #RRGGBB, and plain if it is empty, each region resetting its own style.
+// With the "ndjson" format, both variants are the line as a JSON object instead.
+func printWithTime(sk sink, l line, format string, loc *time.Location, prefixColor string) error {
+	if format == "ndjson" {
+		return printJSON(sk, l, loc)
+	}
+	s := stripUnsafe(l.name)
+	prefix := fmt.Sprintf("%04.0f ", l.elapsed.Seconds())
+	if loc != nil {
+		prefix = l.at.In(loc).Format(time.RFC3339) + " "
+	}
+
+	escape := func(t string) string { return t }
+	colorize := escape
+	coloredPrefix := prefix
+	switch format {
+	case "ansi":
+		co := hexColor(l.color)
+		if l.dim {
+			co |= zli.Faint
+		}
+		colorize = func(t string) string { return zli.Colorize(t, co) }
+		switch {
+		case prefixColor == "dim":
+			coloredPrefix = zli.Colorize(strings.TrimSuffix(prefix, " "), zli.Faint) + " "
+		case prefixColor != "":
+			coloredPrefix = zli.Colorize(strings.TrimSuffix(prefix, " "), hexColor(prefixColor)) + " "
+		}
+	case "html":
+		style := "color:" + l.color
+		if l.dim {
+			style += ";opacity:0.6"
+		}
+		escape = html.EscapeString
+		colorize = func(t string) string {
+			return `<span style="` + style + `">` + html.EscapeString(t) + "</span>"
+		}
+		switch {
+		case prefixColor == "dim":
+			coloredPrefix = `<span style="opacity:0.6">` + strings.TrimSuffix(prefix, " ") + "</span> "
+		case prefixColor != "":
+			coloredPrefix = `<span style="color:` + prefixColor + `">` + strings.TrimSuffix(prefix, " ") + "</span> "
+		}
+	}
+
+	if len(l.fields) > 0 {
+		colored, plain := logfmt(s, l.fields, colorize, escape)
+		return sk.Write(coloredPrefix+colored+"\n", prefix+plain+"\n")
+	}
+	return sk.Write(coloredPrefix+colorize(s)+"\n", prefix+s+"\n")
+}
 
-			// We render a partial template, the table, that will be switched out thanks to HTMX.
-			if err := printersTemplate.Execute(w, myPrinters.NamesAndPeriods()); err != nil {
-				http.Error(w, "Error rendering template", http.StatusInternalServerError)
+// Where the messages of the program that are not lines of the printers are
+// written, stderr when stdout is left to the lines as JSON.
+var messages io.Writer = os.Stdout
+
+// jsonLine is a line printed with the "ndjson" format.
+type jsonLine struct {
+	Time    time.Time         `json:"ts"`
+	Name    string            `json:"name"`
+	Elapsed float64           `json:"elapsed"`
+	Color   string            `json:"color"`
+	Dim     bool              `json:"dim,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// printJSON prints the line as a JSON object on a single line, with the time of
+// the tick in `loc`, or in UTC if it is nil. The JSON encoding escapes the
+// control characters, there is no need to strip them.
+func printJSON(sk sink, l line, loc *time.Location) error {
+	if loc == nil {
+		loc = time.UTC
+	}
+	b, err := json.Marshal(jsonLine{
+		Time:    l.at.In(loc),
+		Name:    l.name,
+		Elapsed: l.elapsed.Seconds(),
+		Color:   l.color,
+		Dim:     l.dim,
+		Fields:  l.fields,
+	})
+	if err != nil {
+		return err
+	}
+	s := string(b) + "\n"
+	return sk.Write(s, s)
+}
+
+// Printers launched by -demo.
+var demoPrinters = []spec{
+	{Name: "tick", Period: 1, Color: "#FF5F87"},
+	{Name: "tock", Period: 2, Color: "#5FD7FF"},
+	{Name: "ping", Period: 5, Color: "#AFFF5F"},
+}
+
+func main() {
+	cfg.register(flag.CommandLine)
+	flag.Parse()
+	if len(cfg.Listen) == 0 {
+		cfg.Listen = listenFlags{{addr: defaultListen}}
+	}
+
+	level := slog.LevelInfo
+	if cfg.Verbose {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	// zli already disables colors when stdout is not a terminal or NO_COLOR is set.
+	if cfg.NoColor {
+		zli.WantColor = false
+	} else if zli.WantColor && !enableColors() {
+		slog.Info("the console does not support colors, printing without them")
+		zli.WantColor = false
+	}
+	colorDepth = resolveColorDepth(cfg.ColorDepth, os.Getenv("COLORTERM"), os.Getenv("TERM"))
+
+	if cfg.ListColors {
+		names := flag.Args()
+		if len(names) == 0 {
+			var err error
+			if names, err = readLines(os.Stdin); err != nil {
+				fmt.Printf("Failed to read stdin: %s\n", err)
+				os.Exit(1)
 			}
-		} else {
-			// If it's not a post we render the "main" template.
-			if err := formTemplate.Execute(w, myPrinters.NamesAndPeriods()); err != nil {
-				http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		}
+		listColors(os.Stdout, names, cfg.ColorRules)
+		return
+	}
+
+	messages = messagesOut(&cfg, os.Stdout, os.Stderr)
+
+	// Every flag is checked before anything starts, and all the invalid ones are reported.
+	flagErrs, flagWarnings := cfg.validate()
+	for _, err := range flagErrs {
+		fmt.Fprintf(messages, "Invalid %s\n", err)
+	}
+	if len(flagErrs) > 0 {
+		os.Exit(2)
+	}
+	for _, w := range flagWarnings {
+		slog.Warn(w)
+	}
+	// Already validated, they can't fail.
+	base, _ := cleanBasePath(cfg.BasePath)
+	loc, _ := time.LoadLocation(cfg.TZ)
+	hookEvents, _ := parseWebhookEvents(cfg.WebhookEvents)
+	disabled, _ := parseDisable(cfg.Disable)
+
+	// The files were read by validate already, they only fail here if they
+	// changed since.
+	var ps presets
+	if cfg.PresetsFile != "" {
+		var err error
+		if ps, err = loadPresets(cfg.PresetsFile); err != nil {
+			fmt.Fprintf(messages, "Failed to load the presets: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	startupPrinters, warnings, err := startupSpecs(&cfg)
+	if err != nil {
+		fmt.Fprintf(messages, "Failed to import the printers: %s\n", err)
+		os.Exit(1)
+	}
+	for _, w := range warnings {
+		slog.Warn("skipping a line of the import file", "path", cfg.ImportFile, "error", w)
+	}
+
+	sinks := stdoutSinks(&cfg, os.Stdout)
+	if cfg.OutFile != "" {
+		f, err := openOut(cfg.OutFile, fifoOpenTimeout)
+		if err != nil {
+			fmt.Fprintf(messages, "Failed to open -out file: %s\n", err)
+			os.Exit(1)
+		}
+		var w io.WriteCloser = f
+		if cfg.OutMaxSize > 0 || cfg.OutMaxAge > 0 {
+			rf, err := newRotatingFile(f, cfg.OutFile, realClock{})
+			if err != nil {
+				slog.Warn("not rotating the -out file", "error", err)
+			} else {
+				rf.maxSize = int64(cfg.OutMaxSize) << 20
+				rf.maxAge = cfg.OutMaxAge
+				rf.maxBackups = cfg.OutMaxBackups
+				w = rf
 			}
 		}
-	})
+		defer w.Close()
+		sinks = append(sinks, writerSink{w: w})
+	}
+	if cfg.Syslog {
+		s, err := newSyslogSink()
+		if err != nil {
+			fmt.Fprintf(messages, "Failed to connect to syslog: %s\n", err)
+			os.Exit(1)
+		}
+		sinks = append(sinks, s)
+	}
+	clock := realClock{}
+	var ns *netSink
+	if cfg.Net != "" {
+		// Already validated, it can't fail.
+		network, addr, _ := parseNetAddr(cfg.Net)
+		ns = newNetSink(network, addr, clock)
+		sinks = append(sinks, ns)
+	}
+	named := make(map[string]sink)
+	for _, ns := range cfg.Sinks {
+		sk, err := openNamedSink(ns.target, clock)
+		if err != nil {
+			fmt.Fprintf(messages, "Failed to open the sink %s: %s\n", ns.name, err)
+			os.Exit(1)
+		}
+		if c, ok := sk.(io.Closer); ok {
+			defer c.Close()
+		}
+		named[ns.name] = sk
+	}
+
+	out := newOutput(sinks, clock, batchWindow)
+	out.named = named
+	out.limit = newLimiter(cfg.MaxRate, clock.Now())
+	out.overflow = cfg.Overflow
+	out.format = cfg.OutFormat
+	out.prefixColor = cfg.PrefixColor
+	errs := newErrorLog(errorLogSize, clock)
+	out.errors = errs
+	if ns != nil {
+		ns.errors = errs
+		go ns.run()
+	}
+	for _, sk := range named {
+		if ns, ok := sk.(*netSink); ok {
+			ns.errors = errs
+			go ns.run()
+		}
+	}
+	if cfg.Timestamps == "absolute" {
+		out.loc = loc
+	}
+	go out.run()
+	myPrinters := newPrinters(clock, out)
+	myPrinters.max = cfg.MaxPrinters
+	myPrinters.colorRules = cfg.ColorRules
+	myPrinters.normalize = cfg.Normalize
+	myPrinters.resume = cfg.Resume
+	myPrinters.disabled = disabled
+	myPrinters.errors = errs
+	myPrinters.net = ns
+	if cfg.Webhook != "" {
+		myPrinters.webhook = newWebhook(cfg.Webhook, hookEvents, clock)
+		myPrinters.webhook.errors = errs
+		go myPrinters.webhook.run()
+	}
+
+	var st *state
+	if cfg.StateFile != "" {
+		st = &state{path: cfg.StateFile, logger: slog.Default(), format: stateFormat(cfg.StateFormat, cfg.StateFile)}
+		specs, err := st.Load()
+		if err != nil {
+			fmt.Fprintf(messages, "Failed to load the state: %s\n", err)
+			os.Exit(1)
+		}
+		myPrinters.restore(specs, cfg.AllowExec)
+		// Only save once restored, so that a failed restore doesn't overwrite the file.
+		myPrinters.onChange = func() { st.Save(myPrinters.Specs) }
+	}
+	myPrinters.addStartup(startupPrinters, cfg.DefaultPeriod)
+
+	srv := &server{ready: new(atomic.Bool), printers: myPrinters, state: st, readOnly: cfg.ReadOnly, theme: cfg.Theme, apiOnly: cfg.APIOnly, basePath: base, presets: ps, auditLog: newAuditLog(auditSize), gzip: cfg.Gzip, drainGrace: cfg.DrainGrace, config: &cfg, maxBody: cfg.MaxBody, dupes: cfg.Dupes, debug: cfg.Debug, token: cfg.Token, readOpen: cfg.ReadonlyOpen, disabled: disabled}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// The end of a drain shuts the server down like a signal.
+	srv.quit = stop
+
+	if cfg.Supervise {
+		go myPrinters.supervise(ctx, superviseInterval)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go reloadOnSignal(ctx, hup, st, myPrinters)
+
+	// Every address is served by its own HTTP server, on the same printers.
+	httpServers := make([]*http.Server, len(cfg.Listen))
+	listeners := make([]net.Listener, len(cfg.Listen))
+	for i, la := range cfg.Listen {
+		httpServers[i] = srv.listenerServer(la, &cfg)
+
+		l, err := listen(la.addr, cfg.MaxConns)
+		if err != nil {
+			fmt.Fprintf(messages, "Failed to start server: %s\n", err)
+			os.Exit(1)
+		}
+		listeners[i] = l
+	}
+
+	// One line with what is configured, to check the flags at a glance.
+	addrs := make([]string, len(cfg.Listen))
+	for i, la := range cfg.Listen {
+		addrs[i] = la.String()
+	}
+	slog.Info("starting",
+		"listen", strings.Join(addrs, ","),
+		"readonly", cfg.ReadOnly,
+		"token", cfg.Token != "",
+		"printers", len(myPrinters.Specs()),
+		"presets", len(ps),
+		"state", cfg.StateFile,
+		"out", cfg.OutFile,
+		"outformat", cfg.OutFormat,
+		"stdout", !cfg.NoStdout,
+		"syslog", cfg.Syslog,
+		"net", cfg.Net,
+		"webhook", cfg.Webhook != "",
+		"maxrate", cfg.MaxRate,
+		"allowexec", cfg.AllowExec,
+		"debug", cfg.Debug,
+		"warnings", len(flagWarnings),
+	)
+
+	// Ready once the goroutines of the printers restored and given at startup run.
+	go srv.markReady(startTimeout)
+
+	errc := make(chan error, len(httpServers))
+	for i, httpServer := range httpServers {
+		mode := ""
+		if cfg.ReadOnly || cfg.Listen[i].readOnly {
+			mode = " (read-only)"
+		}
+		go func() {
+			fmt.Fprintf(messages, "Server is listening on http://%s%s/%s\n", listenHost(httpServer.Addr), base, mode)
+			errc <- httpServer.Serve(listeners[i])
+		}()
+	}
+
+	select {
+	case err := <-errc:
+		fmt.Fprintf(messages, "Failed to start server: %s\n", err)
+	case <-ctx.Done():
+		var flush func() error
+		if st != nil {
+			flush = func() error { return st.Flush(myPrinters.Specs) }
+		}
+		shutdown(httpServers, myPrinters, flush, slog.Default(), shutdownTimeout)
+	}
+}
+
+// listenHost returns the host and port to reach a listen address at, on
+// localhost when it has no host.
+func listenHost(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// startupSpecs returns the printers to add at startup: the ones of -printer, then
+// the ones of -demo and of -import. The printers added by -demo and -import are
+// not part of the configuration. It returns the lines of the import file that
+// were skipped as warnings.
+func startupSpecs(c *config) ([]spec, []error, error) {
+	specs := slices.Clone(c.Printers)
+	if c.Demo {
+		// They are added like the ones of -printer, and can be stopped the same way.
+		specs = append(specs, demoPrinters...)
+	}
+	var warnings []error
+	if c.ImportFile != "" {
+		imported, ws, err := loadImport(c.ImportFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		// They are added like the ones of -printer.
+		specs = append(specs, imported...)
+		warnings = ws
+	}
+	return specs, warnings, nil
+}
+
+// restore adds the printers saved in the state file, each shadow printer after
+// the one it mirrors whatever their order in the file. The ones with a guard are
+// skipped unless `allowExec` is set.
+func (p *printers) restore(specs []spec, allowExec bool) {
+	specs, err := sortMirrors(specs)
+	if err != nil {
+		fmt.Fprintf(messages, "Failed to restore printers: %s\n", err)
+	}
+	for _, sp := range specs {
+		if sp.Guard != "" && !allowExec {
+			fmt.Fprintf(messages, "Not restoring printer %s: guard commands are disabled, start the server with -allow-exec\n", sp.Name)
+			continue
+		}
+		if err := p.Add(sp); err != nil {
+			fmt.Fprintf(messages, "Failed to restore printer %s: %s\n", sp.Name, err)
+		}
+	}
+}
+
+// addStartup adds the printers given at startup, with the default period if they
+// have none. The ones that already exist are skipped.
+func (p *printers) addStartup(specs []spec, defaultPeriod int) {
+	for _, sp := range specs {
+		if sp.Period == 0 {
+			slog.Debug("using the default period", "name", sp.Name, "period", defaultPeriod)
+			sp.Period = defaultPeriod
+		}
+		// Printers restored from the state are given again at each start.
+		if err := p.Add(sp); err != nil && !errors.Is(err, ErrExists) {
+			fmt.Fprintf(messages, "Failed to add printer %s: %s\n", sp.Name, err)
+		}
+	}
+}
+
+func demoNames() string {
+	names := make([]string, len(demoPrinters))
+	for i, sp := range demoPrinters {
+		names[i] = sp.Name
+	}
+	return strings.Join(names, ", ")
+}
 
-	fmt.Printf("Server is listening on http://localhost%s\n", port)
-	if err := http.ListenAndServe(port, nil); err != nil {
-		fmt.Printf("Failed to start server: %s\n", err)
-	}
-}
-
-// Main template, with the form and the table.
-var formTemplate = template.Must(template.New("form").Parse(`
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Ticker</title>
-</head>
-<body>
-    <form hx-boost="true">
-        <label for="text">Text to print:</label><br>
-        <input type="text" id="text" name="text" required><br>
-		<label for="period">Every x seconds:</label><br>
-		<input type="number" id="number" name="period" min="1" value="1" required> <br>
-        <button hx-post="/" hx-target="#results">Launch a printer</button>
-    </form>
-	<div id="results">
-		<table>
-			<tr>
-				<th>Name</th>
-				<th>Period</th>
-				<th></th>
-			</tr>
-		{{range .}}
-			<tr>
-				<td>{{.Name}}</td>
-				<td>{{.Period}}</td>
-				<td><button hx-post="/" hx-vals='{"item": "{{.Name}}", "stop": true}' hx-target="#results">Stop</button></td>
-			</tr>
-		{{end}}
-		</table>
-	</div>
-	<script src="https://unpkg.com/htmx.org@1.9.2"
-        integrity="sha384-L6OqL9pRWyyFU3+/bjdSri+iIphTN/bvYyM37tICVyOJkWZLpP2vGn6VUEXgzg6h"
-        crossorigin="anonymous"></script>
-</body>
-</html>
-`))
-
-// "Partial" template, with only the table.
-var printersTemplate = template.Must(template.New("numbers").Parse(`
-<table>
-<tr>
-	<th>Name</th>
-	<th>Period</th>
-	<th></th>
-</tr>
-{{range .}}
-<tr>
-	<td>{{.Name}}</td>
-	<td>{{.Period}}</td>
-	<td><button hx-post="/" hx-vals='{"item": "{{.Name}}", "stop": true}' hx-target="#results">Stop</button></td>
-</tr>
-{{end}}
-</table>
-`))
+// Format of the colors, as produced by stringToColor.
+var colorRe = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
 
 // stringToColor takes a string, hashes it, and generates a bright color in hexadecimal format.
 // The same string always results in the same color.
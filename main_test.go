@@ -0,0 +1,741 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"zgo.at/zli"
+)
+
+func TestMain(m *testing.M) {
+	// The messages of the printers, such as "Stopping", and the logs aren't checked.
+	messages = io.Discard
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// testSink records the lines written to it, without colors.
+type testSink struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (s *testSink) Write(_, plain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, strings.TrimSuffix(plain, "\n"))
+	return nil
+}
+
+// Lines returns the lines written so far.
+func (s *testSink) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lines...)
+}
+
+// newTestPrinters returns printers using `clock`, writing their lines to the
+// returned sink. The output batches nothing and runs on the real clock, so
+// that the lines are written without advancing a fake clock. Every printer is
+// stopped at the end of the test.
+func newTestPrinters(t *testing.T, clock Clock) (*printers, *testSink) {
+	t.Helper()
+	sk := &testSink{}
+	out := newOutput(sk, realClock{}, 0)
+	out.format = "plain"
+	go out.run()
+	p := newPrinters(clock, out)
+	t.Cleanup(func() {
+		p.StopAll(5 * time.Second)
+		out.Close()
+	})
+	return p, sk
+}
+
+// newTestServer returns a server over the printers, as main sets it up
+// without any flag.
+func newTestServer(p *printers) *server {
+	ready := new(atomic.Bool)
+	ready.Store(true)
+	return &server{printers: p, ready: ready, auditLog: newAuditLog(auditSize), config: &config{}, dupes: "reject"}
+}
+
+// serve sends a request to the routes of the server and returns the recorded
+// response. A body is sent as JSON.
+func serve(t *testing.T, s *server, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, target, nil)
+	} else {
+		r = httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	s.routes().ServeHTTP(w, r)
+	return w
+}
+
+// waitFor fails the test if cond doesn't become true within a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// mustAdd adds the printers, and fails the test if one can't be.
+func mustAdd(t *testing.T, p *printers, specs ...spec) {
+	t.Helper()
+	for _, sp := range specs {
+		if err := p.Add(sp); err != nil {
+			t.Fatalf("adding %q: %v", sp.Name, err)
+		}
+	}
+}
+
+// withColors makes zli color the lines for the duration of the test, as if
+// they were written to a terminal.
+func withColors(t *testing.T) {
+	want := zli.WantColor
+	zli.WantColor = true
+	t.Cleanup(func() { zli.WantColor = want })
+}
+
+// withConfig sets the global configuration for the duration of the test.
+func withConfig(t *testing.T, c config) {
+	old := cfg
+	cfg = c
+	t.Cleanup(func() { cfg = old })
+}
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"plain", true},
+		{"with spaces", true},
+		{"héllo 世界", true},
+		{"\x1b[2J", false},
+		{"red\x1b[31m", false},
+		{"a\nb", false},
+		{"a\tb", false},
+		{"a\x7fb", false},
+		{"a\u0085b", false},
+		{"evil\u202edoc", false},
+		{"\xff", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if err := validateName(tt.name); (err == nil) != tt.ok {
+			t.Errorf("validateName(%q) = %v, want ok %t", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestRejectsEscapesInNames(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	s := newTestServer(p)
+	w := serve(t, s, http.MethodPost, "/api/printers/bulk", `[{"name": "\u001b[2J", "period": 1}]`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("bulk: status %d, want 400", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"text": {"\x1b[2J"}, "period": {"1"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	form := httptest.NewRecorder()
+	s.routes().ServeHTTP(form, r)
+	if form.Code != http.StatusBadRequest {
+		t.Errorf("form: status %d, want 400", form.Code)
+	}
+	if err := p.Add(spec{Name: "\x1b[2J", Period: 1}); err == nil {
+		t.Error("Add accepted the name")
+	}
+	if n := len(p.List()); n != 0 {
+		t.Errorf("%d printers, want none", n)
+	}
+}
+
+// colorSink records the colored variant of the lines.
+type colorSink struct{ colored []string }
+
+func (s *colorSink) Write(colored, _ string) error {
+	s.colored = append(s.colored, colored)
+	return nil
+}
+
+func TestPrintWithTimeStripsEscapes(t *testing.T) {
+	for _, format := range []string{"ansi", "plain", "html"} {
+		sk := &colorSink{}
+		l := line{name: "a\x1b[2Jb\u202e", color: "#ff0000"}
+		if err := printWithTime(sk, l, format, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+		if got := sk.colored[0]; strings.Contains(got, "\x1b[2J") || strings.Contains(got, "\u202e") || !strings.Contains(got, "a[2Jb") {
+			t.Errorf("%s: got %q, want the escape removed", format, got)
+		}
+	}
+}
+
+func TestStalled(t *testing.T) {
+	start := time.Date(2024, 3, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		pr   printer
+		at   time.Duration
+		want bool
+	}{
+		{"just started", printer{period: time.Second, started: start}, 2 * time.Second, false},
+		{"never ticked", printer{period: time.Second, started: start}, 3 * time.Second, true},
+		{"ticked recently", printer{period: time.Second, started: start, lastTick: start.Add(9 * time.Second)}, 10 * time.Second, false},
+		{"late", printer{period: time.Second, started: start, lastTick: start.Add(time.Second)}, 4 * time.Second, true},
+		{"paused", printer{period: time.Second, started: start, paused: true}, time.Hour, false},
+		{"shadow", printer{started: start, mirror: "a"}, time.Hour, false},
+		// A printer restarted by the supervisor counts from its restart.
+		{"restarted", printer{period: time.Second, started: start.Add(time.Minute), lastTick: start}, time.Minute + time.Second, false},
+	}
+	for _, tt := range tests {
+		if got := tt.pr.stalled(start.Add(tt.at)); got != tt.want {
+			t.Errorf("%s: stalled %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStalledPrinters(t *testing.T) {
+	withConfig(t, config{AllowExec: true})
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	started := filepath.Join(t.TempDir(), "started")
+	mustAdd(t, p,
+		spec{Name: "healthy", Period: 1},
+		spec{Name: "paused", Period: 1},
+		// Its goroutine is wedged in the guard once it ticked.
+		spec{Name: "wedged", Period: 1, Guard: "touch " + started + "; sleep 1"},
+	)
+	if err := p.SetPaused("paused", true); err != nil {
+		t.Fatal(err)
+	}
+	waitTimers(t, c, 3)
+	tick(t, c, time.Second, sk, 1)
+	waitFor(t, "the guard", func() bool {
+		_, err := os.Stat(started)
+		return err == nil
+	})
+
+	for i := 2; i <= 4; i++ {
+		tick(t, c, time.Second, sk, i)
+		if info, _ := p.Get("healthy"); info.Stalled || info.LastTick == nil || !info.LastTick.Equal(c.Now()) {
+			t.Fatalf("healthy: stalled %t and last tick %v, want not stalled and ticked now", info.Stalled, info.LastTick)
+		}
+	}
+	for name, want := range map[string]bool{"healthy": false, "paused": false, "wedged": true} {
+		if info, _ := p.Get(name); info.Stalled != want {
+			t.Errorf("%s: stalled %t, want %t", name, info.Stalled, want)
+		}
+	}
+	if st := p.Stats(); st.Stalled != 1 {
+		t.Errorf("%d stalled printers in the stats, want 1", st.Stalled)
+	}
+}
+
+// printerGoroutines returns the number of goroutines running a printer.
+func printerGoroutines() int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return strings.Count(string(buf[:n]), ".(*printers).runPrinter(")
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+func TestStopAddStress(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				// Both can fail, when the other goroutines got there first.
+				p.Add(spec{Name: "flaky", Period: 1})
+				p.Stop("flaky", false)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := p.Add(spec{Name: "flaky", Period: 1}); err != nil && !errors.Is(err, ErrExists) {
+		t.Fatal(err)
+	}
+	// The stopped goroutines may not have returned yet, nor the new one have started.
+	waitFor(t, "a single goroutine", func() bool { return printerGoroutines() == 1 })
+	time.Sleep(10 * time.Millisecond)
+	if n := printerGoroutines(); n != 1 {
+		t.Errorf("%d goroutines run the printer, want 1", n)
+	}
+	if n := len(p.List()); n != 1 {
+		t.Errorf("%d printers, want 1", n)
+	}
+}
+
+func TestResync(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "a", Period: 2})
+	waitTimers(t, c, 1)
+	c.Advance(time.Second)
+	mustAdd(t, p, spec{Name: "b", Period: 2}, spec{Name: "cron", Cron: "* * * * *"})
+	waitTimers(t, c, 3)
+
+	// Out of phase: a ticks at +2s and b at +3s.
+	tick(t, c, time.Second, sk, 1)
+	tick(t, c, time.Second, sk, 2)
+	w := serve(t, newTestServer(p), http.MethodPost, "/api/resync", "")
+	if got := strings.TrimSpace(w.Body.String()); got != `{"resynced":2}` {
+		t.Errorf("got %s, want the two printers with a period resynced", got)
+	}
+	// The printers reset their ticker once they received the signal.
+	due := c.Now().Add(2 * time.Second)
+	waitFor(t, "the tickers to reset", func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		n := 0
+		for _, ft := range c.timers {
+			if ft.active && ft.period == 2*time.Second && ft.at.Equal(due) {
+				n++
+			}
+		}
+		return n == 2
+	})
+
+	c.Advance(time.Second)
+	time.Sleep(10 * time.Millisecond)
+	if n := len(sk.Lines()); n != 2 {
+		t.Errorf("%d lines a second after the resync, want none printed", n-2)
+	}
+	tick(t, c, time.Second, sk, 4)
+	got := sk.Lines()[2:]
+	sort.Strings(got)
+	if got[0] != "0005 a" || got[1] != "0005 b" {
+		t.Errorf("got %q, want a and b together", got)
+	}
+}
+
+func TestPrintWithTimeUnicode(t *testing.T) {
+	withColors(t)
+	names := []string{"日本語", "🎉 party", "👩‍💻 dev", "e\u0301te", "🇫🇷"}
+	for _, name := range names {
+		sk := &colorSink{}
+		l := line{elapsed: 3 * time.Second, name: name, color: "#FF8800"}
+		if err := printWithTime(sk, l, "ansi", nil, ""); err != nil {
+			t.Fatal(err)
+		}
+		got := sk.colored[0]
+		if want := "0003 " + zli.Colorize(name, hexColor("#FF8800")) + "\n"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("%q isn't valid UTF-8", got)
+		}
+		// The escape is right before the name, and the reset right after.
+		if i := strings.Index(got, name); i < 0 || got[i-1] != 'm' || !strings.HasPrefix(got[i+len(name):], "\x1b[0m") {
+			t.Errorf("the colors don't wrap %q in %q", name, got)
+		}
+	}
+
+	// Invalid bytes are replaced, so that the reset isn't swallowed.
+	sk := &colorSink{}
+	if err := printWithTime(sk, line{name: "a\xffb"}, "ansi", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := sk.colored[0]; !utf8.ValidString(got) || !strings.Contains(got, "a\uFFFDb") {
+		t.Errorf("got %q, want the invalid byte replaced", got)
+	}
+}
+
+func TestPrintWithTimePrefixColor(t *testing.T) {
+	withColors(t)
+	name := zli.Colorize("a", hexColor("#FF8800"))
+	tests := []struct {
+		format, prefixColor string
+		want                string
+	}{
+		{"ansi", "", "0003 " + name + "\n"},
+		{"ansi", "dim", zli.Colorize("0003", zli.Faint) + " " + name + "\n"},
+		{"ansi", "#00FF00", zli.Colorize("0003", hexColor("#00FF00")) + " " + name + "\n"},
+		{"html", "", `0003 <span style="color:#FF8800">a</span>` + "\n"},
+		{"html", "dim", `<span style="opacity:0.6">0003</span> <span style="color:#FF8800">a</span>` + "\n"},
+		{"html", "#00FF00", `<span style="color:#00FF00">0003</span> <span style="color:#FF8800">a</span>` + "\n"},
+		{"plain", "#00FF00", "0003 a\n"},
+	}
+	for _, tt := range tests {
+		sk := &bothSink{}
+		l := line{elapsed: 3 * time.Second, name: "a", color: "#FF8800"}
+		if err := printWithTime(sk, l, tt.format, nil, tt.prefixColor); err != nil {
+			t.Fatal(err)
+		}
+		if sk.colored != tt.want {
+			t.Errorf("%s %q: got %q, want %q", tt.format, tt.prefixColor, sk.colored, tt.want)
+		}
+		// Each region resets its own style, so the prefix doesn't bleed into the name.
+		if tt.format == "ansi" && tt.prefixColor != "" && !strings.HasPrefix(sk.colored[strings.Index(sk.colored, "0003")+4:], "\x1b[0m ") {
+			t.Errorf("%s %q: no reset after the prefix in %q", tt.format, tt.prefixColor, sk.colored)
+		}
+		if sk.plain != "0003 a\n" {
+			t.Errorf("%s %q: got the plain variant %q, want it without styles", tt.format, tt.prefixColor, sk.plain)
+		}
+	}
+}
+
+func TestStopResults(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 60}, spec{Name: "pinned", Period: 60, Pinned: true})
+
+	tests := []struct {
+		name  string
+		force bool
+		want  stopResult
+	}{
+		{"missing", false, stopNotFound},
+		{"pinned", false, stopPinned},
+		{"pinned", true, stopped},
+	}
+	for _, tt := range tests {
+		if got := p.Stop(tt.name, tt.force); got != tt.want {
+			t.Errorf("Stop(%q, %t) = %s, want %s", tt.name, tt.force, got, tt.want)
+		}
+	}
+
+	// Of concurrent stops of the same printer, only one stops it.
+	results := make(chan stopResult, 10)
+	var wg sync.WaitGroup
+	for range cap(results) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- p.Stop("a", false)
+		}()
+	}
+	wg.Wait()
+	close(results)
+	counts := map[stopResult]int{}
+	for r := range results {
+		counts[r]++
+	}
+	// The others find it stopping, or already gone once its goroutine exited.
+	if counts[stopped] != 1 || counts[stopAlreadyStopping]+counts[stopNotFound] != cap(results)-1 {
+		t.Errorf("got %v, want a single stop", counts)
+	}
+	if got, want := p.Stats().StopErrors, int64(2+cap(results)-1); got != want {
+		t.Errorf("%d stop errors, want %d", got, want)
+	}
+}
+
+func TestPreciseUnderLoad(t *testing.T) {
+	withConfig(t, config{AllowExec: true})
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	dir := t.TempDir()
+	// The guard is the load, keeping each printer busy for a while after each tick.
+	guard := func(name string) string {
+		return "touch " + filepath.Join(dir, name) + "; sleep 0.2"
+	}
+	mustAdd(t, p,
+		spec{Name: "ticker", Period: 1, Guard: guard("ticker")},
+		spec{Name: "precise", Period: 1, Precise: true, Guard: guard("precise")},
+	)
+	waitTimers(t, c, 2)
+	c.Advance(time.Second)
+	waitFor(t, "the guards", func() bool {
+		_, err1 := os.Stat(filepath.Join(dir, "ticker"))
+		_, err2 := os.Stat(filepath.Join(dir, "precise"))
+		return err1 == nil && err2 == nil
+	})
+	// Two more periods pass while the printers are busy.
+	c.Advance(time.Second)
+	c.Advance(time.Second)
+
+	lines := func(name string) []string {
+		var l []string
+		for _, line := range sk.Lines() {
+			if strings.HasSuffix(line, " "+name) {
+				l = append(l, line)
+			}
+		}
+		return l
+	}
+	waitFor(t, "the precise printer to catch up", func() bool {
+		// Fires the timers reset to catch up, which are due now.
+		c.Advance(0)
+		return len(lines("precise")) == 3 && len(lines("ticker")) == 2
+	})
+	time.Sleep(300 * time.Millisecond)
+	c.Advance(0)
+
+	// The ticker drops the tick it couldn't deliver, the timer prints every one.
+	if got := lines("ticker"); !slices.Equal(got, []string{"0001 ticker", "0002 ticker"}) {
+		t.Errorf("ticker printed %q, want the third tick dropped", got)
+	}
+	if got := lines("precise"); !slices.Equal(got, []string{"0001 precise", "0002 precise", "0003 precise"}) {
+		t.Errorf("precise printed %q, want every tick", got)
+	}
+	// Both handled the second tick a period late.
+	for _, name := range []string{"ticker", "precise"} {
+		if info, _ := p.Get(name); info.Drift != 1 || info.MaxDrift != 1 {
+			t.Errorf("%s: drift %gs and max %gs, want 1s", name, info.Drift, info.MaxDrift)
+		}
+	}
+}
+
+func TestPrintWithTimeDim(t *testing.T) {
+	withColors(t)
+	for _, dim := range []bool{false, true} {
+		sk := &colorSink{}
+		if err := printWithTime(sk, line{name: "quiet", color: "#FF8800", dim: dim}, "ansi", nil, ""); err != nil {
+			t.Fatal(err)
+		}
+		got := sk.colored[0]
+		want := hexColor("#FF8800")
+		if dim {
+			want |= zli.Faint
+		}
+		if got != "0000 "+zli.Colorize("quiet", want)+"\n" {
+			t.Errorf("dim %t: got %q", dim, got)
+		}
+		// The faint attribute is SGR 2, in the escape with the color.
+		if faint := strings.Contains(got, "\x1b[2;38;2;255;136;0m"); faint != dim {
+			t.Errorf("dim %t: faint attribute in %q is %t", dim, got, faint)
+		}
+	}
+}
+
+func TestInvalidComputedPeriod(t *testing.T) {
+	c := newFakeClock()
+	p, _ := newTestPrinters(t, c)
+	p.errors = newErrorLog(errorLogSize, c)
+	mustAdd(t, p, spec{Name: "bad", Period: 1}, spec{Name: "good", Period: 1})
+	waitTimers(t, c, 2)
+
+	// A period that slipped through, such as a miscomputed boost.
+	p.mu.Lock()
+	pr := p.l["bad"]
+	pr.period = 0
+	notify(pr.reset)
+	p.mu.Unlock()
+	<-pr.exited
+
+	if _, ok := p.Get("bad"); ok {
+		t.Error("the failed printer is still listed")
+	}
+	if _, ok := p.Get("good"); !ok {
+		t.Error("the other printer is gone")
+	}
+	events := p.errors.Events()
+	if len(events) != 1 || events[0].Name != "bad" || events[0].Message != "invalid period 0s" {
+		t.Errorf("got the errors %+v, want the invalid period of bad", events)
+	}
+}
+
+func TestPrintWithTimeHTML(t *testing.T) {
+	tests := []struct {
+		name        string
+		l           line
+		prefixColor string
+		want        string
+	}{
+		{"span", line{name: "demo", color: "#FF8800"}, "", `0000 <span style="color:#FF8800">demo</span>`},
+		{"escaped", line{name: `<b>&"x"`, color: "#FF8800"}, "", `0000 <span style="color:#FF8800">&lt;b&gt;&amp;&#34;x&#34;</span>`},
+		{"dim", line{name: "quiet", color: "#FF8800", dim: true}, "", `0000 <span style="color:#FF8800;opacity:0.6">quiet</span>`},
+		{"dim prefix", line{name: "demo", color: "#FF8800"}, "dim", `<span style="opacity:0.6">0000</span> <span style="color:#FF8800">demo</span>`},
+		{"colored prefix", line{name: "demo", color: "#FF8800"}, "#00FF00", `<span style="color:#00FF00">0000</span> <span style="color:#FF8800">demo</span>`},
+		{
+			"fields",
+			line{name: "<a>", color: "#FF8800", fields: map[string]string{"k": "<v>"}},
+			"",
+			`0000 <span style="color:#FF8800">name</span>=&lt;a&gt; <span style="color:#FF8800">k</span>=&lt;v&gt;`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sk := &colorSink{}
+			if err := printWithTime(sk, tt.l, "html", nil, tt.prefixColor); err != nil {
+				t.Fatal(err)
+			}
+			if got := sk.colored[0]; got != tt.want+"\n" {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintWithTimeTZ(t *testing.T) {
+	tests := []struct {
+		zone string
+		want string
+	}{
+		{"UTC", "2024-03-18T12:00:01Z demo"},
+		{"Asia/Tokyo", "2024-03-18T21:00:01+09:00 demo"},
+		{"America/New_York", "2024-03-18T08:00:01-04:00 demo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.zone, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := newFakeClock()
+			p, sk := newTestPrinters(t, c)
+			p.out.loc = loc
+			mustAdd(t, p, spec{Name: "demo", Period: 1})
+			waitTimers(t, c, 1)
+			tick(t, c, time.Second, sk, 1)
+			if got := sk.Lines()[0]; got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(p *printers) error
+		want error
+	}{
+		{"add existing", func(p *printers) error { return p.Add(spec{Name: "a", Period: 1}) }, ErrExists},
+		{"add past the limit", func(p *printers) error {
+			p.max = 2
+			return p.Add(spec{Name: "b", Period: 1})
+		}, ErrLimit},
+		{"add zero period", func(p *printers) error { return p.Add(spec{Name: "b"}) }, ErrInvalidPeriod},
+		{"add bad random periods", func(p *printers) error { return p.Add(spec{Name: "b", MinPeriod: 5, MaxPeriod: 2}) }, ErrInvalidPeriod},
+		{"add missing source", func(p *printers) error { return p.Add(spec{Name: "b", Mirror: "missing"}) }, ErrNotFound},
+		{"add frozen", func(p *printers) error {
+			p.Freeze(time.Second)
+			return p.Add(spec{Name: "b", Period: 1})
+		}, ErrFrozen},
+		{"add draining", func(p *printers) error {
+			p.Drain(time.Minute, func() {})
+			return p.Add(spec{Name: "b", Period: 1})
+		}, ErrDraining},
+		{"add disabled", func(p *printers) error {
+			p.disabled = map[string]bool{"guard": true}
+			return p.Add(spec{Name: "b", Period: 1, Guard: "true"})
+		}, ErrDisabled},
+		{"set period missing", func(p *printers) error { return p.SetPeriod("missing", time.Second) }, ErrNotFound},
+		{"set period zero", func(p *printers) error { return p.SetPeriod("a", 0) }, ErrInvalidPeriod},
+		{"set period cron", func(p *printers) error { return p.SetPeriod("cron", time.Second) }, ErrInvalidPeriod},
+		{"set period matching zero", func(p *printers) error {
+			_, err := p.SetPeriodMatching(func(string) bool { return true }, 0)
+			return err
+		}, ErrInvalidPeriod},
+		{"boost missing", func(p *printers) error { return p.Boost("missing", time.Second, time.Minute) }, ErrNotFound},
+		{"boost cron", func(p *printers) error { return p.Boost("cron", time.Second, time.Minute) }, ErrInvalidPeriod},
+		{"set text missing", func(p *printers) error { return p.SetText("missing", "x") }, ErrNotFound},
+		{"set color missing", func(p *printers) error { return p.SetColor("missing", "#000000") }, ErrNotFound},
+		{"set pinned missing", func(p *printers) error { return p.SetPinned("missing", true) }, ErrNotFound},
+		{"set paused missing", func(p *printers) error { return p.SetPaused("missing", true) }, ErrNotFound},
+		{"restart missing", func(p *printers) error { return p.Restart("missing") }, ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPrinters(t, newFakeClock())
+			mustAdd(t, p, spec{Name: "a", Period: 60}, spec{Name: "cron", Cron: "* * * * *"})
+			if err := tt.call(p); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintJSON(t *testing.T) {
+	at := time.Date(2024, 3, 18, 12, 0, 5, 0, time.UTC)
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		l    line
+		loc  *time.Location
+		want string
+	}{
+		{"line", line{name: "demo", color: "#FF8800", at: at, elapsed: 5 * time.Second}, nil,
+			`{"ts":"2024-03-18T12:00:05Z","name":"demo","elapsed":5,"color":"#FF8800"}`},
+		{"dim and fields", line{name: "demo", color: "#FF8800", at: at, elapsed: 1500 * time.Millisecond, dim: true, fields: map[string]string{"k": "v"}}, nil,
+			`{"ts":"2024-03-18T12:00:05Z","name":"demo","elapsed":1.5,"color":"#FF8800","dim":true,"fields":{"k":"v"}}`},
+		{"time zone", line{name: "demo", color: "#FF8800", at: at}, paris,
+			`{"ts":"2024-03-18T13:00:05+01:00","name":"demo","elapsed":0,"color":"#FF8800"}`},
+		{"escapes", line{name: "a\x1b[2J\"b", color: "#FF8800", at: at}, nil,
+			`{"ts":"2024-03-18T12:00:05Z","name":"a\u001b[2J\"b","elapsed":0,"color":"#FF8800"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sk := &bothSink{}
+			if err := printWithTime(sk, tt.l, "ndjson", tt.loc, "dim"); err != nil {
+				t.Fatal(err)
+			}
+			// Colors are data, both variants are the same JSON.
+			if sk.colored != tt.want+"\n" || sk.plain != sk.colored {
+				t.Errorf("got %q and %q, want %q", sk.colored, sk.plain, tt.want)
+			}
+			var v map[string]any
+			if err := json.Unmarshal([]byte(sk.plain), &v); err != nil {
+				t.Errorf("invalid JSON: %s", err)
+			}
+		})
+	}
+}
+
+// bothSink keeps both variants of the last line written to it.
+type bothSink struct{ colored, plain string }
+
+func (s *bothSink) Write(colored, plain string) error {
+	s.colored, s.plain = colored, plain
+	return nil
+}
+
+func TestNDJSONOutput(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	p.out.format = "ndjson"
+	mustAdd(t, p, spec{Name: "a", Period: 1, Color: "#112233"}, spec{Name: "b", Period: 2, Color: "#445566"})
+	waitTimers(t, c, 2)
+	tick(t, c, time.Second, sk, 1)
+	tick(t, c, time.Second, sk, 3)
+	for _, l := range sk.Lines() {
+		var got jsonLine
+		if err := json.Unmarshal([]byte(l), &got); err != nil {
+			t.Fatalf("%q: %s", l, err)
+		}
+		want := map[string]string{"a": "#112233", "b": "#445566"}[got.Name]
+		if want == "" || got.Color != want || got.Elapsed < 1 || !got.Time.Equal(p.start.Add(time.Duration(got.Elapsed)*time.Second)) {
+			t.Errorf("got %+v", got)
+		}
+	}
+}
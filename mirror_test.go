@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitSubscribers waits for the hub to have n subscribers, such as the shadow
+// printers once their goroutine started.
+func waitSubscribers(t *testing.T, h *hub, n int) {
+	t.Helper()
+	waitFor(t, "the subscribers", func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return len(h.subs) >= n
+	})
+}
+
+func TestMirror(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "source", Period: 2}, spec{Name: "shadow", Mirror: "source"}, spec{Name: "other", Period: 3})
+	waitTimers(t, c, 2)
+	waitSubscribers(t, p.hub, 1)
+	// The shadow printer has no ticker of its own.
+	if n := c.Active(); n != 2 {
+		t.Errorf("%d timers, want the ones of the source and other printers", n)
+	}
+
+	for i := 1; i <= 6; i++ {
+		// Two lines on each tick of the source, one on each of other.
+		tick(t, c, time.Second, sk, 2*(i/2)+i/3)
+	}
+	time.Sleep(10 * time.Millisecond)
+	got := sk.Lines()
+	var source, shadow []string
+	for _, l := range got {
+		at, name, _ := strings.Cut(l, " ")
+		switch name {
+		case "source":
+			source = append(source, at)
+		case "shadow":
+			shadow = append(shadow, at)
+		}
+	}
+	if !slices.Equal(source, []string{"0002", "0004", "0006"}) || !slices.Equal(shadow, source) {
+		t.Errorf("got %q, want the shadow printer on every tick of the source, and only then", got)
+	}
+}
+
+func TestMirrorStopsWithSource(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "source", Period: 60}, spec{Name: "shadow", Mirror: "source"}, spec{Name: "shadow2", Mirror: "shadow"})
+	s := newTestServer(p)
+
+	w := serve(t, s, http.MethodGet, "/api/printers/shadow", "")
+	if !strings.Contains(w.Body.String(), `"mirror":"source"`) {
+		t.Errorf("no source in %s", w.Body)
+	}
+	// Stopping a shadow printer leaves its source.
+	if w := serve(t, s, http.MethodDelete, "/api/printers/shadow2", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	waitFor(t, "the shadow printer to stop", func() bool { _, ok := p.Get("shadow2"); return !ok })
+	if _, ok := p.Get("shadow"); !ok {
+		t.Fatal("the source stopped with its shadow printer")
+	}
+	mustAdd(t, p, spec{Name: "shadow2", Mirror: "shadow"})
+	// Stopping the source stops its shadow printers, and theirs.
+	if w := serve(t, s, http.MethodDelete, "/api/printers/source", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	waitFor(t, "the shadow printers to stop", func() bool { return len(p.List()) == 0 })
+}
+
+func TestMirrorValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		sp   spec
+	}{
+		{"itself", spec{Name: "self", Mirror: "self"}},
+		{"missing source", spec{Name: "b", Mirror: "missing"}},
+		{"with cron", spec{Name: "b", Mirror: "a", Cron: "* * * * *"}},
+		{"with precise", spec{Name: "b", Mirror: "a", Precise: true}},
+		{"with a random period", spec{Name: "b", Mirror: "a", MinPeriod: 1, MaxPeriod: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			mustAdd(t, p, spec{Name: "a", Period: 60})
+			if err := p.Add(tt.sp); err == nil {
+				t.Errorf("added %+v", tt.sp)
+			}
+		})
+	}
+}
+
+func TestSortMirrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []spec
+		want  []string
+		cycle bool
+	}{
+		{"no mirrors", []spec{{Name: "a"}, {Name: "b"}}, []string{"a", "b"}, false},
+		{"source after", []spec{{Name: "c", Mirror: "b"}, {Name: "b", Mirror: "a"}, {Name: "a"}}, []string{"a", "b", "c"}, false},
+		{"missing source last", []spec{{Name: "b", Mirror: "missing"}, {Name: "a"}}, []string{"a", "b"}, false},
+		{"cycle left out", []spec{{Name: "a", Mirror: "b"}, {Name: "b", Mirror: "a"}, {Name: "c"}}, []string{"c"}, true},
+		{"mirroring a cycle", []spec{{Name: "a", Mirror: "b"}, {Name: "b", Mirror: "a"}, {Name: "c", Mirror: "a"}}, []string{"c"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted, err := sortMirrors(tt.specs)
+			var got []string
+			for _, sp := range sorted {
+				got = append(got, sp.Name)
+			}
+			if !slices.Equal(got, tt.want) || (err != nil) != tt.cycle {
+				t.Errorf("got %q and %v, want %q and a cycle %t", got, err, tt.want, tt.cycle)
+			}
+		})
+	}
+}
+
+func TestRestoreMirrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		saved []spec
+		// Printers restored, and lines on the tick of the source.
+		want  []string
+		lines int
+	}{
+		{"in order", []spec{{Name: "source", Period: 1}, {Name: "shadow", Mirror: "source"}}, []string{"shadow", "source"}, 2},
+		{"reversed", []spec{{Name: "shadow", Mirror: "source"}, {Name: "source", Period: 1}}, []string{"shadow", "source"}, 2},
+		{"chain reversed", []spec{{Name: "shadow2", Mirror: "shadow"}, {Name: "shadow", Mirror: "source"}, {Name: "source", Period: 1}}, []string{"shadow", "shadow2", "source"}, 3},
+		{"missing source", []spec{{Name: "shadow", Mirror: "missing"}, {Name: "source", Period: 1}}, []string{"source"}, 1},
+		{"cycle", []spec{{Name: "a", Mirror: "b"}, {Name: "b", Mirror: "a"}, {Name: "source", Period: 1}}, []string{"source"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state.json")
+			st := &state{path: path, logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)), format: "json"}
+			if _, err := st.write(tt.saved); err != nil {
+				t.Fatal(err)
+			}
+			specs, err := st.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := newFakeClock()
+			p, sk := newTestPrinters(t, c)
+			p.restore(specs, false)
+
+			var names []string
+			for _, info := range p.List() {
+				names = append(names, info.Name)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.want) {
+				t.Fatalf("restored %q, want %q", names, tt.want)
+			}
+			waitTimers(t, c, 1)
+			waitSubscribers(t, p.hub, len(tt.want)-1)
+			tick(t, c, time.Second, sk, tt.lines)
+			time.Sleep(10 * time.Millisecond)
+			if got := sk.Lines(); len(got) != tt.lines {
+				t.Errorf("got %q, want %d lines", got, tt.lines)
+			}
+		})
+	}
+}
+
+func TestReconcileMirrors(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "source", Period: 60})
+	_, errs := p.Reconcile([]spec{{Name: "shadow", Mirror: "source"}, {Name: "source", Period: 30}, {Name: "a", Mirror: "b"}, {Name: "b", Mirror: "a"}})
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "a -> b -> a") {
+		t.Errorf("got the errors %v, want the cycle of a and b", errs)
+	}
+	waitFor(t, "the printers", func() bool {
+		var names []string
+		for _, info := range p.List() {
+			names = append(names, info.Name)
+		}
+		slices.Sort(names)
+		return slices.Equal(names, []string{"shadow", "source"})
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Number of lines waiting to be sent to -net, the ones past it are dropped.
+	netQueueSize = 1024
+	// Timeout of connecting and of each write.
+	netTimeout = 5 * time.Second
+	// Wait before reconnecting after a failed connection, doubled after each
+	// failure up to netMaxBackoff.
+	netBackoff    = time.Second
+	netMaxBackoff = 30 * time.Second
+)
+
+// parseNetAddr parses the address of -net, tcp://host:port or udp://host:port.
+func parseNetAddr(s string) (network, addr string, err error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "tcp" && u.Scheme != "udp" {
+		return "", "", fmt.Errorf("expected tcp://host:port or udp://host:port")
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		return "", "", err
+	}
+	return u.Scheme, u.Host, nil
+}
+
+// netSink sends the lines, without colors, over a TCP connection or as UDP
+// datagrams, from its own goroutine so that a slow or unreachable collector
+// never blocks the output. A dropped TCP connection is opened again on the
+// next line, waiting longer after each failure; the lines that come in
+// the meantime are counted as failed.
+type netSink struct {
+	network string
+	addr    string
+	clock   Clock
+	queue   chan string
+
+	sent       atomic.Int64
+	failed     atomic.Int64
+	dropped    atomic.Int64
+	reconnects atomic.Int64
+	// Where the failures are recorded, nil for nowhere.
+	errors *errorLog
+}
+
+// newNetSink returns a sink sending to `addr`, once run is called.
+func newNetSink(network, addr string, clock Clock) *netSink {
+	return &netSink{network: network, addr: addr, clock: clock, queue: make(chan string, netQueueSize)}
+}
+
+// Write queues the line, and drops it if the queue is full. It never fails,
+// the errors of sending are logged and counted instead.
+func (s *netSink) Write(_, plain string) error {
+	select {
+	case s.queue <- plain:
+	default:
+		s.dropped.Add(1)
+	}
+	return nil
+}
+
+// run sends the queued lines, and never returns.
+func (s *netSink) run() {
+	var (
+		conn    net.Conn
+		retryAt time.Time
+		backoff = netBackoff
+		// Whether the connection was lost, to log the reconnection.
+		lost bool
+	)
+	for l := range s.queue {
+		if conn == nil {
+			if s.clock.Now().Before(retryAt) {
+				s.failed.Add(1)
+				continue
+			}
+			c, err := net.DialTimeout(s.network, s.addr, netTimeout)
+			if err != nil {
+				s.fail(fmt.Errorf("connecting: %w", err))
+				retryAt = s.clock.Now().Add(backoff)
+				backoff = min(backoff*2, netMaxBackoff)
+				continue
+			}
+			conn, backoff = c, netBackoff
+			if lost {
+				s.reconnects.Add(1)
+				slog.Info("reconnected to -net", "addr", s.addr)
+			}
+		}
+
+		conn.SetWriteDeadline(s.clock.Now().Add(netTimeout))
+		if _, err := conn.Write([]byte(l)); err != nil {
+			s.fail(err)
+			// UDP is fire-and-forget, the same socket is kept.
+			if s.network == "tcp" {
+				conn.Close()
+				conn, lost = nil, true
+			}
+			continue
+		}
+		s.sent.Add(1)
+	}
+}
+
+// fail counts a line that couldn't be sent, and records why.
+func (s *netSink) fail(err error) {
+	s.failed.Add(1)
+	slog.Warn("failed to send a line to -net", "addr", s.addr, "error", err)
+	s.errors.add("net", "", err)
+}
+
+// netSinkStats are the counters of the -net sink.
+type netSinkStats struct {
+	Sent       int64 `json:"sent_total"`
+	Failed     int64 `json:"failures_total"`
+	Dropped    int64 `json:"dropped_total"`
+	Reconnects int64 `json:"reconnects_total"`
+}
+
+// Stats returns the counters of the sink, or nil on a nil sink.
+func (s *netSink) Stats() *netSinkStats {
+	if s == nil {
+		return nil
+	}
+	return &netSinkStats{Sent: s.sent.Load(), Failed: s.failed.Load(), Dropped: s.dropped.Load(), Reconnects: s.reconnects.Load()}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseNetAddr(t *testing.T) {
+	tests := []struct {
+		in            string
+		network, addr string
+		valid         bool
+	}{
+		{"tcp://localhost:5000", "tcp", "localhost:5000", true},
+		{"udp://127.0.0.1:514", "udp", "127.0.0.1:514", true},
+		{"tcp://[::1]:5000", "tcp", "[::1]:5000", true},
+		{"http://localhost:5000", "", "", false},
+		{"tcp://localhost", "", "", false},
+		{"localhost:5000", "", "", false},
+	}
+	for _, tt := range tests {
+		network, addr, err := parseNetAddr(tt.in)
+		if (err == nil) != tt.valid || network != tt.network || addr != tt.addr {
+			t.Errorf("%q: got %q, %q and %v, want %q, %q and valid %t", tt.in, network, addr, err, tt.network, tt.addr, tt.valid)
+		}
+	}
+}
+
+// accept returns the next connection of the listener, and a reader of its lines.
+func accept(t *testing.T, l net.Listener) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+func TestNetSinkTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := newNetSink("tcp", l.Addr().String(), realClock{})
+	go s.run()
+
+	// Only the plain variant is sent.
+	s.Write("\x1b[31mfirst\x1b[0m\n", "first\n")
+	conn, r := accept(t, l)
+	if got, err := r.ReadString('\n'); err != nil || got != "first\n" {
+		t.Fatalf("got %q and %v, want the first line without colors", got, err)
+	}
+
+	// Once the collector drops the connection, the lines that fail are counted,
+	// and the sink connects again.
+	conn.Close()
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	var again net.Conn
+	for again == nil {
+		s.Write("", "again\n")
+		select {
+		case again = <-accepted:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	defer again.Close()
+	again.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if got, err := bufio.NewReader(again).ReadString('\n'); err != nil || got != "again\n" {
+		t.Errorf("got %q and %v after reconnecting, want a line", got, err)
+	}
+	waitFor(t, "the counters", func() bool { st := s.Stats(); return st.Reconnects == 1 && st.Failed >= 1 && st.Sent >= 2 })
+}
+
+func TestNetSinkBackoff(t *testing.T) {
+	// Nothing listens on the port anymore.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	c := newFakeClock()
+	s := newNetSink("tcp", addr, c)
+	s.errors = newErrorLog(errorLogSize, c)
+	go s.run()
+
+	tests := []struct {
+		advance time.Duration
+		// Whether the line is sent after a new attempt at connecting, rather
+		// than failed without it during the backoff.
+		dialed bool
+	}{
+		{0, true},
+		{0, false},
+		{netBackoff, true},
+		// The wait is doubled after each failure.
+		{netBackoff, false},
+		{netBackoff, true},
+	}
+	dials := 0
+	for i, tt := range tests {
+		c.Advance(tt.advance)
+		s.Write("", "line\n")
+		waitFor(t, "the line", func() bool { return s.Stats().Failed == int64(i+1) })
+		if tt.dialed {
+			dials++
+		}
+		if n := len(s.errors.Events()); n != dials {
+			t.Errorf("line %d: %d connection errors, want %d", i+1, n, dials)
+		}
+	}
+}
+
+func TestNetSinkUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	s := newNetSink("udp", pc.LocalAddr().String(), realClock{})
+	go s.run()
+
+	for _, want := range []string{"0001 a\n", "0002 a\n"} {
+		s.Write("", want)
+		pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 64)
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil || string(buf[:n]) != want {
+			t.Errorf("got %q and %v, want %q", buf[:n], err, want)
+		}
+	}
+	waitFor(t, "the counters", func() bool { return s.Stats().Sent == 2 })
+}
+
+func TestNetSinkDrops(t *testing.T) {
+	// Not run, so that the lines stay queued.
+	s := newNetSink("tcp", "127.0.0.1:1", realClock{})
+	for range netQueueSize + 3 {
+		if err := s.Write("", "line\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if st := s.Stats(); st.Dropped != 3 {
+		t.Errorf("%d lines dropped, want 3", st.Dropped)
+	}
+	var none *netSink
+	if none.Stats() != nil {
+		t.Error("counters of a nil sink")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		mode, name, want string
+	}{
+		{"none", " Foo ", " Foo "},
+		{"trim", " Foo\t", "Foo"},
+		{"trim", "Foo", "Foo"},
+		{"trim+lower", " Foo BAR ", "foo bar"},
+		{"trim+lower", "Été", "été"},
+	}
+	for _, tt := range tests {
+		if got := normalizeName(tt.name, tt.mode); got != tt.want {
+			t.Errorf("%s %q: got %q, want %q", tt.mode, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizedAdd(t *testing.T) {
+	tests := []struct {
+		mode string
+		// Name the second printer is known by, and whether adding it collides
+		// with the first one, "foo".
+		key      string
+		collides bool
+	}{
+		{"none", "Foo ", false},
+		{"trim", "Foo", false},
+		{"trim+lower", "foo", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			p.normalize = tt.mode
+			mustAdd(t, p, spec{Name: "foo", Period: 60})
+			err := p.Add(spec{Name: "Foo ", Period: 60})
+			if collides := errors.Is(err, ErrExists); collides != tt.collides || (err != nil && !collides) {
+				t.Fatalf("got %v, want a collision %t", err, tt.collides)
+			}
+			if tt.collides {
+				return
+			}
+			// The name is still printed as it was given.
+			info, ok := p.Get(tt.key)
+			if !ok || info.Text != "Foo " {
+				t.Errorf("got %+v as %q, want the text as it was given", info, tt.key)
+			}
+		})
+	}
+
+	// The source of a shadow printer is normalized too.
+	p, _ := newTestPrinters(t, realClock{})
+	p.normalize = "trim+lower"
+	mustAdd(t, p, spec{Name: "Source", Period: 60}, spec{Name: "shadow", Mirror: " SOURCE"})
+	if info, _ := p.Get("shadow"); info.Mirror != "source" {
+		t.Errorf("mirrors %q, want source", info.Mirror)
+	}
+}
+
+func TestNormalizeValidation(t *testing.T) {
+	for _, mode := range normalizeModes {
+		c := parseFlags(t, "-normalize", mode)
+		if errs, _ := c.validate(); len(errs) != 0 {
+			t.Errorf("%s: errors %v", mode, errs)
+		}
+	}
+	c := parseFlags(t, "-normalize", "lower")
+	if errs, _ := c.validate(); len(errs) != 1 {
+		t.Errorf("got the errors %v, want one for -normalize", errs)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// How long the output waits for other lines after receiving one, so that
+// lines printed at the same time are ordered by priority.
+const batchWindow = 10 * time.Millisecond
+
+// line is what a printer prints on a tick.
+type line struct {
+	elapsed time.Duration
+	at      time.Time
+	name    string
+	// Name of the printer, whose text is in `name`.
+	printer  string
+	color    string
+	priority int
+	fields   map[string]string
+	dim      bool
+	// Name of the sink of -sink the line is written to, empty for the default one.
+	sink string
+}
+
+// Most lines queued past the rate limit, the next ones are dropped.
+const maxQueued = 1000
+
+// Formats accepted by -outformat, for the lines printed to stdout.
+var outFormats = []string{"ansi", "plain", "html", "ndjson"}
+
+// Timestamps accepted by -timestamps.
+var timestampFormats = []string{"elapsed", "absolute"}
+
+// Overflow policies accepted by -overflow, for the lines past -maxrate.
+var overflowPolicies = []string{"queue", "drop"}
+
+// output serializes the lines of every printer to a single sink.
+// Lines received within `window` of the first one are written together,
+// by decreasing priority and in arrival order for equal priorities.
+type output struct {
+	sink sink
+	// Sinks of -sink, that lines can be written to instead.
+	named  map[string]sink
+	clock  Clock
+	window time.Duration
+	// Limits the lines written per second, nil for no limit. With the "queue"
+	// overflow, lines past the limit are written later, otherwise they are dropped.
+	limit    *limiter
+	overflow string
+	// Format of the colored lines, one of outFormats.
+	format string
+	// Style of the prefix of the colored lines, see printWithTime.
+	prefixColor string
+	// Location of the absolute timestamps, nil to print the elapsed seconds.
+	loc *time.Location
+
+	lines chan line
+	// Closed to ask run to flush and return, then done is closed.
+	closing chan struct{}
+	done    chan struct{}
+
+	// Only used by run.
+	queue []line
+	// Totals of the lines dropped and queued because of the limit.
+	dropped atomic.Int64
+	queued  atomic.Int64
+	// Durations of the writes to the sink.
+	latency latencies
+	// Lines written in each of the last seconds.
+	rate rateCounter
+	// Where the failed writes are recorded, nil for nowhere.
+	errors *errorLog
+}
+
+func newOutput(s sink, clock Clock, window time.Duration) *output {
+	return &output{
+		sink:    s,
+		clock:   clock,
+		window:  window,
+		format:  "ansi",
+		lines:   make(chan line, 64),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// print queues a line to be written. It never blocks once the output is closed.
+func (o *output) print(l line) {
+	select {
+	case o.lines <- l:
+	case <-o.closing:
+	}
+}
+
+// run writes the lines until the output is closed.
+func (o *output) run() {
+	defer close(o.done)
+
+	var batch []line
+	var timer Timer
+	var flush <-chan time.Time
+	// Fires when the limit lets the next queued line through.
+	var wakeTimer Timer
+	var wake <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		if wakeTimer != nil {
+			wakeTimer.Stop()
+		}
+	}()
+	for {
+		if len(o.queue) > 0 && wake == nil {
+			d := o.limit.wait(o.clock.Now())
+			if wakeTimer == nil {
+				wakeTimer = o.clock.NewTimer(d)
+			} else {
+				wakeTimer.Reset(d)
+			}
+			wake = wakeTimer.C()
+		}
+
+		select {
+		case l := <-o.lines:
+			if batch == nil {
+				if timer == nil {
+					timer = o.clock.NewTimer(o.window)
+				} else {
+					timer.Reset(o.window)
+				}
+				flush = timer.C()
+			}
+			batch = append(batch, l)
+		case <-flush:
+			o.write(batch)
+			batch, flush = nil, nil
+		case <-wake:
+			wake = nil
+			o.drain(o.clock.Now())
+		case <-o.closing:
+			// Write what was already received, queued lines included and
+			// regardless of the limit, then stop.
+			for {
+				select {
+				case l := <-o.lines:
+					batch = append(batch, l)
+				default:
+					for _, l := range o.queue {
+						o.writeLine(l)
+					}
+					o.queue = nil
+					o.limit = nil
+					o.write(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (o *output) write(batch []line) {
+	sort.SliceStable(batch, func(i, j int) bool { return batch[i].priority > batch[j].priority })
+	if o.limit == nil {
+		for _, l := range batch {
+			o.writeLine(l)
+		}
+		return
+	}
+
+	now := o.clock.Now()
+	// The queued lines were received first.
+	o.drain(now)
+	for _, l := range batch {
+		switch {
+		case len(o.queue) == 0 && o.limit.allow(now):
+			o.writeLine(l)
+		case o.overflow == "queue" && len(o.queue) < maxQueued:
+			o.queue = append(o.queue, l)
+			o.queued.Add(1)
+		default:
+			o.dropped.Add(1)
+		}
+	}
+}
+
+// drain writes the queued lines the limit allows.
+func (o *output) drain(now time.Time) {
+	n := 0
+	for n < len(o.queue) && o.limit.allow(now) {
+		o.writeLine(o.queue[n])
+		n++
+	}
+	o.queue = o.queue[n:]
+}
+
+func (o *output) writeLine(l line) {
+	start := o.clock.Now()
+	sk := o.sink
+	if l.sink != "" {
+		sk = o.named[l.sink]
+	}
+	err := printWithTime(sk, l, o.format, o.loc, o.prefixColor)
+	o.latency.add(l.printer, o.clock.Now().Sub(start))
+	o.rate.add(start)
+	if err != nil {
+		slog.Warn("failed to print", "name", l.printer, "error", err)
+		o.errors.add("output", l.printer, err)
+	}
+}
+
+// hasSink reports whether there is a sink of -sink with this name.
+func (o *output) hasSink(name string) bool {
+	if o == nil {
+		return false
+	}
+	_, ok := o.named[name]
+	return ok
+}
+
+// Counts returns the totals of the lines dropped and queued because of the limit.
+func (o *output) Counts() (dropped, queued int64) {
+	return o.dropped.Load(), o.queued.Load()
+}
+
+// Close flushes the queued lines and stops the output.
+func (o *output) Close() {
+	close(o.closing)
+	<-o.done
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestOutputBatchOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []line
+		want []string
+	}{
+		{"arrival order", []line{{name: "a"}, {name: "b"}, {name: "c"}}, []string{"a", "b", "c"}},
+		{"by priority", []line{{name: "low", priority: -1}, {name: "mid"}, {name: "high", priority: 5}}, []string{"high", "mid", "low"}},
+		{"stable", []line{{name: "a1", priority: 1}, {name: "b"}, {name: "a2", priority: 1}}, []string{"a1", "a2", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClock()
+			sk := &testSink{}
+			out := newOutput(sk, c, 50*time.Millisecond)
+			out.format = "plain"
+			go out.run()
+			defer out.Close()
+			for _, l := range tt.in {
+				out.print(l)
+			}
+			waitTimers(t, c, 1)
+			c.Advance(50 * time.Millisecond)
+			waitFor(t, "the batch", func() bool { return len(sk.Lines()) == len(tt.in) })
+			var got []string
+			for _, l := range sk.Lines() {
+				got = append(got, l[len("0000 "):])
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoincidentTicksByPriority(t *testing.T) {
+	c := newFakeClock()
+	sk := &testSink{}
+	// The printers tick on the fake clock, their lines are batched for real.
+	out := newOutput(sk, realClock{}, 100*time.Millisecond)
+	out.format = "plain"
+	go out.run()
+	p := newPrinters(c, out)
+	t.Cleanup(func() {
+		p.StopAll(5 * time.Second)
+		out.Close()
+	})
+	mustAdd(t, p, spec{Name: "low", Period: 1}, spec{Name: "high", Period: 1, Priority: 10})
+	waitTimers(t, c, 2)
+
+	for i := 1; i <= 5; i++ {
+		tick(t, c, time.Second, sk, 2*i)
+	}
+	got := sk.Lines()
+	for i := 0; i < len(got); i += 2 {
+		if got[i] != fmt.Sprintf("%04d high", i/2+1) || got[i+1] != fmt.Sprintf("%04d low", i/2+1) {
+			t.Fatalf("got %q, want high before low on every tick", got)
+		}
+	}
+}
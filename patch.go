@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SetText changes what a printer prints from its next tick, keeping its name.
+// It returns ErrNotFound if there is no printer for this string.
+func (p *printers) SetText(s, text string) error {
+	if err := validateName(text); err != nil {
+		return fmt.Errorf("invalid text: %w", err)
+	}
+	return p.update(s, func(pr *printer) { pr.text = text })
+}
+
+// SetColor changes the color of a printer, given as #RRGGBB.
+// It returns ErrNotFound if there is no printer for this string.
+func (p *printers) SetColor(s, color string) error {
+	if !colorRe.MatchString(color) {
+		return fmt.Errorf("invalid color %q: expected #RRGGBB", color)
+	}
+	return p.update(s, func(pr *printer) { pr.color = color })
+}
+
+// SetPinned pins or unpins a printer, a pinned printer is only stopped when forced.
+// It returns ErrNotFound if there is no printer for this string.
+func (p *printers) SetPinned(s string, pinned bool) error {
+	return p.update(s, func(pr *printer) { pr.pinned = pinned })
+}
+
+// SetPaused pauses or resumes a printer. A paused printer keeps ticking, but
+// doesn't print. It returns ErrNotFound if there is no printer for this string.
+func (p *printers) SetPaused(s string, paused bool) error {
+	return p.update(s, func(pr *printer) { pr.paused = paused })
+}
+
+// SetPausedAll pauses or resumes every printer, and returns how many of them
+// weren't already in that state. The printers keep their schedules.
+func (p *printers) SetPausedAll(paused bool) int {
+	p.mu.Lock()
+	n := 0
+	for _, pr := range p.l {
+		if !pr.stopping && pr.paused != paused {
+			pr.paused = paused
+			n++
+		}
+	}
+	p.mu.Unlock()
+
+	if n > 0 {
+		p.changed()
+	}
+	return n
+}
+
+// update calls f on a printer under the lock, and then the onChange hook.
+func (p *printers) update(s string, f func(pr *printer)) error {
+	p.mu.Lock()
+	pr, ok := p.l[s]
+	if !ok {
+		p.mu.Unlock()
+		return ErrNotFound
+	}
+	f(pr)
+	p.mu.Unlock()
+
+	p.changed()
+	return nil
+}
+
+// handlePatch changes some of the text, period, color, paused and pinned state of a
+// printer, and returns it. The fields that aren't given are left unchanged.
+func (s *server) handlePatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text   *string `json:"text,omitempty"`
+		Period *int    `json:"period,omitempty"`
+		Color  *string `json:"color,omitempty"`
+		Paused *bool   `json:"paused,omitempty"`
+		Pinned *bool   `json:"pinned,omitempty"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		bodyError(w, err, "Invalid JSON body: expected an object with text, period, color, paused or pinned")
+		return
+	}
+
+	// Check what can be checked first, so that an invalid request changes nothing.
+	name := r.PathValue("name")
+	if _, ok := s.printers.Get(name); !ok {
+		http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if req.Text != nil {
+		if err := validateName(*req.Text); err != nil {
+			http.Error(w, "invalid text: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Period != nil && *req.Period < 1 {
+		http.Error(w, "period must be a positive number of seconds", http.StatusBadRequest)
+		return
+	}
+	if req.Color != nil && !colorRe.MatchString(*req.Color) {
+		http.Error(w, "color must be a color as #RRGGBB", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if req.Period != nil {
+		err = s.printers.SetPeriod(name, time.Duration(*req.Period)*time.Second)
+	}
+	if err == nil && req.Text != nil {
+		err = s.printers.SetText(name, *req.Text)
+	}
+	if err == nil && req.Color != nil {
+		err = s.printers.SetColor(name, *req.Color)
+	}
+	if err == nil && req.Paused != nil {
+		err = s.printers.SetPaused(name, *req.Paused)
+	}
+	if err == nil && req.Pinned != nil {
+		err = s.printers.SetPinned(name, *req.Pinned)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	s.audit(r, "update", name, req)
+
+	info, ok := s.printers.Get(name)
+	if !ok {
+		http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, info)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPatchText(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "demo", Period: 1})
+	waitTimers(t, c, 1)
+	s := newTestServer(p)
+
+	tick(t, c, time.Second, sk, 1)
+	tick(t, c, time.Second, sk, 2)
+	w := serve(t, s, http.MethodPatch, "/api/printers/demo", `{"text": "changed"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var info printerInfo
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "demo" || info.Text != "changed" || info.Period != 1 {
+		t.Errorf("got %+v, want demo printing changed every second", info)
+	}
+	tick(t, c, time.Second, sk, 3)
+	tick(t, c, time.Second, sk, 4)
+
+	// The schedule and the counter carry on.
+	want := []string{"0001 demo", "0002 demo", "0003 changed", "0004 changed"}
+	if got := sk.Lines(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if info, _ := p.Get("demo"); info.Ticked != 4 {
+		t.Errorf("%d ticks counted, want 4", info.Ticked)
+	}
+}
+
+func TestPatchErrors(t *testing.T) {
+	tests := []struct {
+		name, target, body string
+		want               int
+	}{
+		{"missing", "/api/printers/missing", `{"text": "x"}`, http.StatusNotFound},
+		{"unknown field", "/api/printers/a", `{"name": "x"}`, http.StatusBadRequest},
+		{"not an object", "/api/printers/a", `["x"]`, http.StatusBadRequest},
+		{"escape in text", "/api/printers/a", `{"text": "\u001b[2J"}`, http.StatusBadRequest},
+		{"zero period", "/api/printers/a", `{"text": "x", "period": 0}`, http.StatusBadRequest},
+		{"bad color", "/api/printers/a", `{"text": "x", "color": "red"}`, http.StatusBadRequest},
+		{"cron period", "/api/printers/cron", `{"period": 5}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			mustAdd(t, p, spec{Name: "a", Period: 60, Color: "#112233"}, spec{Name: "cron", Cron: "* * * * *"})
+			if w := serve(t, newTestServer(p), http.MethodPatch, tt.target, tt.body); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			// An invalid request changes nothing, even the valid fields.
+			if info, _ := p.Get("a"); info.Text != "a" || info.Period != 60 || info.Color != "#112233" {
+				t.Errorf("a changed to %+v", info)
+			}
+		})
+	}
+}
+
+func TestPatchPartial(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 60, Color: "#112233"})
+	s := newTestServer(p)
+	steps := []struct {
+		body string
+		want printerInfo
+	}{
+		{`{"period": 5}`, printerInfo{Text: "a", Period: 5, Color: "#112233"}},
+		{`{"color": "#445566"}`, printerInfo{Text: "a", Period: 5, Color: "#445566"}},
+		{`{"paused": true, "text": "b"}`, printerInfo{Text: "b", Period: 5, Color: "#445566", Paused: true}},
+		{`{}`, printerInfo{Text: "b", Period: 5, Color: "#445566", Paused: true}},
+	}
+	for _, st := range steps {
+		if w := serve(t, s, http.MethodPatch, "/api/printers/a", st.body); w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", st.body, w.Code, w.Body)
+		}
+		info, _ := p.Get("a")
+		if info.Text != st.want.Text || info.Period != st.want.Period || info.Color != st.want.Color || info.Paused != st.want.Paused {
+			t.Errorf("%s: got %+v, want %+v", st.body, info, st.want)
+		}
+	}
+}
+
+func TestPatchTextWhileTicking(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "demo", Period: 1})
+	waitTimers(t, c, 1)
+	s := newTestServer(p)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 50 {
+			serve(t, s, http.MethodPatch, "/api/printers/demo", fmt.Sprintf(`{"text": "text-%d"}`, i))
+		}
+	}()
+	for i := 1; i <= 20; i++ {
+		tick(t, c, time.Second, sk, i)
+	}
+	wg.Wait()
+	if info, _ := p.Get("demo"); info.Text != "text-49" {
+		t.Errorf("text %q, want the last one", info.Text)
+	}
+}
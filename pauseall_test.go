@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPauseAll(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "a", Period: 1}, spec{Name: "b", Period: 1}, spec{Name: "c", Period: 1})
+	if err := p.SetPaused("c", true); err != nil {
+		t.Fatal(err)
+	}
+	waitTimers(t, c, 3)
+	s := newTestServer(p)
+
+	tests := []struct {
+		target string
+		// Name and value of the count returned, and whether the printers are
+		// paused after it.
+		key    string
+		n      int
+		paused bool
+	}{
+		{"/api/pause-all", "paused", 2, true},
+		{"/api/pause-all", "paused", 0, true},
+		{"/api/resume-all", "resumed", 3, false},
+		{"/api/resume-all", "resumed", 0, false},
+	}
+	for _, tt := range tests {
+		w := serve(t, s, http.MethodPost, tt.target, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tt.target, w.Code, w.Body)
+		}
+		var resp map[string]int
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp[tt.key] != tt.n {
+			t.Errorf("%s: got %v, want %d %s", tt.target, resp, tt.n, tt.key)
+		}
+		for _, info := range p.List() {
+			if info.Paused != tt.paused {
+				t.Errorf("%s: %s paused %t, want %t", tt.target, info.Name, info.Paused, tt.paused)
+			}
+		}
+	}
+
+	// The paused printers keep their timers, and print nothing.
+	serve(t, s, http.MethodPost, "/api/pause-all", "")
+	if n := c.Active(); n != 3 {
+		t.Errorf("%d timers while paused, want 3", n)
+	}
+	c.Advance(time.Second)
+	waitFor(t, "the ticks", func() bool {
+		for _, info := range p.List() {
+			if info.LastTick == nil {
+				return false
+			}
+		}
+		return true
+	})
+	if got := sk.Lines(); len(got) != 0 {
+		t.Errorf("printed %q while paused", got)
+	}
+	serve(t, s, http.MethodPost, "/api/resume-all", "")
+	tick(t, c, time.Second, sk, 3)
+
+	entries := s.auditLog.Entries()
+	if len(entries) == 0 || entries[len(entries)-1].Op != "resume-all" {
+		t.Errorf("got the audit entries %+v, want the last one for resume-all", entries)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Units of the periods written as phrases, such as "every 30 seconds".
+var periodUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hour": time.Hour, "hours": time.Hour,
+}
+
+// parsePeriod parses a period given as a number of seconds such as "30", a Go
+// duration such as "5s" or "1h30m", or a phrase such as "every 30 seconds" or
+// "every minute". Periods are whole seconds, of at least one.
+func parsePeriod(s string) (time.Duration, error) {
+	in := strings.ToLower(strings.TrimSpace(s))
+	in = strings.TrimSpace(strings.TrimPrefix(in, "every"))
+
+	d, ok := parsePeriodPhrase(in)
+	if !ok {
+		return 0, fmt.Errorf("invalid period %q: expected a number of seconds such as 30, a duration such as 5s or 2m, or a phrase such as \"every 30 seconds\"", s)
+	}
+	if d < time.Second || d%time.Second != 0 {
+		return 0, fmt.Errorf("invalid period %q: must be a whole number of seconds, of at least one", s)
+	}
+	return d, nil
+}
+
+// parseOffset parses the offset of an aligned printer, as a number of seconds or a
+// Go duration, in whole seconds. Unlike a period, it can be 0.
+func parseOffset(s string) (time.Duration, error) {
+	d, ok := parsePeriodPhrase(strings.ToLower(strings.TrimSpace(s)))
+	if !ok || d < 0 || d%time.Second != 0 {
+		return 0, fmt.Errorf("invalid offset %q: expected a whole number of seconds such as 300, or a duration such as 5m", s)
+	}
+	return d, nil
+}
+
+func parsePeriodPhrase(in string) (time.Duration, bool) {
+	if n, err := strconv.Atoi(in); err == nil {
+		return time.Duration(n) * time.Second, true
+	}
+	if d, err := time.ParseDuration(in); err == nil {
+		return d, true
+	}
+
+	// A unit alone means one of it, as in "every minute".
+	words := strings.Fields(in)
+	switch len(words) {
+	case 1:
+		unit, ok := periodUnits[words[0]]
+		return unit, ok
+	case 2:
+		n, err := strconv.Atoi(words[0])
+		unit, ok := periodUnits[words[1]]
+		if err != nil || !ok {
+			return 0, false
+		}
+		return time.Duration(n) * unit, true
+	}
+	return 0, false
+}
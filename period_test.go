@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"30", 30 * time.Second},
+		{" 30 ", 30 * time.Second},
+		{"5s", 5 * time.Second},
+		{"2m", 2 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"every 30 seconds", 30 * time.Second},
+		{"Every 5 Minutes", 5 * time.Minute},
+		{"every 1 sec", time.Second},
+		{"every 2 h", 2 * time.Hour},
+		{"every minute", time.Minute},
+		{"hour", time.Hour},
+		{"every 90s", 90 * time.Second},
+	}
+	for _, tt := range tests {
+		got, err := parsePeriod(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parsePeriod(%q) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParsePeriodRejects(t *testing.T) {
+	tests := []struct {
+		in, wantErr string
+	}{
+		{"soon", "expected a number of seconds"},
+		{"", "expected a number of seconds"},
+		{"every", "expected a number of seconds"},
+		{"every 5 fortnights", "expected a number of seconds"},
+		{"every five seconds", "expected a number of seconds"},
+		{"every 5 seconds please", "expected a number of seconds"},
+		{"0", "of at least one"},
+		{"-5", "of at least one"},
+		{"500ms", "whole number of seconds"},
+		{"1.5s", "whole number of seconds"},
+	}
+	for _, tt := range tests {
+		if _, err := parsePeriod(tt.in); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("parsePeriod(%q): got %v, want an error with %q", tt.in, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseOffset(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"300", 5 * time.Minute, false},
+		{"5m", 5 * time.Minute, false},
+		{"-1", 0, true},
+		{"1.5s", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseOffset(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseOffset(%q) = %s, %v, want %s and an error %t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
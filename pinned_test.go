@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestStopPinned(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		want   int
+		// Whether the printer is stopped.
+		stopped bool
+	}{
+		{"without force", "/api/printers/critical", http.StatusConflict, false},
+		{"force false", "/api/printers/critical?force=false", http.StatusConflict, false},
+		{"forced", "/api/printers/critical?force=true", http.StatusNoContent, true},
+		{"forced by id", "/api/printers/id/1?force=true", http.StatusNoContent, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			mustAdd(t, p, spec{Name: "critical", Period: 60, Pinned: true})
+			if info, _ := p.Get("critical"); !info.Pinned {
+				t.Fatal("the printer isn't pinned")
+			}
+			w := serve(t, newTestServer(p), http.MethodDelete, tt.target, "")
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.stopped {
+				waitFor(t, "the printer to stop", func() bool { _, ok := p.Get("critical"); return !ok })
+			} else if _, ok := p.Get("critical"); !ok {
+				t.Error("the printer was stopped")
+			}
+		})
+	}
+}
+
+func TestStopPinnedResults(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "critical", Period: 60, Pinned: true})
+	if res := p.Stop("critical", false); res != stopPinned {
+		t.Errorf("got %s, want %s", res, stopPinned)
+	}
+	// Once unpinned, it is stopped like another printer.
+	if err := p.SetPinned("critical", false); err != nil {
+		t.Fatal(err)
+	}
+	if res := p.Stop("critical", false); res != stopped {
+		t.Errorf("got %s once unpinned, want %s", res, stopped)
+	}
+}
+
+func TestStopPinnedForm(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "critical", Period: 60, Pinned: true})
+	s := newTestServer(p)
+	post := func(values url.Values) string {
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, formRequest(values))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+
+	body := post(url.Values{"stop": {"true"}, "item": {"critical"}})
+	if !strings.Contains(body, "The printer is pinned, use Force stop") || !strings.Contains(body, "<td>critical</td>") {
+		t.Errorf("no error and the printer in %q", body)
+	}
+	if !strings.Contains(body, `<button disabled title="Pinned">Stop</button>`) || !strings.Contains(body, "Force stop</button>") {
+		t.Errorf("no disabled stop and force stop buttons in %q", body)
+	}
+	post(url.Values{"stop": {"true"}, "item": {"critical"}, "force": {"true"}})
+	waitFor(t, "the printer to stop", func() bool { _, ok := p.Get("critical"); return !ok })
+}
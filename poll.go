@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// How long a long poll waits for a tick before returning no events. It is
+// shorter than the default -writetimeout, which would cut it off.
+const pollTimeout = 25 * time.Second
+
+// handlePoll returns the tick events after the cursor of `since`, waiting up to
+// pollTimeout for one if there are none yet, with the cursor to pass next. It is
+// a fallback for the clients behind proxies buffering streamed responses:
+// they call it in a loop. Without `since`, it waits for the next tick.
+func (s *server) handlePoll(w http.ResponseWriter, r *http.Request) {
+	h := s.printers.hub
+	_, last, _ := h.since(0)
+	since := last
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid since: expected a cursor returned by a previous poll", http.StatusBadRequest)
+			return
+		}
+		// A cursor from before a restart would never be reached.
+		since = min(n, last)
+	}
+
+	timer := s.printers.clock.NewTimer(pollTimeout)
+	defer timer.Stop()
+	for {
+		evs, last, published := h.since(since)
+		if len(evs) > 0 {
+			writeJSON(w, r, http.StatusOK, pollResponse{Events: evs, Cursor: last})
+			return
+		}
+		select {
+		case <-published:
+		case <-timer.C():
+			writeJSON(w, r, http.StatusOK, pollResponse{Events: []tickEvent{}, Cursor: since})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// pollResponse is what handlePoll returns.
+type pollResponse struct {
+	Events []tickEvent `json:"events"`
+	// To pass as `since` to the next poll.
+	Cursor int64 `json:"cursor"`
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// poll sends a long poll in the background, and returns the channel its response is sent on.
+func poll(t *testing.T, s *server, target string) <-chan pollResponse {
+	t.Helper()
+	resp := make(chan pollResponse, 1)
+	go func() {
+		w := serve(t, s, http.MethodGet, target, "")
+		var pr pollResponse
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status %d: %s", target, w.Code, w.Body)
+		} else if err := json.NewDecoder(w.Body).Decode(&pr); err != nil {
+			t.Error(err)
+		}
+		resp <- pr
+	}()
+	return resp
+}
+
+// pollResult returns the response of a long poll.
+func pollResult(t *testing.T, resp <-chan pollResponse) pollResponse {
+	t.Helper()
+	select {
+	case pr := <-resp:
+		return pr
+	case <-time.After(5 * time.Second):
+		t.Fatal("the poll didn't return")
+		return pollResponse{}
+	}
+}
+
+func TestPoll(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p, spec{Name: "a", Period: 1})
+	waitTimers(t, c, 1)
+	s := newTestServer(p)
+
+	// Without a cursor, the poll waits for the next tick.
+	resp := poll(t, s, "/api/poll")
+	waitTimers(t, c, 2)
+	select {
+	case pr := <-resp:
+		t.Fatalf("got %+v before any tick", pr)
+	case <-time.After(10 * time.Millisecond):
+	}
+	tick(t, c, time.Second, sk, 1)
+	pr := pollResult(t, resp)
+	if len(pr.Events) != 1 || pr.Events[0].Name != "a" || pr.Cursor != 1 {
+		t.Fatalf("got %+v, want the tick of a and the cursor 1", pr)
+	}
+
+	// The events since the cursor are returned right away.
+	tick(t, c, time.Second, sk, 2)
+	tick(t, c, time.Second, sk, 3)
+	waitFor(t, "the events", func() bool { _, last, _ := p.hub.since(0); return last == 3 })
+	tests := []struct {
+		since  string
+		events int
+		cursor int64
+	}{
+		{"0", 3, 3},
+		{"1", 2, 3},
+		{"2", 1, 3},
+	}
+	for _, tt := range tests {
+		pr := pollResult(t, poll(t, s, "/api/poll?since="+tt.since))
+		if len(pr.Events) != tt.events || pr.Cursor != tt.cursor || pr.Events[0].Seq <= 0 {
+			t.Errorf("since %s: got %+v, want %d events and the cursor %d", tt.since, pr, tt.events, tt.cursor)
+		}
+	}
+}
+
+func TestPollTimeout(t *testing.T) {
+	c := newFakeClock()
+	p, _ := newTestPrinters(t, c)
+	s := newTestServer(p)
+	p.hub.publish(tickEvent{Name: "a"})
+
+	// A cursor past the last event, such as one from before a restart, waits for the next one.
+	for _, since := range []string{"1", "50"} {
+		resp := poll(t, s, "/api/poll?since="+since)
+		waitTimers(t, c, 1)
+		c.Advance(pollTimeout)
+		pr := pollResult(t, resp)
+		if len(pr.Events) != 0 || pr.Cursor != 1 {
+			t.Errorf("since %s: got %+v, want no events and the cursor 1", since, pr)
+		}
+	}
+}
+
+func TestPollErrors(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	s := newTestServer(p)
+	for _, since := range []string{"soon", "-1"} {
+		if w := serve(t, s, http.MethodGet, "/api/poll?since="+since, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("since %s: status %d, want 400", since, w.Code)
+		}
+	}
+
+	// A client going away ends the poll, or closing the server would block.
+	srv := httptest.NewServer(s.routes())
+	defer srv.Close()
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	if _, err := client.Get(srv.URL + "/api/poll"); err == nil {
+		t.Fatal("the poll returned without an event")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// presets are named bundles of printer fields, loaded from the file of -presets.
+// Each preset is an object with the same fields as the printers of the bulk API,
+// except the name.
+type presets map[string]map[string]json.RawMessage
+
+// loadPresets reads and validates the presets of a JSON file.
+func loadPresets(path string) (presets, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ps presets
+	if err := json.Unmarshal(b, &ps); err != nil {
+		return nil, fmt.Errorf("expected an object of presets: %w", err)
+	}
+
+	names := make([]string, 0, len(ps))
+	for name := range ps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := ps[name]["name"]; ok {
+			return nil, fmt.Errorf("preset %q: presets can't set the name", name)
+		}
+		// Validate the preset as a printer, with a placeholder name.
+		if _, errs := validateSpec(ps.apply(name, map[string]json.RawMessage{"name": json.RawMessage(`"preset"`)})); len(errs) > 0 {
+			msgs := make([]string, len(errs))
+			for i, e := range errs {
+				msgs[i] = e.Field + " " + e.Message
+			}
+			return nil, fmt.Errorf("preset %q: %s", name, strings.Join(msgs, ", "))
+		}
+	}
+	return ps, nil
+}
+
+// apply returns the fields of the preset overridden by `fields`, as a JSON object.
+func (ps presets) apply(name string, fields map[string]json.RawMessage) json.RawMessage {
+	merged := maps.Clone(ps[name])
+	if merged == nil {
+		merged = map[string]json.RawMessage{}
+	}
+	maps.Copy(merged, fields)
+	b, _ := json.Marshal(merged)
+	return b
+}
+
+// handleListPresets returns the presets.
+func (s *server) handleListPresets(w http.ResponseWriter, r *http.Request) {
+	ps := s.presets
+	if ps == nil {
+		ps = presets{}
+	}
+	writeJSON(w, r, http.StatusOK, ps)
+}
+
+// handleAddFromPreset adds a printer from a preset, with the fields of the JSON
+// object of the body taking precedence over the ones of the preset.
+// Invalid fields are reported like with the bulk API.
+// It is served under /api/presets, as /api/printers/from-preset/{preset} would
+// conflict with /api/printers/{name}/boost.
+func (s *server) handleAddFromPreset(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("preset")
+	if _, ok := s.presets[name]; !ok {
+		http.Error(w, "No such preset", http.StatusNotFound)
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		bodyError(w, err, "Invalid JSON body: expected an object")
+		return
+	}
+	sp, errs := validateSpec(s.presets.apply(name, fields))
+	if len(errs) > 0 {
+		writeJSON(w, r, http.StatusBadRequest, map[string][]fieldError{"errors": errs})
+		return
+	}
+
+	if sp.Guard != "" && !cfg.AllowExec {
+		http.Error(w, "Guard commands are disabled, start the server with -allow-exec", http.StatusForbidden)
+		return
+	}
+	added, err := s.add(sp)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	s.audit(r, "add", added, sp)
+
+	info, ok := s.printers.Get(added)
+	if !ok {
+		// Stopped in the meantime.
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, info)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePresets writes the presets to a file and loads them.
+func writePresets(t *testing.T, content string) (presets, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "presets.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return loadPresets(path)
+}
+
+func TestLoadPresets(t *testing.T) {
+	tests := []struct {
+		content string
+		wantErr string
+	}{
+		{`{"slow": {"period": 60, "color": "#112233"}, "empty": {}}`, ""},
+		{`{"named": {"name": "x"}}`, "can't set the name"},
+		{`{"bad": {"period": -1}}`, `preset "bad": period`},
+		{`{"phrase": {"period": "every 5 minutes"}}`, ""},
+		{`{"bad": {"period": "soon"}}`, `preset "bad": period`},
+		{`{"bad": {"color": "blue"}}`, `preset "bad": color`},
+		{`[]`, "expected an object"},
+	}
+	for _, tt := range tests {
+		_, err := writePresets(t, tt.content)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.content, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: got %v, want an error with %q", tt.content, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAddFromPreset(t *testing.T) {
+	ps, err := writePresets(t, `{"slow": {"period": 60, "color": "#112233", "priority": 2}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   printerInfo
+	}{
+		{"defaults", `{"name": "a"}`, http.StatusCreated, printerInfo{Name: "a", Period: 60, Color: "#112233", Priority: 2}},
+		{"override", `{"name": "b", "period": 5, "priority": 0}`, http.StatusCreated, printerInfo{Name: "b", Period: 5, Color: "#112233"}},
+		{"string override", `{"name": "d", "period": "2m"}`, http.StatusCreated, printerInfo{Name: "d", Period: 120, Color: "#112233", Priority: 2}},
+		{"invalid override", `{"name": "c", "color": "red"}`, http.StatusBadRequest, printerInfo{}},
+		{"no name", `{}`, http.StatusBadRequest, printerInfo{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			s := newTestServer(p)
+			s.presets = ps
+			w := serve(t, s, http.MethodPost, "/api/presets/slow/printers", tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusCreated {
+				return
+			}
+			var got printerInfo
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != tt.want.Name || got.Period != tt.want.Period || got.Color != tt.want.Color || got.Priority != tt.want.Priority {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	p, _ := newTestPrinters(t, realClock{})
+	s := newTestServer(p)
+	s.presets = ps
+	if w := serve(t, s, http.MethodPost, "/api/presets/fast/printers", `{"name": "a"}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown preset: status %d, want 404", w.Code)
+	}
+	var listed presets
+	if err := json.NewDecoder(serve(t, s, http.MethodGet, "/api/presets", "").Body).Decode(&listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || string(listed["slow"]["period"]) != "60" {
+		t.Errorf("listed %s, want the slow preset", listed)
+	}
+}
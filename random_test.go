@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// nextTimer waits for the printer's timer to be reset, and returns the time
+// left before it fires.
+func nextTimer(t *testing.T, c *fakeClock) time.Duration {
+	t.Helper()
+	var d time.Duration
+	waitFor(t, "the timer", func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, ft := range c.timers {
+			if ft.active && ft.period == 0 && ft.f == nil {
+				d = ft.at.Sub(c.now)
+				return true
+			}
+		}
+		return false
+	})
+	return d
+}
+
+func TestRandomPeriod(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max int
+	}{
+		{"range", 2, 6},
+		{"single value", 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClock()
+			p, sk := newTestPrinters(t, c)
+			mustAdd(t, p, spec{Name: "random", Period: tt.max, MinPeriod: tt.min, MaxPeriod: tt.max})
+			minD, maxD := time.Duration(tt.min)*time.Second, time.Duration(tt.max)*time.Second
+
+			seen := make(map[time.Duration]bool)
+			for i := 1; i <= 100; i++ {
+				d := nextTimer(t, c)
+				if d < minD || d > maxD {
+					t.Fatalf("tick %d after %s, want between %s and %s", i, d, minD, maxD)
+				}
+				seen[d] = true
+				tick(t, c, d, sk, i)
+			}
+			if tt.min != tt.max && len(seen) < 2 {
+				t.Errorf("the same interval %v on every tick", seen)
+			}
+		})
+	}
+}
+
+func TestRandomPeriodValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		sp   spec
+		// Whether the printer is added, and the error wrapped otherwise, if any.
+		valid bool
+		err   error
+	}{
+		{"range", spec{Name: "r", Period: 5, MinPeriod: 1, MaxPeriod: 5}, true, nil},
+		{"equal bounds", spec{Name: "r", Period: 5, MinPeriod: 5, MaxPeriod: 5}, true, nil},
+		{"min above max", spec{Name: "r", Period: 5, MinPeriod: 5, MaxPeriod: 2}, false, ErrInvalidPeriod},
+		{"negative min", spec{Name: "r", Period: 5, MinPeriod: -1, MaxPeriod: 5}, false, ErrInvalidPeriod},
+		{"only min", spec{Name: "r", Period: 5, MinPeriod: 1}, false, nil},
+		{"only max", spec{Name: "r", Period: 5, MaxPeriod: 5}, false, nil},
+		{"with cron", spec{Name: "r", Cron: "* * * * *", MinPeriod: 1, MaxPeriod: 5}, false, nil},
+		{"with align", spec{Name: "r", Period: 5, Align: true, MinPeriod: 1, MaxPeriod: 5}, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			err := p.Add(tt.sp)
+			if (err == nil) != tt.valid {
+				t.Fatalf("got %v, want valid %t", err, tt.valid)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRandomPeriodAPI(t *testing.T) {
+	withConfig(t, config{DefaultPeriod: 1})
+	p, _ := newTestPrinters(t, realClock{})
+	s := newTestServer(p)
+	if w := serve(t, s, http.MethodPost, "/api/printers/bulk", `[{"name": "random", "minperiod": 10, "maxperiod": 20}]`); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	w := serve(t, s, http.MethodGet, "/api/printers/random", "")
+	var info printerInfo
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.MinPeriod != 10 || info.MaxPeriod != 20 {
+		t.Errorf("got the range %d-%d, want 10-20", info.MinPeriod, info.MaxPeriod)
+	}
+	// The period can't be changed, it is random.
+	if w := serve(t, s, http.MethodPatch, "/api/printers/random", `{"period": 5}`); w.Code != http.StatusBadRequest {
+		t.Errorf("status %d changing the period, want 400", w.Code)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Number of seconds the output rate is averaged over.
+const rateWindow = 10
+
+// rateCounter counts the lines written in each of the last seconds, in a ring
+// buffer indexed by the Unix second.
+type rateCounter struct {
+	mu sync.Mutex
+	// Lines written during the second secs[i].
+	counts [rateWindow + 1]int64
+	secs   [rateWindow + 1]int64
+}
+
+func (c *rateCounter) add(now time.Time) {
+	sec := now.Unix()
+	i := sec % int64(len(c.counts))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.secs[i] != sec {
+		c.secs[i], c.counts[i] = sec, 0
+	}
+	c.counts[i]++
+}
+
+// count returns the number of lines written during the second `sec`.
+// The lock must be held.
+func (c *rateCounter) count(sec int64) int64 {
+	i := sec % int64(len(c.counts))
+	if c.secs[i] != sec {
+		return 0
+	}
+	return c.counts[i]
+}
+
+// rates returns the lines written during the last whole second before now, and
+// the average per second over the last rateWindow whole seconds. The current
+// second isn't counted, as it isn't over.
+func (c *rateCounter) rates(now time.Time) (last, average float64) {
+	sec := now.Unix()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var sum int64
+	for s := sec - rateWindow; s < sec; s++ {
+		sum += c.count(s)
+	}
+	return float64(c.count(sec - 1)), float64(sum) / rateWindow
+}
+
+// handleRate returns the number of lines written per second by all the printers together.
+func (s *server) handleRate(w http.ResponseWriter, r *http.Request) {
+	last, average := s.printers.out.rate.rates(s.printers.clock.Now())
+	writeJSON(w, r, http.StatusOK, struct {
+		Last    float64 `json:"last_second"`
+		Average float64 `json:"average"`
+		Window  int     `json:"window_seconds"`
+	}{last, average, rateWindow})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateCounter(t *testing.T) {
+	start := time.Date(2024, 3, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		// Seconds after start the lines are written at.
+		lines         []float64
+		at            float64
+		last, average float64
+	}{
+		{"nothing", nil, 5, 0, 0},
+		{"current second not counted", []float64{5, 5.5}, 5.9, 0, 0},
+		{"last second", []float64{4, 4.5, 4.9}, 5, 3, 0.3},
+		{"window", []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 10, 1, 1},
+		{"older than the window", []float64{0, 1, 10}, 11, 1, 0.2},
+		// The slots of the ring buffer are reused for later seconds.
+		{"reused slot", []float64{0, 0, 11}, 12, 1, 0.1},
+	}
+	for _, tt := range tests {
+		var c rateCounter
+		for _, s := range tt.lines {
+			c.add(start.Add(time.Duration(s * float64(time.Second))))
+		}
+		last, average := c.rates(start.Add(time.Duration(tt.at * float64(time.Second))))
+		if last != tt.last || average != tt.average {
+			t.Errorf("%s: got %g and %g, want %g and %g", tt.name, last, average, tt.last, tt.average)
+		}
+	}
+}
+
+func TestRateEndpoint(t *testing.T) {
+	c := newFakeClock()
+	sk := &testSink{}
+	// The lines are counted at the time of the fake clock.
+	out := newOutput(sk, c, 0)
+	out.format = "plain"
+	go out.run()
+	p := newPrinters(c, out)
+	t.Cleanup(func() {
+		p.StopAll(5 * time.Second)
+		out.Close()
+	})
+	mustAdd(t, p, spec{Name: "a", Period: 1}, spec{Name: "b", Period: 2})
+	waitTimers(t, c, 2)
+
+	// a prints every second, and b every other one. The batches of the output
+	// are written when the clock moves, here without it leaving the second.
+	for i := 1; i <= 10; i++ {
+		c.Advance(time.Second)
+		waitFor(t, "the lines", func() bool {
+			c.Advance(0)
+			return len(sk.Lines()) == i+i/2
+		})
+	}
+
+	var got struct {
+		Last    float64 `json:"last_second"`
+		Average float64 `json:"average"`
+		Window  int     `json:"window_seconds"`
+	}
+	if err := json.NewDecoder(serve(t, newTestServer(p), http.MethodGet, "/api/rate", "").Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	// The lines of the current second, at 10s, aren't counted yet: there were 13
+	// lines from 0s to 9s, the last second having only the one of a.
+	if got.Last != 1 || got.Average != 1.3 || got.Window != rateWindow {
+		t.Errorf("got %+v, want 1 line in the last second and 1.3 per second on average", got)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMarkReady(t *testing.T) {
+	tests := []struct {
+		name string
+		// Whether one printer's goroutine doesn't run yet, and starts or never does.
+		slow, starts bool
+	}{
+		{"all running", false, false},
+		{"one starting late", true, true},
+		{"one never starting", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClock()
+			p, _ := newTestPrinters(t, c)
+			mustAdd(t, p, spec{Name: "a", Period: 1}, spec{Name: "b", Period: 1})
+			running := make(chan struct{})
+			if tt.slow {
+				// A printer as added before its goroutine runs.
+				p.mu.Lock()
+				p.l["slow"] = &printer{running: running}
+				p.mu.Unlock()
+				t.Cleanup(func() {
+					p.mu.Lock()
+					delete(p.l, "slow")
+					p.mu.Unlock()
+				})
+			}
+			waitTimers(t, c, 2)
+			s := newTestServer(p)
+			s.ready = new(atomic.Bool)
+			if w := serve(t, s, http.MethodGet, "/readyz", ""); w.Code != http.StatusServiceUnavailable {
+				t.Fatalf("status %d before the printers run, want 503", w.Code)
+			}
+			go s.markReady(startTimeout)
+			if tt.slow {
+				// The printers' tickers, and the timer of the timeout.
+				waitTimers(t, c, 3)
+				time.Sleep(10 * time.Millisecond)
+				if w := serve(t, s, http.MethodGet, "/readyz", ""); w.Code != http.StatusServiceUnavailable {
+					t.Fatalf("status %d with a printer not running, want 503", w.Code)
+				}
+				if tt.starts {
+					close(running)
+				} else {
+					c.Advance(startTimeout)
+				}
+			}
+			waitFor(t, "the server to be ready", func() bool {
+				return serve(t, s, http.MethodGet, "/readyz", "").Code == http.StatusOK
+			})
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+)
+
+// Reconcile changes the running printers into the wanted ones: the missing
+// printers are added, the ones that aren't wanted are stopped, pinned or not,
+// and the ones whose spec changed are stopped and added again. The unchanged
+// printers keep running, unless they mirror a printer that is added again.
+// It returns what changed, and the errors of the printers that couldn't be added.
+func (p *printers) Reconcile(wanted []spec) (specDiff, []error) {
+	d := diffSpecs(p.Specs(), wanted)
+	restart := make(map[string]bool)
+	for _, name := range d.Remove {
+		p.Stop(name, true)
+	}
+	for _, c := range d.Modify {
+		p.Stop(c.Name, true)
+		restart[c.Name] = true
+	}
+	for _, sp := range d.Add {
+		restart[sp.Name] = true
+	}
+
+	var errs []error
+	sorted, err := sortMirrors(wanted)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, sp := range sorted {
+		// The shadow printers are stopped with their source, and added back after it.
+		if !restart[sp.Name] && !p.gone(sp.Name) {
+			continue
+		}
+		if err := p.Add(sp); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sp.Name, err))
+		}
+	}
+	return d, errs
+}
+
+// gone reports whether there is no printer for this string, or if it is stopping.
+func (p *printers) gone(s string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pr, ok := p.l[s]
+	return !ok || pr.stopping
+}
+
+// reloadOnSignal reconciles the printers with the state file each time a signal
+// is received on `sig`, until ctx is done. The flags can't be reloaded, they
+// need a restart.
+func reloadOnSignal(ctx context.Context, sig <-chan os.Signal, st *state, p *printers) {
+	for {
+		select {
+		case <-sig:
+			if st == nil {
+				slog.Warn("nothing to reload without -state")
+				continue
+			}
+			specs, err := st.Load()
+			if err != nil {
+				slog.Error("failed to reload the state, keeping the current printers", "path", st.path, "error", err)
+				continue
+			}
+			specs = slices.DeleteFunc(specs, func(sp spec) bool {
+				if sp.Guard != "" && !cfg.AllowExec {
+					slog.Warn("not reloading a printer: guard commands are disabled, start the server with -allow-exec", "name", sp.Name)
+					return true
+				}
+				return false
+			})
+			d, errs := p.Reconcile(specs)
+			for _, err := range errs {
+				slog.Warn("failed to reload a printer", "error", err)
+			}
+			slog.Info("reloaded the state", "path", st.path, "added", len(d.Add), "removed", len(d.Remove), "modified", len(d.Modify))
+			slog.Info("the flags are not reloaded, restart to change them")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
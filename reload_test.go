@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name   string
+		wanted []spec
+		// Names of the printers after reconciling, the ones kept running, and the
+		// number of errors.
+		names []string
+		kept  []string
+		errs  int
+	}{
+		{"unchanged", []spec{{Name: "a", Period: 60}, {Name: "b", Period: 60, Pinned: true}}, []string{"a", "b"}, []string{"a", "b"}, 0},
+		{"added", []spec{{Name: "a", Period: 60}, {Name: "b", Period: 60, Pinned: true}, {Name: "c", Period: 5}}, []string{"a", "b", "c"}, []string{"a", "b"}, 0},
+		{"removed, even pinned", []spec{{Name: "a", Period: 60}}, []string{"a"}, []string{"a"}, 0},
+		{"modified", []spec{{Name: "a", Period: 30}, {Name: "b", Period: 60, Pinned: true}}, []string{"a", "b"}, []string{"b"}, 0},
+		{"invalid", []spec{{Name: "a", Period: 60}, {Name: "b", Period: 60, Pinned: true}, {Name: "c"}}, []string{"a", "b"}, []string{"a", "b"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			mustAdd(t, p, spec{Name: "a", Period: 60}, spec{Name: "b", Period: 60, Pinned: true})
+			ids := make(map[string]int64)
+			for _, info := range p.List() {
+				ids[info.Name] = info.ID
+			}
+
+			_, errs := p.Reconcile(tt.wanted)
+			if len(errs) != tt.errs {
+				t.Errorf("got the errors %v, want %d", errs, tt.errs)
+			}
+			waitFor(t, "the printers", func() bool {
+				var names []string
+				for _, info := range p.List() {
+					names = append(names, info.Name)
+				}
+				slices.Sort(names)
+				return slices.Equal(names, tt.names)
+			})
+			for _, info := range p.List() {
+				if kept := ids[info.Name] == info.ID; kept != slices.Contains(tt.kept, info.Name) {
+					t.Errorf("%s kept running %t, want %t", info.Name, kept, !kept)
+				}
+			}
+			if a, _ := p.Get("a"); a.Period != tt.wanted[0].Period {
+				t.Errorf("a has the period %d, want %d", a.Period, tt.wanted[0].Period)
+			}
+		})
+	}
+}
+
+func TestReloadOnSignal(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 60}, spec{Name: "b", Period: 60})
+	path := filepath.Join(t.TempDir(), "state.json")
+	st := &state{path: path, logger: slog.New(slog.NewTextHandler(io.Discard, nil)), format: stateFormat("auto", path)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hup := make(chan os.Signal, 1)
+	go reloadOnSignal(ctx, hup, st, p)
+
+	// The state file is edited, and the printers follow it on SIGHUP.
+	if err := st.Flush(func() []spec { return []spec{{Name: "a", Period: 60}, {Name: "c", Period: 10}} }); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := p.Get("a")
+	hup <- syscall.SIGHUP
+	waitFor(t, "the new printers", func() bool {
+		_, b := p.Get("b")
+		_, c := p.Get("c")
+		return !b && c
+	})
+	if info, _ := p.Get("a"); info.ID != a.ID {
+		t.Error("the unchanged printer was restarted")
+	}
+
+	// A state that can't be read keeps the current printers.
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Once the third signal is received, the first one was handled.
+	for range 3 {
+		hup <- syscall.SIGHUP
+	}
+	if n := len(p.List()); n != 2 {
+		t.Errorf("%d printers after reloading a broken state, want the 2 from before", n)
+	}
+	if err := st.Flush(func() []spec { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	hup <- syscall.SIGHUP
+	waitFor(t, "the printers to be removed", func() bool { return len(p.List()) == 0 })
+}
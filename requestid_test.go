@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// withLogs sends the default logger to the returned buffer for the duration of the test.
+func withLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	return &buf
+}
+
+func TestRequestID(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{16}$`)
+	tests := []struct {
+		name string
+		sent string
+		// Empty for a generated ID.
+		want string
+	}{
+		{"sent", "abc-123", "abc-123"},
+		{"none", "", ""},
+		{"with a space", "abc 123", ""},
+		{"with a newline", "abc\n123", ""},
+		{"too long", strings.Repeat("a", maxRequestIDLen+1), ""},
+		{"longest", strings.Repeat("a", maxRequestIDLen), strings.Repeat("a", maxRequestIDLen)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := withLogs(t)
+			var inHandler string
+			h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inHandler = requestID(r.Context())
+				requestLogger(r).Error("failing")
+				http.Error(w, "failed", http.StatusTeapot)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/x", nil)
+			if tt.sent != "" {
+				r.Header.Set(requestIDHeader, tt.sent)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			id := w.Header().Get(requestIDHeader)
+			if tt.want != "" && id != tt.want || tt.want == "" && !generated.MatchString(id) {
+				t.Errorf("responded with the id %q, want %q or a generated one", id, tt.want)
+			}
+			if inHandler != id {
+				t.Errorf("the handler got the id %q, want %q", inHandler, id)
+			}
+			lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+			if len(lines) != 2 || !strings.Contains(lines[0], "msg=failing") || !strings.Contains(lines[1], "msg=request") || !strings.Contains(lines[1], "status=418") {
+				t.Fatalf("logged %q, want the error then the access log", lines)
+			}
+			for _, l := range lines {
+				if !strings.Contains(l, "request_id="+id) {
+					t.Errorf("no request id in %q", l)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// suspend moves the clock forward by d like a system sleeping: the wall clock
+// does, the timers don't count it and are due that much later.
+func suspend(c *fakeClock, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		t.at = t.at.Add(d)
+	}
+}
+
+func TestResume(t *testing.T) {
+	tests := []struct {
+		name   string
+		resume string
+		sleep  time.Duration
+		// Lines right after the resume, and times it was counted.
+		lines   int
+		resumes int64
+	}{
+		{"catchup", "catchup", 10 * time.Minute, 2, 1},
+		{"skip", "skip", 10 * time.Minute, 1, 1},
+		{"short sleep", "skip", 20 * time.Second, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClock()
+			p, sk := newTestPrinters(t, c)
+			p.resume = tt.resume
+			mustAdd(t, p, spec{Name: "a", Period: 60})
+			waitTimers(t, c, 1)
+			tick(t, c, time.Minute, sk, 1)
+
+			suspend(c, tt.sleep)
+			c.Advance(time.Minute)
+			waitFor(t, "the late tick", func() bool {
+				return len(sk.Lines()) == tt.lines && p.Stats().Resumes == tt.resumes
+			})
+			// Nothing else is printed for it.
+			time.Sleep(10 * time.Millisecond)
+			if got := len(sk.Lines()); got != tt.lines {
+				t.Errorf("%d lines after resuming, want %d", got, tt.lines)
+			}
+			// The next tick is printed whatever the policy.
+			tick(t, c, time.Minute, sk, tt.lines+1)
+		})
+	}
+}
+
+func TestResumeConfig(t *testing.T) {
+	for _, policy := range resumePolicies {
+		c := parseFlags(t, "-resume", policy)
+		p, _ := newTestPrinters(t, realClock{})
+		s := newTestServer(p)
+		s.config = &c
+		var got struct{ Resume string }
+		if err := json.NewDecoder(serve(t, s, http.MethodGet, "/api/config", "").Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Resume != policy {
+			t.Errorf("/api/config reports %q, want %q", got.Resume, policy)
+		}
+	}
+	c := parseFlags(t, "-resume", "later")
+	if errs, _ := c.validate(); len(errs) == 0 {
+		t.Error("no error for -resume later")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suffix of the rotated files, after the name of the file and a dot. It sorts
+// in chronological order.
+const rotateSuffix = "2006-01-02T15-04-05.000"
+
+// rotatingFile is the -out file, renamed with the time as a suffix and replaced
+// by a new one when it grows past maxSize bytes or gets older than maxAge. Only
+// the last maxBackups rotated files are kept. Zero disables each of them.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	clock      Clock
+
+	// The output writes from a single goroutine, the lock is for Close.
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	created time.Time
+}
+
+// newRotatingFile rotates the file `f` opened at `path`, which must be a regular file.
+func newRotatingFile(f *os.File, path string, clock Clock) (*rotatingFile, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	return &rotatingFile{path: path, clock: clock, f: f, size: fi.Size(), created: clock.Now()}, nil
+}
+
+func (r *rotatingFile) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	tooLarge := r.maxSize > 0 && r.size+int64(len(b)) > r.maxSize
+	tooOld := r.maxAge > 0 && now.Sub(r.created) >= r.maxAge
+	// An empty file is never rotated, even if a single line is too large for it.
+	if r.size > 0 && (tooLarge || tooOld) {
+		if err := r.rotate(now); err != nil {
+			// Keep writing to the current file rather than losing lines.
+			slog.Warn("failed to rotate the -out file", "path", r.path, "error", err)
+		}
+	}
+	n, err := r.f.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file and opens a new one. The lock must be held.
+func (r *rotatingFile) rotate(now time.Time) error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	backup := r.path + "." + now.Format(rotateSuffix)
+	renameErr := os.Rename(r.path, backup)
+	// Reopen even if the rename failed, the old file is closed.
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size, r.created = f, fi.Size(), now
+	if renameErr != nil {
+		return renameErr
+	}
+	r.removeBackups()
+	return nil
+}
+
+// removeBackups removes the oldest rotated files past maxBackups.
+func (r *rotatingFile) removeBackups() {
+	if r.maxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return
+	}
+	var backups []string
+	for _, m := range matches {
+		if _, err := time.Parse(rotateSuffix, strings.TrimPrefix(m, r.path+".")); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > r.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			slog.Warn("failed to remove a rotated -out file", "path", backups[0], "error", err)
+		}
+		backups = backups[1:]
+	}
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
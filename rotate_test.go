@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openRotating returns a rotating file in a new directory.
+func openRotating(t *testing.T, c Clock, maxSize int64, maxAge time.Duration, maxBackups int) *rotatingFile {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "out.log")
+	f, err := openOut(path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf, err := newRotatingFile(f, path, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf.maxSize, rf.maxAge, rf.maxBackups = maxSize, maxAge, maxBackups
+	t.Cleanup(func() { rf.Close() })
+	return rf
+}
+
+// rotatedFiles returns the contents of the backups, oldest first, and of the current file.
+func rotatedFiles(t *testing.T, rf *rotatingFile) (backups []string, current string) {
+	t.Helper()
+	matches, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(matches)
+	for _, m := range matches {
+		b, _ := os.ReadFile(m)
+		backups = append(backups, string(b))
+	}
+	b, _ := os.ReadFile(rf.path)
+	return backups, string(b)
+}
+
+func TestRotateSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBackups int
+		backups    []string
+	}{
+		{"all backups", 0, []string{"line 0\nline 1\n", "line 2\nline 3\n"}},
+		{"last backup", 1, []string{"line 2\nline 3\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClock()
+			rf := openRotating(t, c, 14, 0, tt.maxBackups)
+			for i := range 5 {
+				// The backups are named after the time, to the millisecond.
+				c.Advance(time.Millisecond)
+				if _, err := fmt.Fprintf(rf, "line %d\n", i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			backups, current := rotatedFiles(t, rf)
+			if strings.Join(backups, "|") != strings.Join(tt.backups, "|") || current != "line 4\n" {
+				t.Errorf("got the backups %q and %q, want %q and the last line", backups, current, tt.backups)
+			}
+		})
+	}
+}
+
+func TestRotateAge(t *testing.T) {
+	c := newFakeClock()
+	rf := openRotating(t, c, 0, time.Hour, 0)
+	rf.Write([]byte("old\n"))
+	c.Advance(59 * time.Minute)
+	rf.Write([]byte("still\n"))
+	c.Advance(time.Minute)
+	rf.Write([]byte("new\n"))
+	backups, current := rotatedFiles(t, rf)
+	if len(backups) != 1 || backups[0] != "old\nstill\n" || current != "new\n" {
+		t.Errorf("got the backups %q and %q, want one after an hour", backups, current)
+	}
+	if want := rf.path + "." + c.Now().Format(rotateSuffix); !fileExists(want) {
+		t.Errorf("no backup %s", want)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestRotateLargeLine(t *testing.T) {
+	rf := openRotating(t, newFakeClock(), 4, 0, 0)
+	// An empty file isn't rotated, even for a line too large for it.
+	rf.Write([]byte("a long line\n"))
+	if backups, current := rotatedFiles(t, rf); len(backups) != 0 || current != "a long line\n" {
+		t.Errorf("got the backups %q and %q, want the line in the file", backups, current)
+	}
+}
+
+func TestRotateNotRegular(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := newRotatingFile(f, dir, realClock{}); err == nil {
+		t.Error("a directory is rotated")
+	}
+}
+
+func TestRotateConcurrent(t *testing.T) {
+	c := newFakeClock()
+	rf := openRotating(t, c, 100, 0, 0)
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				// Keeps the names of the backups apart.
+				c.Advance(time.Millisecond)
+				fmt.Fprintf(rf, "%d-%02d\n", i, j)
+			}
+		}()
+	}
+	wg.Wait()
+	backups, current := rotatedFiles(t, rf)
+	if n := strings.Count(strings.Join(backups, "")+current, "\n"); n != 200 {
+		t.Errorf("%d lines in %d files, want all 200", n, len(backups)+1)
+	}
+}
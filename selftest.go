@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// How long the self-test waits for its printer to tick.
+const selftestTimeout = 5 * time.Second
+
+// selftestStep is the outcome of one step of the self-test.
+type selftestStep struct {
+	Step     string  `json:"step"`
+	OK       bool    `json:"ok"`
+	Duration float64 `json:"duration_seconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// handleSelftest adds a printer with a unique name, waits for it to tick once,
+// and stops it, reporting how each step went. The printer is ephemeral, neither
+// saved nor sent to the webhook, and stopped even when a step fails. It returns
+// a 503 if any step failed.
+func (s *server) handleSelftest(w http.ResponseWriter, r *http.Request) {
+	name := "selftest-" + newRequestID()
+	resp := struct {
+		OK    bool           `json:"ok"`
+		Name  string         `json:"name"`
+		Steps []selftestStep `json:"steps"`
+	}{OK: true, Name: name}
+	step := func(label string, f func() error) bool {
+		start := s.printers.clock.Now()
+		err := f()
+		st := selftestStep{Step: label, OK: err == nil, Duration: s.printers.clock.Now().Sub(start).Seconds()}
+		if err != nil {
+			st.Error = err.Error()
+			resp.OK = false
+		}
+		resp.Steps = append(resp.Steps, st)
+		return err == nil
+	}
+
+	added := step("add", func() error {
+		return s.printers.AddEphemeral(spec{Name: name, Period: 1})
+	})
+	if added {
+		step("tick", func() error { return s.waitTick(r, name) })
+		step("stop", func() error {
+			if res := s.printers.Stop(name, true); res != stopped {
+				return errors.New(res.String())
+			}
+			return nil
+		})
+	}
+	s.audit(r, "selftest", name, map[string]bool{"ok": resp.OK})
+
+	status := http.StatusOK
+	if !resp.OK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, r, status, resp)
+}
+
+// waitTick waits for the printer to tick once, up to selftestTimeout.
+func (s *server) waitTick(r *http.Request, name string) error {
+	ticker := s.printers.clock.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := s.printers.clock.NewTimer(selftestTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			info, ok := s.printers.Get(name)
+			if !ok {
+				return errors.New("the printer disappeared before ticking")
+			}
+			if info.LastTick != nil {
+				return nil
+			}
+		case <-timeout.C():
+			info, _ := s.printers.Get(name)
+			if info.Error != "" {
+				return fmt.Errorf("no tick within %s: %s", selftestTimeout, info.Error)
+			}
+			return fmt.Errorf("no tick within %s", selftestTimeout)
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSelftest(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "user", Period: 60})
+	var changes atomic.Int32
+	p.onChange = func() { changes.Add(1) }
+	s := newTestServer(p)
+
+	w := serve(t, s, http.MethodPost, "/api/selftest", "")
+	var resp struct {
+		OK    bool
+		Name  string
+		Steps []selftestStep
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || !resp.OK || !strings.HasPrefix(resp.Name, "selftest-") {
+		t.Fatalf("status %d: %+v", w.Code, resp)
+	}
+	var steps []string
+	for _, st := range resp.Steps {
+		steps = append(steps, st.Step)
+		if !st.OK || st.Error != "" {
+			t.Errorf("step %+v failed", st)
+		}
+	}
+	if strings.Join(steps, ",") != "add,tick,stop" {
+		t.Errorf("steps %q, want add, tick and stop", steps)
+	}
+
+	waitFor(t, "the printer to stop", func() bool { _, ok := p.Get(resp.Name); return !ok })
+	if got := p.List(); len(got) != 1 || got[0].Name != "user" {
+		t.Errorf("printers %+v, want only the one of the user", got)
+	}
+	// The printer of the self-test is never saved.
+	if n := changes.Load(); n != 0 {
+		t.Errorf("%d changes to save", n)
+	}
+	if entries := s.auditLog.Entries(); len(entries) != 1 || entries[0].Op != "selftest" || entries[0].Name != resp.Name {
+		t.Errorf("audit log %+v, want the self-test", entries)
+	}
+}
+
+func TestSelftestFails(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	p.Freeze(0)
+	w := serve(t, newTestServer(p), http.MethodPost, "/api/selftest", "")
+	var resp struct {
+		OK    bool
+		Steps []selftestStep
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusServiceUnavailable || resp.OK {
+		t.Errorf("status %d and ok %t, want a failure", w.Code, resp.OK)
+	}
+	if len(resp.Steps) != 1 || resp.Steps[0].Step != "add" || resp.Steps[0].Error != ErrFrozen.Error() {
+		t.Errorf("steps %+v, want only the failed add", resp.Steps)
+	}
+}
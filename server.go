@@ -0,0 +1,434 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
+)
+
+// server holds what the HTTP handlers need to reach the printers.
+type server struct {
+	printers *printers
+	// Where the printers are saved, nil if they are not.
+	state *state
+	// Rejects every request that is not a read.
+	readOnly bool
+	// Theme of the HTML page.
+	theme string
+	// Only serves the API, without the HTML page.
+	apiOnly bool
+	// Path every route is served under, without a trailing slash, empty for the root.
+	basePath string
+	// Presets printers can be added from, nil if there are none.
+	presets presets
+	// Operations done through the API and the page, nil if they aren't recorded.
+	auditLog *auditLog
+	// Compresses the large responses for the clients accepting gzip.
+	gzip bool
+	// Shuts the server down at the end of a drain, nil if draining isn't supported.
+	quit       func()
+	drainGrace time.Duration
+	// Configuration returned by GET /api/config.
+	config *config
+	// Maximum size of the request bodies in bytes, 0 for no limit.
+	maxBody int64
+	// What to do when adding a printer whose name is taken, one of dupesModes.
+	dupes string
+	// Bearer token the requests must be sent with, empty for none, and
+	// whether the reads don't need it.
+	token    string
+	readOpen bool
+	// Serves the goroutine stacks on /debug/stacks.
+	debug bool
+	// Endpoints turned off by -disable, see disableEndpoints.
+	disabled map[string]bool
+	// Set once the goroutines of the startup printers run, shared by every listener.
+	ready *atomic.Bool
+}
+
+// Modes accepted by -dupes.
+var dupesModes = []string{"reject", "suffix"}
+
+// add adds a printer for a request, and returns the name it was added with,
+// which is normalized with -normalize, and has a suffix if the name was taken
+// and -dupes is suffix.
+func (s *server) add(sp spec) (string, error) {
+	if s.dupes == "suffix" {
+		return s.printers.AddSuffixed(sp)
+	}
+	return s.printers.add(sp, false, false)
+}
+
+// routes registers every handler of the application and returns the handler to serve.
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	if s.apiOnly {
+		mux.HandleFunc("/", http.NotFound)
+	} else {
+		mux.HandleFunc("/", s.handleIndex)
+	}
+	// The routes of the endpoints turned off by -disable answer 404, rather than
+	// falling through to the page.
+	handle := func(endpoint, pattern string, h http.HandlerFunc) {
+		if s.disabled[endpoint] {
+			h = http.NotFound
+		}
+		mux.HandleFunc(pattern, h)
+	}
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	mux.HandleFunc("GET /api/printers", s.handleList)
+	handle("export", "GET /api/printers.csv", s.handleListCSV)
+	handle("export", "GET /api/printers.txt", s.handleListText)
+	handle("export", "GET /api/export.sh", s.handleExportScript)
+	handle("colors", "GET /api/colors", s.handleColors)
+	handle("stop-matching", "POST /api/printers/stop", s.handleStopMatching)
+	handle("bulk", "POST /api/printers/bulk", s.handleBulkAdd)
+	handle("period-matching", "POST /api/printers/period", s.handleSetPeriodMatching)
+	mux.HandleFunc("GET /api/printers/{name}", s.handleGet)
+	mux.HandleFunc("HEAD /api/printers/{name}", s.handleHead)
+	mux.HandleFunc("PATCH /api/printers/{name}", s.handlePatch)
+	mux.HandleFunc("DELETE /api/printers/{name}", s.handleDelete)
+	mux.HandleFunc("GET /api/printers/id/{id}", s.handleGetByID)
+	// Not under /api/printers/{name}/, where it would conflict with the route above.
+	handle("last", "GET /api/last/{name}", s.handleLast)
+	handle("poll", "GET /api/poll", s.handlePoll)
+	mux.HandleFunc("DELETE /api/printers/id/{id}", s.handleDeleteByID)
+	handle("boost", "POST /api/printers/{name}/boost", s.handleBoost)
+	handle("presets", "POST /api/presets/{preset}/printers", s.handleAddFromPreset)
+	handle("presets", "GET /api/presets", s.handleListPresets)
+	handle("resync", "POST /api/resync", s.handleResync)
+	handle("diff", "POST /api/diff", s.handleDiff)
+	handle("stats", "GET /api/stats", s.handleStats)
+	handle("audit", "GET /api/audit", s.handleAudit)
+	handle("errors", "GET /api/errors", s.handleErrors)
+	handle("rate", "GET /api/rate", s.handleRate)
+	handle("config", "GET /api/config", s.handleConfig)
+	handle("status", "GET /api/status", s.handleStatus)
+	handle("freeze", "POST /api/freeze", s.handleFreeze)
+	handle("freeze", "POST /api/unfreeze", s.handleUnfreeze)
+	handle("pause-all", "POST /api/pause-all", s.handlePauseAll)
+	handle("pause-all", "POST /api/resume-all", s.handleResumeAll)
+	handle("drain", "POST /api/drain", s.handleDrain)
+	handle("selftest", "POST /api/selftest", s.handleSelftest)
+	handle("compact", "POST /api/state/compact", s.handleCompactState)
+	// Answers 404 without -debug, rather than falling through to the page.
+	if s.debug {
+		mux.HandleFunc("GET /debug/stacks", s.handleStacks)
+	} else {
+		mux.HandleFunc("GET /debug/stacks", http.NotFound)
+	}
+	var h http.Handler = mux
+	if s.maxBody > 0 {
+		h = limitBodies(h, s.maxBody)
+	}
+	if s.readOnly {
+		h = rejectWrites(h)
+	}
+	if s.gzip {
+		h = withGzip(h)
+	}
+	if s.token != "" {
+		h = requireToken(h, s.token, s.readOpen)
+	}
+	if s.basePath != "" {
+		root := http.NewServeMux()
+		root.Handle(s.basePath+"/", http.StripPrefix(s.basePath, h))
+		h = root
+	}
+	return withRequestID(h)
+}
+
+// withH2C serves h over HTTP/2 over cleartext too. It accepts both HTTP/2 with prior
+// knowledge and upgrades from HTTP/1.1, and falls back to HTTP/1.1 for the other clients.
+func withH2C(h http.Handler) http.Handler {
+	return h2c.NewHandler(h, &http2.Server{})
+}
+
+// newHTTPServer returns a server of h on addr, with the timeouts of the configuration.
+func newHTTPServer(addr string, h http.Handler, c *config) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		// No route streams its response, they can all be cut off once the
+		// long polls of /api/poll return.
+		WriteTimeout: c.WriteTimeout,
+		IdleTimeout:  c.IdleTimeout,
+	}
+}
+
+// listenerServer returns the HTTP server of one -http address, on the printers
+// of s, and read-only with -readonly or if the address is.
+func (s *server) listenerServer(la listenAddr, c *config) *http.Server {
+	lsrv := *s
+	lsrv.readOnly = c.ReadOnly || la.readOnly
+	var handler http.Handler = lsrv.routes()
+	if c.HTTP2 {
+		handler = withH2C(handler)
+	}
+	return newHTTPServer(la.addr, handler, c)
+}
+
+// listen listens on the TCP address, with at most maxConns connections at once if
+// it is positive. Past the limit, new connections wait in the listen backlog until
+// one is closed.
+func listen(addr string, maxConns int) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if maxConns > 0 {
+		l = netutil.LimitListener(l, maxConns)
+	}
+	return l, nil
+}
+
+// cleanBasePath returns the path given to -basepath with a leading slash and
+// without a trailing one, or an error if it isn't a clean path.
+func cleanBasePath(p string) (string, error) {
+	p = strings.TrimSuffix(p, "/")
+	if p == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	if path.Clean(p) != p || strings.ContainsAny(p, "?#{}") {
+		return "", errors.New("expected a path such as /ticker")
+	}
+	return p, nil
+}
+
+// Default of -maxbody, far more than the form or any reasonable bulk payload needs.
+const defaultMaxBody = 64 << 10
+
+// limitBodies makes reading more than `n` bytes of a request body fail, see bodyError.
+func limitBodies(h http.Handler, n int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// bodyError replies to a request whose body couldn't be read or parsed: with a
+// 413 if it was larger than -maxbody, and with a 400 and `msg` otherwise.
+func bodyError(w http.ResponseWriter, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("Request body too large, the limit is %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, msg, http.StatusBadRequest)
+}
+
+// rejectWrites only lets through the requests that can't change anything.
+func rejectWrites(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			h.ServeHTTP(w, r)
+		default:
+			http.Error(w, "The server is read-only", http.StatusForbidden)
+		}
+	})
+}
+
+// page returns the data to render the templates with.
+func (s *server) page() pageData {
+	return pageData{
+		Printers: s.printers.List(),
+		Stats:    s.printers.Stats(),
+		ReadOnly: s.readOnly,
+		Theme:    s.theme,
+		Base:     s.basePath,
+	}
+}
+
+// handleIndex serves the HTML page on GET, and the HTMX form actions on POST.
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			bodyError(w, err, "Error parsing form data")
+			return
+		}
+
+		// If there's a "stop" at true, it means a "stop" button was clicked,
+		// and thus we should try to stop a printer.
+		// A stop that fails renders the table again with the error, so that
+		// HTMX still has something to swap.
+		var stopErr, stoppedName string
+		stop := r.FormValue("stop")
+		requestLogger(r).Debug("form submitted", "stop", stop, "item", r.FormValue("item"))
+		if stop == "true" {
+			item := r.FormValue("item")
+			if item == "" {
+				stopErr = "No printer to stop was given"
+			} else {
+				switch s.printers.Stop(item, r.FormValue("force") == "true") {
+				case stopped:
+					s.audit(r, "stop", item, nil)
+					stoppedName = item
+				case stopNotFound:
+					stopErr = "No such printer, it may have been stopped already"
+				case stopAlreadyStopping:
+					stopErr = "The printer is already stopping"
+				case stopPinned:
+					stopErr = "The printer is pinned, use Force stop"
+				}
+			}
+		}
+
+		// If we don't have a "stop" at true, this is probably a request to add
+		// a printer.
+		if stop != "true" && r.FormValue("text") != "" {
+
+			sp, err := specFromForm(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// Guards run arbitrary commands, so they must be explicitly allowed.
+			if sp.Guard != "" && !cfg.AllowExec {
+				http.Error(w, "Guard commands are disabled, start the server with -allow-exec", http.StatusForbidden)
+				return
+			}
+			name, err := s.add(sp)
+			if err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			s.audit(r, "add", name, sp)
+		}
+
+		// We render a partial template, the table, that will be switched out thanks to HTMX,
+		// along with the stats line that HTMX swaps out of band.
+		data := s.page()
+		data.OOB = true
+		data.Error = stopErr
+		if stoppedName != "" {
+			// Its goroutine may not have exited yet, it is left out as if it had.
+			n := len(data.Printers)
+			data.Printers = slices.DeleteFunc(data.Printers, func(pi printerInfo) bool { return pi.Name == stoppedName })
+			data.Stats.Printers -= n - len(data.Printers)
+		}
+		if err := printersTemplate().Execute(w, data); err != nil {
+			requestLogger(r).Error("rendering the printers", "err", err)
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		}
+	} else {
+		// If it's not a post we render the "main" template.
+		if err := formTemplate().Execute(w, s.page()); err != nil {
+			requestLogger(r).Error("rendering the page", "err", err)
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		}
+	}
+}
+
+// specFromForm builds the spec of a printer from the values of the form.
+// Only the text is required, a missing period falls back to the default one.
+// The period can be written as seconds, a duration or a phrase, see parsePeriod.
+func specFromForm(r *http.Request) (spec, error) {
+	sp := spec{
+		Name:   r.FormValue("text"),
+		Guard:  r.FormValue("guard"),
+		Cron:   r.FormValue("cron"),
+		Mirror: r.FormValue("mirror"),
+		Sink:   r.FormValue("sink"),
+		// Checkboxes are only sent when checked.
+		Precise:   r.FormValue("precise") != "",
+		Dim:       r.FormValue("dim") != "",
+		Align:     r.FormValue("align") != "",
+		Countdown: r.FormValue("countdown") != "",
+		Pinned:    r.FormValue("pinned") != "",
+		Cycle:     r.FormValue("cycle") != "",
+	}
+
+	var err error
+	if v := r.FormValue("period"); strings.TrimSpace(v) == "" {
+		requestLogger(r).Debug("using the default period", "name", sp.Name, "period", cfg.DefaultPeriod)
+		sp.Period = cfg.DefaultPeriod
+	} else {
+		d, err := parsePeriod(v)
+		if err != nil {
+			return spec{}, err
+		}
+		sp.Period = int(d / time.Second)
+	}
+
+	if v := strings.TrimSpace(r.FormValue("offset")); v != "" {
+		d, err := parseOffset(v)
+		if err != nil {
+			return spec{}, err
+		}
+		sp.Offset = int(d / time.Second)
+	}
+
+	if sp.Window, err = parseWindow(r.FormValue("start_hour"), r.FormValue("end_hour")); err != nil {
+		return spec{}, err
+	}
+
+	if v := r.FormValue("priority"); v != "" {
+		if sp.Priority, err = strconv.Atoi(v); err != nil {
+			return spec{}, errors.New("priority must be a number")
+		}
+	}
+
+	if v := r.FormValue("minperiod"); v != "" {
+		if sp.MinPeriod, err = strconv.Atoi(v); err != nil {
+			return spec{}, errors.New("minimum period must be a number of seconds")
+		}
+	}
+	if v := r.FormValue("maxperiod"); v != "" {
+		if sp.MaxPeriod, err = strconv.Atoi(v); err != nil {
+			return spec{}, errors.New("maximum period must be a number of seconds")
+		}
+	}
+	if v := r.FormValue("printevery"); v != "" {
+		if sp.Every, err = strconv.Atoi(v); err != nil {
+			return spec{}, errors.New("printevery must be a number of ticks")
+		}
+	}
+	return sp, nil
+}
+
+// handleHealth reports that the server is up.
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// markReady sets the server ready once the goroutines of its printers run, or
+// after `timeout` if some still don't.
+func (s *server) markReady(timeout time.Duration) {
+	if n := s.printers.waitRunning(timeout); n > 0 {
+		slog.Warn("some printers didn't start in time, ready anyway", "printers", n)
+	}
+	s.ready.Store(true)
+}
+
+// handleReady reports whether the server is ready to be sent traffic: the
+// goroutines of the startup printers run, and it isn't draining before shutting down.
+func (s *server) handleReady(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case s.ready != nil && !s.ready.Load():
+		http.Error(w, "starting", http.StatusServiceUnavailable)
+	case s.printers.Draining():
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+	default:
+		fmt.Fprintln(w, "ok")
+	}
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// parseFlags returns the configuration set by the flags.
+func parseFlags(t *testing.T, args ...string) config {
+	t.Helper()
+	var c config
+	fs := flag.NewFlagSet("ticker-printer", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	c.register(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// formRequest returns a request posting the form values.
+func formRequest(values url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestDefaultPeriod(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		period string
+		want   int
+	}{
+		{"no flag, no period", nil, "", 1},
+		{"no flag, blank period", nil, "  ", 1},
+		{"flag, no period", []string{"-defaultperiod", "7"}, "", 7},
+		{"flag, explicit period", []string{"-defaultperiod", "7"}, "3", 3},
+		{"no flag, explicit period", nil, "2m", 120},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, parseFlags(t, tt.args...))
+			sp, err := specFromForm(formRequest(url.Values{"text": {"a"}, "period": {tt.period}}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sp.Period != tt.want {
+				t.Errorf("form period %d, want %d", sp.Period, tt.want)
+			}
+			if tt.period != "" {
+				return
+			}
+			p, _ := newTestPrinters(t, realClock{})
+			serve(t, newTestServer(p), http.MethodPost, "/api/printers/bulk", `[{"name": "a"}]`)
+			if info, ok := p.Get("a"); !ok || info.Period != tt.want {
+				t.Errorf("bulk period %d, want %d", info.Period, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultPeriodValidation(t *testing.T) {
+	c := parseFlags(t, "-defaultperiod", "7")
+	if errs, _ := c.validate(); len(errs) != 0 {
+		t.Errorf("-defaultperiod 7 was rejected: %v", errs)
+	}
+	for _, v := range []string{"0", "-5"} {
+		c = parseFlags(t, "-defaultperiod", v)
+		if errs, _ := c.validate(); len(errs) == 0 {
+			t.Errorf("-defaultperiod %s was accepted", v)
+		}
+	}
+	if _, err := specFromForm(formRequest(url.Values{"text": {"a"}, "period": {"soon"}})); err == nil {
+		t.Error("an invalid period fell back to the default")
+	}
+}
+
+func TestH2C(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	ts := httptest.NewServer(withH2C(newTestServer(p).routes()))
+	defer ts.Close()
+
+	h2 := &http.Client{Transport: &http2.Transport{
+		// Cleartext HTTP/2 with prior knowledge, as a TLS-terminating proxy speaks it.
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, network, addr)
+		},
+	}}
+	tests := []struct {
+		name   string
+		client *http.Client
+		proto  int
+	}{
+		{"http2", h2, 2},
+		{"http1 fallback", ts.Client(), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.client.Get(ts.URL + "/healthz")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resp.ProtoMajor != tt.proto {
+				t.Errorf("status %d over HTTP/%d, want 200 over HTTP/%d", resp.StatusCode, resp.ProtoMajor, tt.proto)
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 60})
+	s := newTestServer(p)
+	s.readOnly = true
+	tests := []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodGet, "/", "", http.StatusOK},
+		{http.MethodGet, "/api/printers", "", http.StatusOK},
+		{http.MethodGet, "/api/printers/a", "", http.StatusOK},
+		{http.MethodGet, "/api/stats", "", http.StatusOK},
+		{http.MethodHead, "/api/printers/a", "", http.StatusOK},
+		{http.MethodPost, "/", "", http.StatusForbidden},
+		{http.MethodPost, "/api/printers/bulk", `[{"name": "b", "period": 1}]`, http.StatusForbidden},
+		{http.MethodPatch, "/api/printers/a", `{"period": 5}`, http.StatusForbidden},
+		{http.MethodDelete, "/api/printers/a", "", http.StatusForbidden},
+		{http.MethodPost, "/api/printers/stop", `{"pattern": "*"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if w := serve(t, s, tt.method, tt.target, tt.body); w.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, w.Code, tt.want)
+		}
+	}
+	if info, ok := p.Get("a"); !ok || info.Period != 60 || len(p.List()) != 1 {
+		t.Error("a mutation went through")
+	}
+	page := serve(t, s, http.MethodGet, "/", "").Body.String()
+	if strings.Contains(page, "<form") || strings.Contains(page, "hx-vals") {
+		t.Error("the page has the form or stop buttons")
+	}
+	s.readOnly = false
+	if page := serve(t, s, http.MethodGet, "/", "").Body.String(); !strings.Contains(page, "<form") || !strings.Contains(page, "hx-vals") {
+		t.Error("the page lacks the form or stop buttons without -readonly")
+	}
+}
+
+func TestMaxConns(t *testing.T) {
+	l, err := listen("127.0.0.1:0", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entered, release := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/block", func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	})
+	mux.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {})
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	// Without keep-alives, each request has its own connection, closed after it.
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	url := "http://" + l.Addr().String()
+	get := func(path string) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			resp, err := client.Get(url + path)
+			if err == nil {
+				resp.Body.Close()
+			}
+			done <- err
+		}()
+		return done
+	}
+
+	// The first connection holds the only slot.
+	blocked := get("/block")
+	<-entered
+	queued := get("/fast")
+	select {
+	case err := <-queued:
+		t.Fatalf("a connection past the limit was served right away: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	for _, done := range []<-chan error{blocked, queued} {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Error(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("a request is still waiting once the first connection closed")
+		}
+	}
+}
+
+func TestAPIOnly(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 60})
+	s := newTestServer(p)
+	s.apiOnly = true
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/", http.StatusNotFound},
+		{http.MethodPost, "/", http.StatusNotFound},
+		{http.MethodGet, "/index.html", http.StatusNotFound},
+		{http.MethodGet, "/api/printers", http.StatusOK},
+		{http.MethodGet, "/api/printers/a", http.StatusOK},
+		{http.MethodGet, "/healthz", http.StatusOK},
+		{http.MethodGet, "/readyz", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := serve(t, s, tt.method, tt.target, ""); w.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, w.Code, tt.want)
+		}
+	}
+}
+
+func TestCleanBasePath(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"", "", false},
+		{"/", "", false},
+		{"/ticker", "/ticker", false},
+		{"/ticker/", "/ticker", false},
+		{"ticker", "/ticker", false},
+		{"/a/b", "/a/b", false},
+		{"/a//b", "", true},
+		{"/a/../b", "", true},
+		{"/a?b", "", true},
+		{"/{name}", "", true},
+	}
+	for _, tt := range tests {
+		got, err := cleanBasePath(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("cleanBasePath(%q) = %q, %v, want %q and an error %t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 60})
+	s := newTestServer(p)
+	s.basePath = "/ticker"
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/ticker/", http.StatusOK},
+		{http.MethodGet, "/ticker/api/printers", http.StatusOK},
+		{http.MethodGet, "/ticker/api/printers/a", http.StatusOK},
+		{http.MethodGet, "/ticker/healthz", http.StatusOK},
+		{http.MethodDelete, "/ticker/api/printers/a", http.StatusNoContent},
+		{http.MethodGet, "/", http.StatusNotFound},
+		{http.MethodGet, "/api/printers", http.StatusNotFound},
+		{http.MethodGet, "/tickers/api/printers", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := serve(t, s, tt.method, tt.target, ""); w.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, w.Code, tt.want)
+		}
+	}
+	waitFor(t, "a to stop", func() bool { return len(p.List()) == 0 })
+	mustAdd(t, p, spec{Name: "b", Period: 60})
+	page := serve(t, s, http.MethodGet, "/ticker/", "").Body.String()
+	if n := strings.Count(page, `hx-post="/ticker/"`); n != 2 {
+		t.Errorf("%d URLs under the base path in the page, want the form and the stop button", n)
+	}
+	if strings.Contains(page, `hx-post="/"`) {
+		t.Error("a URL isn't under the base path")
+	}
+}
+
+func TestOutFormatValidation(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		valid  bool
+	}{{"ansi", true}, {"plain", true}, {"html", true}, {"ndjson", true}, {"xml", false}} {
+		c := parseFlags(t, "-outformat", tt.format)
+		if errs, _ := c.validate(); (len(errs) == 0) != tt.valid {
+			t.Errorf("-outformat %s: errors %v, want valid %t", tt.format, errs, tt.valid)
+		}
+	}
+}
+
+func TestTZValidation(t *testing.T) {
+	tests := []struct {
+		args    []string
+		valid   bool
+		warning bool
+	}{
+		{[]string{"-tz", "Europe/Paris", "-timestamps", "absolute"}, true, false},
+		{[]string{"-tz", "UTC", "-timestamps", "absolute"}, true, false},
+		{[]string{"-timestamps", "absolute"}, true, false},
+		{[]string{"-tz", "Europe/Paris"}, true, true},
+		{[]string{"-tz", "Mars/Olympus", "-timestamps", "absolute"}, false, false},
+	}
+	for _, tt := range tests {
+		c := parseFlags(t, tt.args...)
+		errs, warnings := c.validate()
+		if (len(errs) == 0) != tt.valid {
+			t.Errorf("%q: errors %v, want valid %t", tt.args, errs, tt.valid)
+		}
+		warned := slices.ContainsFunc(warnings, func(w string) bool { return strings.Contains(w, "-tz") })
+		if warned != tt.warning {
+			t.Errorf("%q: warnings %q, want a -tz warning %t", tt.args, warnings, tt.warning)
+		}
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	routes := newTestServer(p).routes()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /body", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestTimeout)
+		}
+	})
+	mux.HandleFunc("GET /slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	})
+	mux.Handle("/", routes)
+
+	tests := []struct {
+		name string
+		args []string
+		// Sent before stalling.
+		request string
+		// Start of what is read back before the connection closes.
+		want string
+	}{
+		{"headers", []string{"-readheadertimeout", "100ms"}, "GET /healthz HTTP/1.1\r\nHost: x\r\n", ""},
+		{"body", []string{"-readheadertimeout", "0", "-readtimeout", "100ms"}, "POST /body HTTP/1.1\r\nHost: x\r\nContent-Length: 10\r\n\r\nab", "HTTP/1.1 408"},
+		{"response", []string{"-writetimeout", "100ms"}, "GET /slow HTTP/1.1\r\nHost: x\r\n\r\n", ""},
+		{"idle", []string{"-idletimeout", "100ms"}, "GET /healthz HTTP/1.1\r\nHost: x\r\n\r\n", "HTTP/1.1 200"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := parseFlags(t, tt.args...)
+			l, err := listen("127.0.0.1:0", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := newHTTPServer(l.Addr().String(), mux, &c)
+			go srv.Serve(l)
+			defer srv.Close()
+
+			// The timeouts start once the connection is accepted.
+			start := time.Now()
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			// Past this, the server didn't cut the connection off.
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, err := io.WriteString(conn, tt.request); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(conn)
+			if err != nil {
+				t.Fatalf("the connection is still open: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+				t.Errorf("cut off after %s, want 100ms", elapsed)
+			}
+			if !strings.HasPrefix(string(got), tt.want) || (tt.want == "" && len(got) != 0) {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeoutDefaults(t *testing.T) {
+	c := parseFlags(t)
+	srv := newHTTPServer(":8080", http.NotFoundHandler(), &c)
+	if srv.ReadHeaderTimeout != 5*time.Second || srv.ReadTimeout != 30*time.Second || srv.WriteTimeout != 30*time.Second || srv.IdleTimeout != 2*time.Minute {
+		t.Errorf("got the timeouts %s, %s, %s and %s, want the defaults of the flags", srv.ReadHeaderTimeout, srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+}
+
+func TestFormStop(t *testing.T) {
+	tests := []struct {
+		name   string
+		values url.Values
+		// The error note, if any, and whether printer a is still in the table.
+		err  string
+		kept bool
+	}{
+		{"no item", url.Values{"stop": {"true"}}, "No printer to stop was given", true},
+		{"empty item", url.Values{"stop": {"true"}, "item": {""}}, "No printer to stop was given", true},
+		{"unknown item", url.Values{"stop": {"true"}, "item": {"missing"}}, "No such printer, it may have been stopped already", true},
+		{"stopped", url.Values{"stop": {"true"}, "item": {"a"}}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			mustAdd(t, p, spec{Name: "a", Period: 60})
+			w := httptest.NewRecorder()
+			newTestServer(p).routes().ServeHTTP(w, formRequest(tt.values))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			body := w.Body.String()
+			// The table is rendered in every case, for HTMX to swap it.
+			if !strings.Contains(body, "<table>") {
+				t.Errorf("no table in %q", body)
+			}
+			if hasErr := strings.Contains(body, `<p role="alert">`); hasErr != (tt.err != "") || !strings.Contains(body, tt.err) {
+				t.Errorf("want the error %q in %q", tt.err, body)
+			}
+			if kept := strings.Contains(body, "<td>a</td>"); kept != tt.kept {
+				t.Errorf("printer in the table %t, want %t", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestMaxBody(t *testing.T) {
+	long := strings.Repeat("x", 200)
+	tests := []struct {
+		method, target, body string
+	}{
+		{http.MethodPost, "/api/printers/bulk", `[{"name": "` + long + `", "period": 5}]`},
+		{http.MethodPost, "/api/diff", `[{"name": "` + long + `", "period": 5}]`},
+		{http.MethodPost, "/api/printers/stop", `{"pattern": "` + long + `"}`},
+		{http.MethodPost, "/api/printers/period", `{"pattern": "` + long + `", "period": 5}`},
+		{http.MethodPost, "/api/printers/a/boost", `{"period": 1, "duration": 3, "x": "` + long + `"}`},
+		{http.MethodPatch, "/api/printers/a", `{"text": "` + long + `"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			mustAdd(t, p, spec{Name: "a", Period: 60})
+			s := newTestServer(p)
+			s.maxBody = 100
+			if w := serve(t, s, tt.method, tt.target, tt.body); w.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("status %d, want 413: %s", w.Code, w.Body)
+			}
+			// Without a limit, the same body goes through.
+			s.maxBody = 0
+			if w := serve(t, s, tt.method, tt.target, tt.body); w.Code == http.StatusRequestEntityTooLarge {
+				t.Errorf("status 413 without a limit")
+			}
+		})
+	}
+}
+
+func TestMaxBodyForm(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	s := newTestServer(p)
+	s.maxBody = 100
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"short", http.StatusOK},
+		{strings.Repeat("x", 200), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, formRequest(url.Values{"text": {tt.text}, "period": {"60"}}))
+		if w.Code != tt.want {
+			t.Errorf("%d bytes of text: status %d, want %d", len(tt.text), w.Code, tt.want)
+		}
+	}
+	if n := len(p.List()); n != 1 {
+		t.Errorf("%d printers, want only the short one", n)
+	}
+}
+
+func TestMaxBodyValidation(t *testing.T) {
+	tests := []struct {
+		args  []string
+		valid bool
+	}{
+		{nil, true},
+		{[]string{"-maxbody", "0"}, true},
+		{[]string{"-maxbody", "1024"}, true},
+		{[]string{"-maxbody", "-1"}, false},
+	}
+	for _, tt := range tests {
+		c := parseFlags(t, tt.args...)
+		if errs, _ := c.validate(); (len(errs) == 0) != tt.valid {
+			t.Errorf("%q: errors %v, want valid %t", tt.args, errs, tt.valid)
+		}
+	}
+	if c := parseFlags(t); c.MaxBody != defaultMaxBody {
+		t.Errorf("default of %d bytes, want %d", c.MaxBody, defaultMaxBody)
+	}
+}
+
+func TestPrefixColorValidation(t *testing.T) {
+	tests := []struct {
+		args    []string
+		valid   bool
+		warning bool
+	}{
+		{nil, true, false},
+		{[]string{"-prefixcolor", "dim"}, true, false},
+		{[]string{"-prefixcolor", "#00FF00"}, true, false},
+		{[]string{"-prefixcolor", "green"}, false, false},
+		{[]string{"-prefixcolor", "dim", "-outformat", "plain"}, true, true},
+	}
+	for _, tt := range tests {
+		c := parseFlags(t, tt.args...)
+		errs, warnings := c.validate()
+		if (len(errs) == 0) != tt.valid {
+			t.Errorf("%q: errors %v, want valid %t", tt.args, errs, tt.valid)
+		}
+		warned := slices.ContainsFunc(warnings, func(w string) bool { return strings.Contains(w, "-prefixcolor") })
+		if warned != tt.warning {
+			t.Errorf("%q: warnings %q, want a -prefixcolor warning %t", tt.args, warnings, tt.warning)
+		}
+	}
+}
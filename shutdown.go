@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How long the shutdown waits for the HTTP server and then for the printers.
+const shutdownTimeout = 5 * time.Second
+
+// shutdownSummary reports what happened during a graceful shutdown.
+type shutdownSummary struct {
+	// Number of printers whose goroutine exited.
+	Stopped int
+	// Names of the printers that did not exit in time.
+	Stuck []string
+	// Errors returned by the shutdown of the HTTP servers, if any.
+	HTTPErr error
+	// Whether the state was flushed, and the error if it failed.
+	// Flushed is false with a nil FlushErr when there was nothing to flush.
+	Flushed  bool
+	FlushErr error
+}
+
+// shutdown stops the HTTP servers together, flushes the state with `flush` if not nil, then stops
+// every printer and their output, and logs a summary as a single line.
+// The state is flushed before the printers are stopped so that it still has all of them.
+func shutdown(httpServers []*http.Server, p *printers, flush func() error, logger *slog.Logger, timeout time.Duration) shutdownSummary {
+	var sum shutdownSummary
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	errs := make([]error, len(httpServers))
+	var wg sync.WaitGroup
+	for i, httpServer := range httpServers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = httpServer.Shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+	sum.HTTPErr = errors.Join(errs...)
+
+	if flush != nil {
+		sum.FlushErr = flush()
+		sum.Flushed = sum.FlushErr == nil
+	}
+
+	sum.Stopped, sum.Stuck = p.StopAll(timeout)
+	if len(sum.Stuck) > 0 {
+		logger.Warn("printers did not stop in time", "stuck", sum.Stuck)
+	}
+	p.out.Close()
+
+	attrs := []any{
+		"printers_stopped", sum.Stopped,
+		"printers_stuck", len(sum.Stuck),
+		"flushed", sum.Flushed,
+	}
+	if sum.HTTPErr != nil {
+		attrs = append(attrs, "http_error", sum.HTTPErr)
+	}
+	if sum.FlushErr != nil {
+		attrs = append(attrs, "flush_error", sum.FlushErr)
+	}
+	logger.Info("shutdown complete", attrs...)
+	return sum
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	errFlush := errors.New("disk full")
+	tests := []struct {
+		name        string
+		flush       func() error
+		wantFlushed bool
+		wantLog     string
+	}{
+		{"nothing to flush", nil, false, "flushed=false"},
+		{"flushed", func() error { return nil }, true, "flushed=true"},
+		{"failed flush", func() error { return errFlush }, false, "flush_error=\"disk full\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := newOutput(&testSink{}, realClock{}, 0)
+			go out.run()
+			p := newPrinters(realClock{}, out)
+			mustAdd(t, p, spec{Name: "a", Period: 60}, spec{Name: "b", Period: 60, Pinned: true})
+
+			var buf bytes.Buffer
+			sum := shutdown(nil, p, tt.flush, slog.New(slog.NewTextHandler(&buf, nil)), time.Second)
+			if sum.Stopped != 2 || len(sum.Stuck) != 0 {
+				t.Errorf("stopped %d and stuck %q, want 2 stopped, pinned included", sum.Stopped, sum.Stuck)
+			}
+			if sum.Flushed != tt.wantFlushed {
+				t.Errorf("flushed %t, want %t", sum.Flushed, tt.wantFlushed)
+			}
+			if tt.flush != nil && !tt.wantFlushed && !errors.Is(sum.FlushErr, errFlush) {
+				t.Errorf("flush error %v, want %v", sum.FlushErr, errFlush)
+			}
+			log := buf.String()
+			if strings.Count(log, "\n") != 1 || !strings.Contains(log, "shutdown complete") || !strings.Contains(log, "printers_stopped=2") || !strings.Contains(log, tt.wantLog) {
+				t.Errorf("logged %q, want a single summary line with %s", log, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestShutdownStuck(t *testing.T) {
+	withConfig(t, config{AllowExec: true})
+	c := newFakeClock()
+	out := newOutput(&testSink{}, realClock{}, 0)
+	go out.run()
+	p := newPrinters(c, out)
+	started := filepath.Join(t.TempDir(), "started")
+	mustAdd(t, p, spec{Name: "slow", Period: 1, Guard: "touch " + started + "; sleep 1"}, spec{Name: "quick", Period: 60})
+	waitTimers(t, c, 2)
+	c.Advance(time.Second)
+	waitFor(t, "the guard", func() bool {
+		_, err := os.Stat(started)
+		return err == nil
+	})
+
+	sum := shutdown(nil, p, nil, slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)), 100*time.Millisecond)
+	if sum.Stopped != 1 || !slices.Equal(sum.Stuck, []string{"slow"}) {
+		t.Errorf("stopped %d and stuck %q, want quick stopped and slow stuck in its guard", sum.Stopped, sum.Stuck)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// sink is a destination for the printed lines.
+type sink interface {
+	// Write receives the line both with colors, for terminals, and without.
+	Write(colored, plain string) error
+}
+
+// writerSink writes lines to an io.Writer, with or without colors.
+type writerSink struct {
+	w     io.Writer
+	color bool
+}
+
+func (s writerSink) Write(colored, plain string) error {
+	if s.color {
+		_, err := io.WriteString(s.w, colored)
+		return err
+	}
+	_, err := io.WriteString(s.w, plain)
+	return err
+}
+
+// stdoutSinks returns the sinks to start from, printing the lines in color to
+// `stdout` unless -nostdout is set.
+func stdoutSinks(c *config, stdout io.Writer) multiSink {
+	if c.NoStdout {
+		return nil
+	}
+	return multiSink{writerSink{w: stdout, color: true}}
+}
+
+// messagesOut returns where the messages that aren't lines of the printers are
+// written: `stdout`, unless the lines are NDJSON, to keep every line of it JSON.
+func messagesOut(c *config, stdout, stderr io.Writer) io.Writer {
+	if c.OutFormat == "ndjson" {
+		return stderr
+	}
+	return stdout
+}
+
+// lastSink keeps the plain variant of the last line written to it.
+type lastSink struct {
+	plain string
+}
+
+func (s *lastSink) Write(_, plain string) error {
+	s.plain = plain
+	return nil
+}
+
+// multiSink writes every line to all of its sinks.
+type multiSink []sink
+
+// Write writes to every sink even if some of them fail, and returns all the errors.
+func (m multiSink) Write(colored, plain string) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Write(colored, plain); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// openNamedSink opens the target of a sink of -sink: stdout or stderr with colors,
+// a network address like -net, or else a file like -out, without colors.
+// The files are returned as a fileSink, to be closed.
+func openNamedSink(target string, clock Clock) (sink, error) {
+	switch target {
+	case "stdout":
+		return writerSink{w: os.Stdout, color: true}, nil
+	case "stderr":
+		return writerSink{w: os.Stderr, color: true}, nil
+	}
+	if network, addr, err := parseNetAddr(target); err == nil {
+		return newNetSink(network, addr, clock), nil
+	}
+	f, err := openOut(target, fifoOpenTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return fileSink{writerSink{w: f}, f}, nil
+}
+
+// fileSink is a writerSink on a file, closed with Close.
+type fileSink struct {
+	writerSink
+	f *os.File
+}
+
+func (s fileSink) Close() error {
+	return s.f.Close()
+}
+
+// How long opening the FIFO of -out waits for a reader.
+const fifoOpenTimeout = 10 * time.Second
+
+// openOut opens the file of -out for appending, creating it if needed. Opening a
+// FIFO blocks until another process opens it for reading, so it fails if none
+// does within `timeout`.
+func openOut(path string, timeout time.Duration) (*os.File, error) {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode()&os.ModeNamedPipe == 0 {
+		return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	}
+
+	type result struct {
+		f   *os.File
+		err error
+	}
+	// The open can't be canceled: once given up on, the goroutine stays blocked in
+	// it until a reader comes, and then closes the file nobody receives.
+	res := make(chan result)
+	abandoned := make(chan struct{})
+	go func() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		select {
+		case res <- result{f, err}:
+		case <-abandoned:
+			if err == nil {
+				f.Close()
+			}
+		}
+	}()
+	slog.Info("waiting for a reader of the FIFO", "path", path)
+	select {
+	case r := <-res:
+		return r.f, r.err
+	case <-time.After(timeout):
+		close(abandoned)
+		return nil, fmt.Errorf("no process opened the FIFO %s for reading within %s", path, timeout)
+	}
+}
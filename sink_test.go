@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultiSink(t *testing.T) {
+	withColors(t)
+	var terminal, file bytes.Buffer
+	c := newFakeClock()
+	out := newOutput(multiSink{writerSink{w: &terminal, color: true}, writerSink{w: &file}}, realClock{}, 0)
+	go out.run()
+	p := newPrinters(c, out)
+	mustAdd(t, p, spec{Name: "tee", Period: 1, Color: "#ff0000"})
+	waitTimers(t, c, 1)
+	c.Advance(time.Second)
+	c.Advance(time.Second)
+	waitFor(t, "the ticks", func() bool {
+		info, _ := p.Get("tee")
+		return info.Ticked == 2
+	})
+	p.StopAll(5 * time.Second)
+	// Writes the lines still queued.
+	out.Close()
+
+	if got := file.String(); got != "0001 tee\n0002 tee\n" {
+		t.Errorf("the file got %q, want both lines without colors", got)
+	}
+	if got := terminal.String(); strings.Count(got, "\n") != 2 || !strings.Contains(got, "\x1b[") || !strings.Contains(got, "tee") {
+		t.Errorf("the terminal got %q, want both lines with colors", got)
+	}
+}
+
+func TestNDJSONMessages(t *testing.T) {
+	tests := []struct {
+		format string
+		// Whether the messages are written to stderr.
+		stderr bool
+	}{
+		{"ndjson", true},
+		{"plain", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			cfg := config{OutFormat: tt.format}
+			old := messages
+			messages = messagesOut(&cfg, &stdout, &stderr)
+			t.Cleanup(func() { messages = old })
+			c := newFakeClock()
+			out := newOutput(stdoutSinks(&cfg, &stdout), realClock{}, 0)
+			out.format = tt.format
+			go out.run()
+			p := newPrinters(c, out)
+			// Neither a printer without a period nor one with a guard is restored.
+			p.restore([]spec{{Name: "bad"}, {Name: "guarded", Period: 1, Guard: "true"}, {Name: "a", Period: 1}}, false)
+			p.addStartup([]spec{{Name: "bad", Period: -1}}, 1)
+			waitTimers(t, c, 1)
+			c.Advance(time.Second)
+			waitFor(t, "the tick", func() bool { return p.Stats().Ticks == 1 })
+			p.StopAll(5 * time.Second)
+			out.Close()
+
+			if !tt.stderr {
+				if !strings.Contains(stdout.String(), "Failed to restore printer bad") {
+					t.Errorf("stdout got %q, want the messages", stdout.String())
+				}
+				return
+			}
+			lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+			if len(lines) != 1 {
+				t.Errorf("stdout got %q, want the line of a only", stdout.String())
+			}
+			for _, l := range lines {
+				if !json.Valid([]byte(l)) {
+					t.Errorf("stdout has the line %q, which isn't JSON", l)
+				}
+			}
+			for _, want := range []string{"Failed to restore printer bad", "Not restoring printer guarded", "Failed to add printer bad"} {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("stderr got %q, want %q", stderr.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestNoStdout(t *testing.T) {
+	tests := []struct {
+		nostdout bool
+		want     string
+	}{
+		{false, "0001 a\n0002 a\n"},
+		{true, ""},
+	}
+	for _, tt := range tests {
+		var stdout, file bytes.Buffer
+		c := newFakeClock()
+		sinks := append(stdoutSinks(&config{NoStdout: tt.nostdout}, &stdout), writerSink{w: &file})
+		out := newOutput(sinks, realClock{}, 0)
+		out.format = "plain"
+		go out.run()
+		p := newPrinters(c, out)
+		mustAdd(t, p, spec{Name: "a", Period: 1})
+		waitTimers(t, c, 1)
+		c.Advance(time.Second)
+		c.Advance(time.Second)
+		waitFor(t, "the ticks", func() bool {
+			info, _ := p.Get("a")
+			return info.Ticked == 2
+		})
+		// The ticks are published either way.
+		if evs, _, _ := p.hub.since(0); len(evs) != 2 {
+			t.Errorf("-nostdout %t: %d events published, want 2", tt.nostdout, len(evs))
+		}
+		p.StopAll(5 * time.Second)
+		out.Close()
+
+		if got := stdout.String(); got != tt.want {
+			t.Errorf("-nostdout %t: stdout got %q, want %q", tt.nostdout, got, tt.want)
+		}
+		if got := file.String(); got != "0001 a\n0002 a\n" {
+			t.Errorf("-nostdout %t: the file got %q, want both lines", tt.nostdout, got)
+		}
+	}
+}
+
+func TestNamedSinks(t *testing.T) {
+	var a, b bytes.Buffer
+	c := newFakeClock()
+	def := &testSink{}
+	out := newOutput(def, realClock{}, 0)
+	out.format = "plain"
+	out.named = map[string]sink{"a": writerSink{w: &a}, "b": writerSink{w: &b}}
+	go out.run()
+	p := newPrinters(c, out)
+	mustAdd(t, p, spec{Name: "to a", Period: 1, Sink: "a"}, spec{Name: "to b", Period: 1, Sink: "b"}, spec{Name: "default", Period: 1})
+	if err := p.Add(spec{Name: "lost", Period: 1, Sink: "c"}); err == nil {
+		t.Error("added a printer with an unknown sink")
+	}
+	waitTimers(t, c, 3)
+	c.Advance(time.Second)
+	waitFor(t, "the ticks", func() bool { return p.Stats().Ticks == 3 })
+	p.StopAll(5 * time.Second)
+	out.Close()
+
+	tests := []struct {
+		sink string
+		got  string
+		want string
+	}{
+		{"a", a.String(), "0001 to a\n"},
+		{"b", b.String(), "0001 to b\n"},
+		{"default", strings.Join(def.Lines(), "\n") + "\n", "0001 default\n"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("the sink %s got %q, want %q", tt.sink, tt.got, tt.want)
+		}
+	}
+}
+
+func TestSinkFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-sink", "err=stderr"}, "err=stderr"},
+		{[]string{"-sink", "log=/var/log/a=b.log", "-sink", "net=udp://127.0.0.1:514"}, "log=/var/log/a=b.log,net=udp://127.0.0.1:514"},
+	}
+	for _, tt := range tests {
+		c := parseFlags(t, tt.args...)
+		if got := c.Sinks.String(); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.args, got, tt.want)
+		}
+	}
+	for _, v := range []string{"stderr", "=stderr", "a=", "a=tcp://nohost", "a\x1b=stderr"} {
+		var f sinkFlags
+		if err := f.Set(v); err == nil {
+			t.Errorf("%q: no error", v)
+		}
+	}
+	var f sinkFlags
+	f.Set("a=stdout")
+	if err := f.Set("a=stderr"); err == nil {
+		t.Error("no error for a sink given twice")
+	}
+}
+
+func TestOpenNamedSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.log")
+	tests := []struct {
+		target string
+		check  func(sink) bool
+	}{
+		{"stdout", func(sk sink) bool { ws, ok := sk.(writerSink); return ok && ws.w == os.Stdout && ws.color }},
+		{"stderr", func(sk sink) bool { ws, ok := sk.(writerSink); return ok && ws.w == os.Stderr && ws.color }},
+		{"tcp://127.0.0.1:5000", func(sk sink) bool {
+			ns, ok := sk.(*netSink)
+			return ok && ns.network == "tcp" && ns.addr == "127.0.0.1:5000"
+		}},
+		{path, func(sk sink) bool { fs, ok := sk.(fileSink); return ok && !fs.color }},
+	}
+	for _, tt := range tests {
+		sk, err := openNamedSink(tt.target, realClock{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.target, err)
+		}
+		if !tt.check(sk) {
+			t.Errorf("%s: got the sink %#v", tt.target, sk)
+		}
+		if fs, ok := sk.(fileSink); ok {
+			fs.Write("", "line\n")
+			fs.Close()
+		}
+	}
+	if b, err := os.ReadFile(path); err != nil || string(b) != "line\n" {
+		t.Errorf("the file has %q and %v, want the line", b, err)
+	}
+	if _, err := openNamedSink(filepath.Join(t.TempDir(), "missing", "a.log"), realClock{}); err == nil {
+		t.Error("no error for a file in a missing directory")
+	}
+}
+
+// failingSink fails every write.
+type failingSink struct{}
+
+func (failingSink) Write(_, _ string) error { return errors.New("broken pipe") }
+
+func TestMultiSinkErrors(t *testing.T) {
+	var a, b bytes.Buffer
+	m := multiSink{writerSink{w: &a}, failingSink{}, writerSink{w: &b}, failingSink{}}
+	err := m.Write("colored\n", "plain\n")
+	if err == nil || strings.Count(err.Error(), "broken pipe") != 2 {
+		t.Errorf("got %v, want both errors", err)
+	}
+	if a.String() != "plain\n" || b.String() != "plain\n" {
+		t.Errorf("got %q and %q, want the line written to every working sink", a.String(), b.String())
+	}
+}
+
+func TestOpenOutFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	for _, s := range []string{"a\n", "b\n"} {
+		f, err := openOut(path, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(s)
+		f.Close()
+	}
+	// A regular file is appended to.
+	if b, _ := os.ReadFile(path); string(b) != "a\nb\n" {
+		t.Errorf("got %q, want both writes", b)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// state saves the specs of the printers to a file, as JSON or gob depending on
+// -stateformat, to restore them at startup.
+//
+// Saving is best-effort: after the first failure, a warning is logged and nothing
+// is saved anymore until Compact succeeds, while the printers keep working.
+type state struct {
+	path   string
+	logger *slog.Logger
+	// Format the file is written in, one of stateFormats other than "auto".
+	format string
+
+	mu sync.Mutex
+	// Set after the first failure to save.
+	failed bool
+	// Set by Flush, nothing is saved after it.
+	closed bool
+}
+
+// Load returns the specs saved in the file, or none if it doesn't exist yet.
+func (st *state) Load() ([]spec, error) {
+	b, err := os.ReadFile(st.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSpecs(b)
+}
+
+// Formats accepted by -stateformat.
+var stateFormats = []string{"auto", "json", "gob"}
+
+// stateFormat returns the format of -stateformat, with "auto" picking gob for
+// the files ending in .gob and JSON for the others.
+func stateFormat(format, path string) string {
+	if format != "auto" {
+		return format
+	}
+	if filepath.Ext(path) == ".gob" {
+		return "gob"
+	}
+	return "json"
+}
+
+// decodeSpecs decodes a file in either format, whatever -stateformat is, so
+// that changing it keeps the printers: a JSON file starts with an array, and
+// never with the bytes of a gob stream, which starts with the length of a type.
+func decodeSpecs(b []byte) ([]spec, error) {
+	var specs []spec
+	if t := bytes.TrimSpace(b); len(t) == 0 || t[0] == '[' || t[0] == 'n' {
+		if err := json.Unmarshal(b, &specs); err != nil {
+			return nil, err
+		}
+		return specs, nil
+	}
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&specs); err != nil {
+		return nil, fmt.Errorf("neither JSON nor gob: %w", err)
+	}
+	return specs, nil
+}
+
+// encodeSpecs encodes the specs in the format, JSON being meant to be read.
+func encodeSpecs(specs []spec, format string) ([]byte, error) {
+	if format == "gob" {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(specs); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return json.MarshalIndent(specs, "", "\t")
+}
+
+// Save writes the specs returned by `specs` to the file.
+// Taking a function means the snapshot is taken under the lock of the state,
+// so that concurrent saves can't write an older snapshot last.
+func (st *state) Save(specs func() []spec) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.failed || st.closed {
+		return
+	}
+	if _, err := st.write(specs()); err != nil {
+		st.failed = true
+		st.logger.Warn("failed to save the state, the printers won't be saved until restart or POST /api/state/compact", "path", st.path, "error", err)
+	}
+}
+
+// Flush writes the specs a last time, and returns an error if it failed or if saving
+// had already failed. Nothing is saved after it.
+func (st *state) Flush(specs func() []spec) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.closed = true
+	if st.failed {
+		return errors.New("saving the state failed earlier")
+	}
+	_, err := st.write(specs())
+	return err
+}
+
+// Compact rewrites the file from the specs returned by `specs`, and returns the
+// number of bytes written. Once it succeeds, saving works again if it had failed.
+func (st *state) Compact(specs func() []spec) (int, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.closed {
+		return 0, errors.New("the state is closed, the server is shutting down")
+	}
+	n, err := st.write(specs())
+	if err != nil {
+		return 0, err
+	}
+	if st.failed {
+		st.failed = false
+		st.logger.Info("saving the state again", "path", st.path)
+	}
+	return n, nil
+}
+
+// write replaces the file with the specs, and returns the number of bytes written.
+// They are written to a temporary file in the same directory which is renamed
+// over the file once synced, so that the file is never left half-written.
+func (st *state) write(specs []spec) (int, error) {
+	b, err := encodeSpecs(specs, st.format)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(st.path), "."+filepath.Base(st.path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	if err := writeSynced(f, b); err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+	if err := os.Rename(f.Name(), st.path); err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// writeSynced writes b to the file, syncs it and closes it, with the mode of a
+// file created by os.WriteFile rather than the one of os.CreateTemp.
+func writeSynced(f *os.File, b []byte) error {
+	_, err := f.Write(b)
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Healthy reports whether the printers are being saved as expected.
+// Without a state file, there is nothing to be unhealthy about.
+func (st *state) Healthy() bool {
+	if st == nil {
+		return true
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return !st.failed
+}
+
+// handleCompactState rewrites the state file from the running printers.
+func (s *server) handleCompactState(w http.ResponseWriter, r *http.Request) {
+	if s.state == nil {
+		http.Error(w, "No state file, start the server with -state", http.StatusConflict)
+		return
+	}
+	n, err := s.state.Compact(s.printers.Specs)
+	if err != nil {
+		http.Error(w, "Failed to compact the state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := map[string]int{"bytes": n}
+	s.audit(r, "compact", "", resp)
+	writeJSON(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTestState returns a state saving the printers to path, logging to the returned
+// buffer. It must be called after newTestPrinters.
+func newTestState(t *testing.T, p *printers, path string) (*state, *bytes.Buffer) {
+	t.Helper()
+	var log bytes.Buffer
+	st := &state{path: path, logger: slog.New(slog.NewTextHandler(&log, nil)), format: stateFormat("auto", path)}
+	p.onChange = func() { st.Save(p.Specs) }
+	// Nothing is saved anymore while the printers stop at the end of the test,
+	// which would race with the removal of the temporary directory.
+	t.Cleanup(func() { st.Flush(p.Specs) })
+	return st, &log
+}
+
+func TestUnwritableState(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	p, _ := newTestPrinters(t, realClock{})
+	st, log := newTestState(t, p, filepath.Join(dir, "state.json"))
+	s := newTestServer(p)
+	s.state = st
+
+	healthy := func() bool {
+		var resp struct {
+			PersistenceHealthy bool `json:"persistence_healthy"`
+		}
+		if err := json.NewDecoder(serve(t, s, http.MethodGet, "/api/stats", "").Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.PersistenceHealthy
+	}
+	if !healthy() {
+		t.Error("unhealthy before saving anything")
+	}
+	mustAdd(t, p, spec{Name: "a", Period: 60}, spec{Name: "b", Period: 60}, spec{Name: "c", Period: 60})
+	if n := len(p.List()); n != 3 {
+		t.Errorf("%d printers, want all of them added", n)
+	}
+	if n := strings.Count(log.String(), "level=WARN"); n != 1 {
+		t.Errorf("logged %q, want a single warning", log.String())
+	}
+	if healthy() {
+		t.Error("healthy after failing to save")
+	}
+	if w := serve(t, s, http.MethodPost, "/api/state/compact", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("compact: status %d, want 500 while the directory is missing", w.Code)
+	}
+
+	// Compacting once the file can be written saves again.
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(t, s, http.MethodPost, "/api/state/compact", ""); w.Code != http.StatusOK {
+		t.Fatalf("compact: status %d: %s", w.Code, w.Body)
+	}
+	if !healthy() {
+		t.Error("unhealthy after compacting")
+	}
+	mustAdd(t, p, spec{Name: "d", Period: 60})
+	specs, err := st.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 4 {
+		t.Errorf("saved %+v, want the 4 printers", specs)
+	}
+}
+
+func TestCompactState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	p, _ := newTestPrinters(t, realClock{})
+	s := newTestServer(p)
+	if w := serve(t, s, http.MethodPost, "/api/state/compact", ""); w.Code != http.StatusConflict {
+		t.Errorf("status %d without -state, want 409", w.Code)
+	}
+
+	st, _ := newTestState(t, p, path)
+	s.state = st
+	mustAdd(t, p, spec{Name: "a", Period: 60}, spec{Name: "b", Period: 5})
+	// A stale entry, which the running printers don't have.
+	if err := os.WriteFile(path, []byte(`[{"name": "stale", "period": 1}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w := serve(t, s, http.MethodPost, "/api/state/compact", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct{ Bytes int }
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() != int64(resp.Bytes) || fi.Mode().Perm() != 0o644 {
+		t.Errorf("got %v and %v, want a file of %d bytes with the mode 0644", fi, err, resp.Bytes)
+	}
+	specs, err := st.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 2 || specs[0].Name != "a" || specs[1].Name != "b" {
+		t.Errorf("saved %+v, want the running printers", specs)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*.tmp")); len(tmp) != 0 {
+		t.Errorf("temporary files %q left", tmp)
+	}
+	// Nothing is written once the state is flushed for the shutdown.
+	st.Flush(p.Specs)
+	if w := serve(t, s, http.MethodPost, "/api/state/compact", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d once flushed, want 500", w.Code)
+	}
+}
+
+func TestStateWriteAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	st := &state{path: path, logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)), format: stateFormat("auto", path)}
+	specs := []spec{{Name: "a", Period: 60, Text: strings.Repeat("x", 64<<10)}}
+	if _, err := st.write(specs); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file can be read whole at any time while it is rewritten.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 50 {
+			specs[0].Period = i + 1
+			if _, err := st.write(specs); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+		}
+		if got, err := st.Load(); err != nil || len(got) != 1 || len(got[0].Text) != 64<<10 {
+			t.Fatalf("read a partial file: %v", err)
+		}
+	}
+
+	// When the write fails, here because a directory is in the way of the rename,
+	// the temporary file is removed and what was there is left as is.
+	blocked := &state{path: filepath.Join(dir, "blocked"), format: "json"}
+	if err := os.MkdirAll(filepath.Join(blocked.path, "entry"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blocked.write(specs); err == nil {
+		t.Error("no error writing over a directory")
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(dir, ".*.tmp")); len(tmp) != 0 {
+		t.Errorf("temporary files %q left", tmp)
+	}
+	if _, err := os.Stat(filepath.Join(blocked.path, "entry")); err != nil {
+		t.Errorf("the directory was changed: %v", err)
+	}
+}
+
+func TestStateFormat(t *testing.T) {
+	tests := []struct {
+		format, path, want string
+	}{
+		{"auto", "state.json", "json"},
+		{"auto", "state", "json"},
+		{"auto", "state.gob", "gob"},
+		{"json", "state.gob", "json"},
+		{"gob", "state.json", "gob"},
+	}
+	for _, tt := range tests {
+		if got := stateFormat(tt.format, tt.path); got != tt.want {
+			t.Errorf("stateFormat(%q, %q) = %q, want %q", tt.format, tt.path, got, tt.want)
+		}
+	}
+}
+
+// manySpecs returns n specs using most of the fields.
+func manySpecs(n int) []spec {
+	specs := make([]spec, n)
+	for i := range specs {
+		specs[i] = spec{
+			Name:     fmt.Sprintf("printer-%d", i),
+			Period:   1 + i%60,
+			Color:    "#FF8800",
+			Priority: i % 3,
+			Fields:   map[string]string{"i": strconv.Itoa(i)},
+			Dim:      i%2 == 0,
+			Cycle:    i%5 == 0,
+			Palette:  []string{"#FF0000", "#00FF00"},
+		}
+	}
+	return specs
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	want := manySpecs(2000)
+	for _, name := range []string{"state.json", "state.gob"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			st := &state{path: path, logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)), format: stateFormat("auto", path)}
+			if _, err := st.write(want); err != nil {
+				t.Fatal(err)
+			}
+			got, err := st.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("loaded %d specs different from the %d saved", len(got), len(want))
+			}
+			// The other format reads the file too, so that changing -stateformat keeps the printers.
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isJSON := b[0] == '['; isJSON != (st.format == "json") {
+				t.Errorf("the %s file starts with %q", st.format, b[0])
+			}
+		})
+	}
+
+	// A file in neither format is an error, as is an empty one, and null has no printers.
+	if _, err := decodeSpecs([]byte("printers: a, b")); err == nil {
+		t.Error("decoded a file in no format")
+	}
+	if specs, err := decodeSpecs(nil); err == nil || specs != nil {
+		t.Errorf("an empty file gave %+v and %v, want an error", specs, err)
+	}
+	if specs, err := decodeSpecs([]byte("null")); err != nil || specs != nil {
+		t.Errorf("null gave %+v and %v, want no printers", specs, err)
+	}
+}
+
+func BenchmarkDecodeSpecs(b *testing.B) {
+	specs := manySpecs(5000)
+	for _, format := range []string{"json", "gob"} {
+		buf, err := encodeSpecs(specs, format)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(format, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := decodeSpecs(buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
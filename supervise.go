@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// How often the supervisor looks for stalled printers.
+const superviseInterval = time.Second
+
+// Restart replaces the goroutine of a printer by a new one, keeping its id and its
+// settings, and asks the old one to stop. A boost is canceled, and the period from
+// before it is restored. It returns ErrNotFound if there is no printer for this
+// string, or if it is stopping.
+func (p *printers) Restart(s string) error {
+	p.mu.Lock()
+	old, ok := p.l[s]
+	if !ok || old.stopping {
+		p.mu.Unlock()
+		return ErrNotFound
+	}
+
+	period := old.period
+	if old.boost != nil {
+		period = old.unboosted
+	}
+	old.cancelBoost()
+	// Everything else is kept, such as the last error and the drift, which tell
+	// why it stalled.
+	pr := new(printer)
+	*pr = *old
+	pr.done = make(chan struct{}, 1)
+	pr.running = make(chan struct{})
+	pr.exited = make(chan struct{})
+	pr.reset = make(chan struct{}, 1)
+	pr.stopping = false
+	pr.started = p.clock.Now()
+	pr.period = period
+	// The old goroutine doesn't remove the printer once it's replaced.
+	p.l[s] = pr
+	old.stopping = true
+	notify(old.done)
+	go p.runPrinter(s, pr)
+	p.mu.Unlock()
+	return nil
+}
+
+// How long the startup waits for the goroutines of the printers to run before
+// being ready anyway.
+const startTimeout = 10 * time.Second
+
+// waitRunning waits up to `timeout` for the goroutines of the current printers
+// to run, and returns how many didn't.
+func (p *printers) waitRunning(timeout time.Duration) int {
+	p.mu.Lock()
+	running := make([]chan struct{}, 0, len(p.l))
+	for _, pr := range p.l {
+		running = append(running, pr.running)
+	}
+	p.mu.Unlock()
+
+	timer := p.clock.NewTimer(timeout)
+	defer timer.Stop()
+	for i, c := range running {
+		select {
+		case <-c:
+		case <-timer.C():
+			n := 0
+			for _, c := range running[i:] {
+				select {
+				case <-c:
+				default:
+					n++
+				}
+			}
+			return n
+		}
+	}
+	return 0
+}
+
+// supervise restarts the stalled printers every `interval`, until ctx is done.
+func (p *printers) supervise(ctx context.Context, interval time.Duration) {
+	ticker := p.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C():
+			var stalled []string
+			p.mu.Lock()
+			for k, v := range p.l {
+				if !v.stopping && v.stalled(now) {
+					stalled = append(stalled, k)
+				}
+			}
+			p.mu.Unlock()
+
+			for _, s := range stalled {
+				if p.Restart(s) == nil {
+					p.restarts.Add(1)
+					slog.Warn("restarted a stalled printer", "name", s)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countLines returns the number of lines printed by the printer.
+func countLines(sk *testSink, name string) int {
+	n := 0
+	for _, l := range sk.Lines() {
+		if strings.HasSuffix(l, " "+name) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSuperviseRestartsWedged(t *testing.T) {
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	// The guard blocks the goroutine of the printer until the file exists.
+	unblock := filepath.Join(t.TempDir(), "unblock")
+	guard := "while [ ! -e '" + unblock + "' ]; do sleep 0.01; done"
+	mustAdd(t, p, spec{Name: "wedged", Period: 1, Guard: guard}, spec{Name: "healthy", Period: 1})
+	before, _ := p.Get("wedged")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.supervise(ctx, time.Second)
+	waitTimers(t, c, 3)
+
+	// Within twice its period, a printer isn't stalled.
+	for i := 1; i <= 3; i++ {
+		c.Advance(time.Second)
+		waitFor(t, "the healthy printer", func() bool { return countLines(sk, "healthy") == i })
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := p.Stats().Restarts; n != 0 {
+		t.Fatalf("%d restarts within the grace period", n)
+	}
+	c.Advance(time.Second)
+	waitFor(t, "the restart", func() bool { return p.Stats().Restarts == 1 })
+
+	if err := os.WriteFile(unblock, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The old goroutine exits once its guard returns.
+	waitFor(t, "the old goroutine to exit", func() bool { return printerGoroutines() == 2 })
+	waitTimers(t, c, 3)
+	after, _ := p.Get("wedged")
+	if after.ID != before.ID || after.Period != 1 {
+		t.Errorf("restarted as id %d with the period %d, want id %d with the period 1", after.ID, after.Period, before.ID)
+	}
+	printed := countLines(sk, "wedged")
+	c.Advance(time.Second)
+	waitFor(t, "the restarted printer", func() bool { return countLines(sk, "wedged") > printed })
+	if n := p.Stats().Restarts; n != 1 {
+		t.Errorf("%d restarts, want only the wedged printer", n)
+	}
+}
+
+func TestRestartKeepsState(t *testing.T) {
+	tests := []struct {
+		name  string
+		boost bool
+	}{
+		{"plain", false},
+		{"boosted", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClock()
+			p, sk := newTestPrinters(t, c)
+			mustAdd(t, p, spec{Name: "a", Period: 10, Color: "#FF0000", Pinned: true})
+			waitTicker(t, c, 10*time.Second)
+			tick(t, c, 10*time.Second, sk, 1)
+			if tt.boost {
+				if err := p.Boost("a", time.Second, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// What the printer recorded while stalling.
+			p.mu.Lock()
+			pr := p.l["a"]
+			pr.err, pr.drift, pr.maxDrift, pr.maxGap = "guard: exit status 1", 3*time.Second, 2*time.Second, 25*time.Second
+			p.mu.Unlock()
+			before, _ := p.Get("a")
+
+			if err := p.Restart("a"); err != nil {
+				t.Fatal(err)
+			}
+			after, _ := p.Get("a")
+			if after.Error != before.Error || after.Drift != 3 || after.MaxDrift != 2 || after.MaxGap != 25 {
+				t.Errorf("restarted with the error %q, drift %g, max drift %g and max gap %g, want them kept", after.Error, after.Drift, after.MaxDrift, after.MaxGap)
+			}
+			if after.ID != before.ID || after.Color != "#FF0000" || !after.Pinned || after.Ticked != 1 || after.LastTick == nil {
+				t.Errorf("restarted as %+v, want the settings and counters of %+v", after, before)
+			}
+			// A boost is canceled, back to the period from before it.
+			if after.Period != 10 || after.Boosted {
+				t.Errorf("restarted with the period %d and boosted %t, want 10 and not boosted", after.Period, after.Boosted)
+			}
+			// The new goroutine ticks once the old one exited.
+			select {
+			case <-pr.exited:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the old goroutine didn't exit")
+			}
+			waitFor(t, "the new ticker", func() bool { return c.Active() == 1 })
+			tick(t, c, 10*time.Second, sk, 2)
+		})
+	}
+}
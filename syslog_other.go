@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package main
+
+import "errors"
+
+func newSyslogSink() (sink, error) {
+	return nil, errors.New("syslog is not supported on this system")
+}
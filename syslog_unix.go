@@ -0,0 +1,25 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"log/syslog"
+	"strings"
+)
+
+// syslogSink sends lines to the system logger, without colors.
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink() (sink, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, "ticker-printer")
+	if err != nil {
+		return nil, err
+	}
+	return syslogSink{w}, nil
+}
+
+func (s syslogSink) Write(_, plain string) error {
+	return s.w.Info(strings.TrimSuffix(plain, "\n"))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"sync"
+	"time"
+)
+
+// pageData is what the templates are rendered with.
+type pageData struct {
+	Printers []printerInfo
+	Stats    stats
+	// Hides the form and the stop buttons.
+	ReadOnly bool
+	// Makes the table partial also swap the stats line, out of band.
+	OOB bool
+	// Shown above the table, such as why a stop failed.
+	Error string
+	// Either "plain" or "dark".
+	Theme string
+	// Path the routes are served under, to prefix the URLs with.
+	Base string
+}
+
+// Themes accepted by -theme.
+var themes = []string{"plain", "dark"}
+
+// Uptime returns the uptime of the stats, to the second.
+func (d pageData) Uptime() string {
+	return (time.Duration(d.Stats.Uptime) * time.Second).String()
+}
+
+// stopVals returns the hx-vals of the stop buttons of a printer, as JSON since
+// the names can have quotes in them.
+func stopVals(name string, force bool) (string, error) {
+	vals := map[string]any{"item": name, "stop": true}
+	if force {
+		vals["force"] = true
+	}
+	b, err := json.Marshal(vals)
+	return string(b), err
+}
+
+// The templates are only parsed when first rendered, so that they never are
+// with -apionly. They are HTML templates, as the names come from the clients.
+// The form parses its own copy of the table, as an HTML template can't be cloned
+// once executed.
+var (
+	printersTemplate = sync.OnceValue(parsePrinters)
+	formTemplate     = sync.OnceValue(func() *template.Template {
+		return template.Must(parsePrinters().New("form").Parse(formHTML))
+	})
+)
+
+// parsePrinters parses the template of the table.
+func parsePrinters() *template.Template {
+	return template.Must(template.New("numbers").Funcs(template.FuncMap{"stopVals": stopVals}).Parse(printersHTML))
+}
+
+// "Partial" template, with only the table.
+const printersHTML = `
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<table>
+<tr>
+	<th>Name</th>
+	<th>Period</th>
+	<th>Hours</th>
+	{{if not .ReadOnly}}<th></th>{{end}}
+</tr>
+{{range .Printers}}
+<tr>
+	<td{{if eq $.Theme "dark"}} style="color: {{.Color}}{{if .Dim}}; opacity: 0.6{{end}}"{{end}}>{{.Name}}</td>
+	<td>{{if .Cron}}{{.Cron}}{{else if .Mirror}}with {{.Mirror}}{{else if .MaxPeriod}}{{.MinPeriod}}-{{.MaxPeriod}}{{else}}{{.Period}}{{end}}</td>
+	<td>{{.Window}}</td>
+	{{if not $.ReadOnly}}<td>{{if .Pinned}}<button disabled title="Pinned">Stop</button>
+		<button hx-post="{{$.Base}}/" hx-vals="{{stopVals .Name true}}" hx-confirm="This printer is pinned, stop it anyway?" hx-target="#results">Force stop</button>
+		{{- else}}<button hx-post="{{$.Base}}/" hx-vals="{{stopVals .Name false}}" hx-target="#results">Stop</button>{{end}}</td>{{end}}
+</tr>
+{{end}}
+</table>
+{{if .OOB}}{{template "stats" .}}{{end}}
+{{define "stats"}}<span id="stats"{{if .OOB}} hx-swap-oob="true"{{end}}>{{.Stats.Printers}} printers, up {{.Uptime}}{{if .Stats.Frozen}}, frozen{{end}}{{if .Stats.Draining}}, shutting down{{end}}</span>{{end}}
+`
+
+// Main template, with the form and the table.
+const formHTML = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Ticker</title>
+    {{if eq .Theme "dark"}}
+    <style>
+        body { background: #1b1b1f; color: #e6e6e6; font-family: sans-serif; }
+        input, button { background: #2b2b31; color: #e6e6e6; border: 1px solid #6b6b75; }
+        th { text-align: left; border-bottom: 1px solid #6b6b75; }
+        td, th { padding: 0.2em 0.8em; }
+    </style>
+    {{else}}
+    <style>
+        body { font-family: sans-serif; }
+        th { text-align: left; border-bottom: 1px solid #767676; }
+        td, th { padding: 0.2em 0.8em; }
+    </style>
+    {{end}}
+</head>
+<body>
+    {{if not .ReadOnly}}
+    <form hx-boost="true">
+    <fieldset{{if or .Stats.Frozen .Stats.Draining}} disabled{{end}}>
+        <label for="text">Text to print:</label><br>
+        <input type="text" id="text" name="text" required><br>
+		<label for="period">Every (seconds, 5s, 2m, or "every 30 seconds"):</label><br>
+		<input type="text" id="period" name="period" value="1"> <br>
+		<label for="start_hour">Only between these hours (optional):</label><br>
+		<input type="number" id="start_hour" name="start_hour" min="0" max="23">
+		<input type="number" id="end_hour" name="end_hour" min="0" max="23"> <br>
+		<label for="minperiod">Or after a random number of seconds between (optional):</label><br>
+		<input type="number" id="minperiod" name="minperiod" min="1">
+		<input type="number" id="maxperiod" name="maxperiod" min="1"> <br>
+		<label for="printevery">Only print every this many ticks (optional):</label><br>
+		<input type="number" id="printevery" name="printevery" min="1"> <br>
+		<input type="checkbox" id="precise" name="precise" value="true">
+		<label for="precise">Catch up on late ticks instead of skipping them</label><br>
+		<input type="checkbox" id="dim" name="dim" value="true">
+		<label for="dim">Print dimmed</label><br>
+		<input type="checkbox" id="align" name="align" value="true">
+		<label for="align">Align the ticks on the multiples of the period, such as every hour at :00</label><br>
+		<input type="checkbox" id="pinned" name="pinned" value="true">
+		<label for="pinned">Pin, so that it is only stopped when forced</label><br>
+		<input type="checkbox" id="cycle" name="cycle" value="true">
+		<label for="cycle">Cycle through colors, one per line</label><br>
+		<input type="checkbox" id="countdown" name="countdown" value="true">
+		<label for="countdown">Count down the 3 seconds before each tick</label><br>
+		<label for="offset">Offset of the aligned ticks (optional, such as 5m for :05):</label><br>
+		<input type="text" id="offset" name="offset"> <br>
+		<label for="sink">Destination of -sink to print to (optional):</label><br>
+		<input type="text" id="sink" name="sink"> <br>
+		<label for="mirror">Or whenever this other printer ticks (optional):</label><br>
+		<input type="text" id="mirror" name="mirror"> <br>
+		<label for="cron">Or on a cron schedule (optional):</label><br>
+		<input type="text" id="cron" name="cron" placeholder="0 9 * * 1-5"> <br>
+        <button hx-post="{{.Base}}/" hx-target="#results">Launch a printer</button>
+    </fieldset>
+    </form>
+    {{end}}
+	<p>{{template "stats" .}}</p>
+	<div id="results">
+		{{template "numbers" .}}
+	</div>
+	<script src="https://unpkg.com/htmx.org@1.9.2"
+        integrity="sha384-L6OqL9pRWyyFU3+/bjdSri+iIphTN/bvYyM37tICVyOJkWZLpP2vGn6VUEXgzg6h"
+        crossorigin="anonymous"></script>
+</body>
+</html>
+`
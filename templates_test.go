@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var hxValsRe = regexp.MustCompile(`hx-vals="([^"]*)"`)
+
+func TestPageEscapesNames(t *testing.T) {
+	names := []string{`<b>bold</b>`, `say "hi"`, `it's & co`, `"}, "stop": false, "x": {"`}
+	p, _ := newTestPrinters(t, realClock{})
+	for _, name := range names {
+		mustAdd(t, p, spec{Name: name, Period: 60})
+	}
+	mustAdd(t, p, spec{Name: "pinned <i>", Period: 60, Pinned: true})
+	body := serve(t, newTestServer(p), http.MethodGet, "/", "").Body.String()
+	if strings.Contains(body, "<b>") || strings.Contains(body, "<i>") {
+		t.Error("a name was rendered as HTML")
+	}
+
+	vals := hxValsRe.FindAllStringSubmatch(body, -1)
+	if len(vals) != len(names)+1 {
+		t.Fatalf("got %d stop buttons, want %d", len(vals), len(names)+1)
+	}
+	seen := map[string]bool{}
+	for _, m := range vals {
+		var v struct {
+			Item  string
+			Stop  bool
+			Force bool
+		}
+		if err := json.Unmarshal([]byte(html.UnescapeString(m[1])), &v); err != nil {
+			t.Fatalf("hx-vals %s isn't JSON: %v", m[1], err)
+		}
+		if !v.Stop || v.Force != strings.HasPrefix(v.Item, "pinned") {
+			t.Errorf("hx-vals of %q are %+v", v.Item, v)
+		}
+		seen[v.Item] = true
+	}
+	for _, name := range append(names, "pinned <i>") {
+		if !seen[name] {
+			t.Errorf("no stop button for %q", name)
+		}
+	}
+}
+
+func TestFormAddSwapsStats(t *testing.T) {
+	withConfig(t, config{DefaultPeriod: 1})
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 60})
+	s := newTestServer(p)
+
+	w := httptest.NewRecorder()
+	s.routes().ServeHTTP(w, formRequest(url.Values{"text": {"b"}, "period": {"5"}}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "<table>") || !strings.Contains(body, "<td>5</td>") {
+		t.Errorf("no table with the new printer in %q", body)
+	}
+	if !strings.Contains(body, `<span id="stats" hx-swap-oob="true">2 printers, up `) {
+		t.Errorf("no stats swapped out of band in %q", body)
+	}
+	if strings.Contains(body, "<form") {
+		t.Error("the response has the whole page, want the partial")
+	}
+
+	// The page is rendered after the partial, which html/template can't clone then.
+	page := serve(t, s, http.MethodGet, "/", "").Body.String()
+	if !strings.Contains(page, `<span id="stats">2 printers, up `) {
+		t.Errorf("no stats, in place, in the page %q", page)
+	}
+}
+
+func TestThemes(t *testing.T) {
+	tests := []struct {
+		theme string
+		style string
+		// Whether the names are in their color.
+		colored bool
+	}{
+		{"plain", "body { font-family: sans-serif; }", false},
+		{"dark", "background: #1b1b1f", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.theme, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			mustAdd(t, p, spec{Name: "a", Period: 60, Color: "#AA00BB"})
+			s := newTestServer(p)
+			s.theme = tt.theme
+			page := serve(t, s, http.MethodGet, "/", "").Body.String()
+			if !strings.Contains(page, "<style>") || !strings.Contains(page, tt.style) {
+				t.Errorf("no style block with %q in the page", tt.style)
+			}
+			for _, other := range tests {
+				if other.theme != tt.theme && strings.Contains(page, other.style) {
+					t.Errorf("the style of %s is in the page", other.theme)
+				}
+			}
+			if got := strings.Contains(page, `style="color: #AA00BB"`); got != tt.colored {
+				t.Errorf("name in its color %t, want %t", got, tt.colored)
+			}
+		})
+	}
+}
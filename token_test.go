@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestToken(t *testing.T) {
+	tests := []struct {
+		name           string
+		readOpen       bool
+		method, target string
+		headers        []string
+		want           int
+	}{
+		{"valid token", false, http.MethodPost, "/api/printers/bulk", []string{"Authorization", "Bearer secret"}, http.StatusOK},
+		{"lowercase scheme", false, http.MethodPost, "/api/printers/bulk", []string{"Authorization", "bearer secret"}, http.StatusOK},
+		{"uppercase scheme", false, http.MethodPost, "/api/printers/bulk", []string{"Authorization", "BEARER secret"}, http.StatusOK},
+		{"scheme only", false, http.MethodPost, "/api/printers/bulk", []string{"Authorization", "Bearer"}, http.StatusUnauthorized},
+		{"missing token", false, http.MethodPost, "/api/printers/bulk", nil, http.StatusUnauthorized},
+		{"wrong token", false, http.MethodPost, "/api/printers/bulk", []string{"Authorization", "Bearer guess"}, http.StatusUnauthorized},
+		{"basic auth", false, http.MethodPost, "/api/printers/bulk", []string{"Authorization", "Basic YTpiCg=="}, http.StatusUnauthorized},
+		{"read without token", false, http.MethodGet, "/api/printers", nil, http.StatusUnauthorized},
+		{"health checks", false, http.MethodGet, "/healthz", nil, http.StatusOK},
+		{"readiness", false, http.MethodGet, "/readyz", nil, http.StatusOK},
+		{"open read", true, http.MethodGet, "/api/printers", nil, http.StatusOK},
+		{"open page", true, http.MethodGet, "/", nil, http.StatusOK},
+		{"open write", true, http.MethodPost, "/api/printers/bulk", nil, http.StatusUnauthorized},
+		{"open read with a wrong token", true, http.MethodGet, "/api/printers", []string{"Authorization", "Bearer guess"}, http.StatusUnauthorized},
+		{"private export", true, http.MethodGet, "/api/export.sh", nil, http.StatusUnauthorized},
+		{"private CSV", true, http.MethodGet, "/api/printers", []string{"Accept", "text/csv"}, http.StatusUnauthorized},
+		{"private audit log", true, http.MethodGet, "/api/audit", nil, http.StatusUnauthorized},
+		{"private debug", true, http.MethodGet, "/debug/stacks", nil, http.StatusUnauthorized},
+		{"private export with the token", true, http.MethodGet, "/api/export.sh", []string{"Authorization", "Bearer secret"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPrinters(t, realClock{})
+			s := newTestServer(p)
+			s.token, s.readOpen = "secret", tt.readOpen
+			body := ""
+			if tt.method == http.MethodPost {
+				body = `[{"name": "a", "period": 5}]`
+			}
+			w := serve(t, s, tt.method, tt.target, body, tt.headers...)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if w.Code == http.StatusUnauthorized && !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Bearer ") {
+				t.Errorf("WWW-Authenticate is %q, want a bearer challenge", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestTokenHidesGuards(t *testing.T) {
+	p, _ := newTestPrinters(t, realClock{})
+	mustAdd(t, p, spec{Name: "a", Period: 60, Guard: "true"})
+	s := newTestServer(p)
+	s.token, s.readOpen = "secret", true
+	tests := []struct {
+		target  string
+		headers []string
+		guard   string
+	}{
+		{"/api/printers/a", nil, ""},
+		{"/api/printers/a", []string{"Authorization", "Bearer secret"}, "true"},
+		{"/api/printers", nil, ""},
+		{"/api/printers", []string{"Authorization", "Bearer secret"}, "true"},
+	}
+	for _, tt := range tests {
+		w := serve(t, s, http.MethodGet, tt.target, "", tt.headers...)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", tt.target, w.Code)
+		}
+		var info printerInfo
+		b := w.Body.Bytes()
+		if tt.target == "/api/printers" {
+			var list []printerInfo
+			if err := json.Unmarshal(b, &list); err != nil || len(list) != 1 {
+				t.Fatalf("%s: %s: %v", tt.target, b, err)
+			}
+			info = list[0]
+		} else if err := json.Unmarshal(b, &info); err != nil {
+			t.Fatal(err)
+		}
+		if info.Guard != tt.guard {
+			t.Errorf("%s with %q: the guard is %q, want %q", tt.target, tt.headers, info.Guard, tt.guard)
+		}
+	}
+}
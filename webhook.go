@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Events accepted by -webhook-events.
+var webhookEvents = []string{"add", "stop", "tick"}
+
+const (
+	// Number of events waiting to be sent, the ones past it are dropped.
+	webhookQueueSize = 256
+	// Timeout of each attempt at sending an event.
+	webhookTimeout = 5 * time.Second
+	// Number of attempts at sending an event, and the wait before the second
+	// one, doubled after each failure.
+	webhookAttempts = 3
+	webhookBackoff  = time.Second
+	// Maximum number of tick events sent per second by all the printers together.
+	webhookTickRate = 1
+)
+
+// webhookEvent is the JSON body posted to the webhook.
+type webhookEvent struct {
+	Event string    `json:"event"`
+	Name  string    `json:"name"`
+	Time  time.Time `json:"time"`
+	// The printer as it was added, only for the add events.
+	Spec *spec `json:"spec,omitempty"`
+}
+
+// webhook posts the events of the printers to a URL from its own goroutine,
+// so that sending them never blocks the printers or the requests.
+type webhook struct {
+	url    string
+	events map[string]bool
+	client *http.Client
+	clock  Clock
+	queue  chan webhookEvent
+
+	// Limits the tick events, which are sent from every printer.
+	mu    sync.Mutex
+	ticks *limiter
+
+	sent    atomic.Int64
+	failed  atomic.Int64
+	dropped atomic.Int64
+	// Where the failures are recorded, nil for nowhere.
+	errors *errorLog
+}
+
+// newWebhook returns a webhook posting the given events to `url`, once run is called.
+func newWebhook(url string, events []string, clock Clock) *webhook {
+	wh := &webhook{
+		url:    url,
+		events: make(map[string]bool),
+		client: &http.Client{Timeout: webhookTimeout},
+		clock:  clock,
+		queue:  make(chan webhookEvent, webhookQueueSize),
+		ticks:  newLimiter(webhookTickRate, clock.Now()),
+	}
+	for _, e := range events {
+		wh.events[e] = true
+	}
+	return wh
+}
+
+// parseWebhookEvents parses a comma-separated list of webhookEvents.
+func parseWebhookEvents(s string) ([]string, error) {
+	var events []string
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if !slices.Contains(webhookEvents, e) {
+			return nil, fmt.Errorf("unknown event %q, expected %s", e, strings.Join(webhookEvents, ", "))
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// validateWebhookURL checks that the webhook is an absolute HTTP URL.
+func validateWebhookURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("expected an http or https URL")
+	}
+	return nil
+}
+
+// send queues an event if it is one of the events of the webhook, and drops it
+// if the queue is full or, for the ticks, if there were too many of them.
+// It does nothing on a nil webhook.
+func (wh *webhook) send(ev webhookEvent) {
+	if wh == nil || !wh.events[ev.Event] {
+		return
+	}
+	if ev.Event == "tick" {
+		wh.mu.Lock()
+		ok := wh.ticks.allow(wh.clock.Now())
+		wh.mu.Unlock()
+		if !ok {
+			wh.dropped.Add(1)
+			return
+		}
+	}
+	select {
+	case wh.queue <- ev:
+	default:
+		wh.dropped.Add(1)
+		slog.Debug("dropping a webhook event, the queue is full", "event", ev.Event, "name", ev.Name)
+	}
+}
+
+// run sends the queued events one at a time, and never returns.
+func (wh *webhook) run() {
+	for ev := range wh.queue {
+		if err := wh.deliver(ev); err != nil {
+			wh.failed.Add(1)
+			slog.Warn("failed to send a webhook event", "event", ev.Event, "name", ev.Name, "error", err)
+			wh.errors.add("webhook", ev.Name, err)
+			continue
+		}
+		wh.sent.Add(1)
+	}
+}
+
+// deliver posts an event, retrying on network errors and server errors up to
+// webhookAttempts times. Client errors are not retried, as they would fail again.
+func (wh *webhook) deliver(ev webhookEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := wh.post(body)
+		if err == nil || !retry || attempt == webhookAttempts {
+			return err
+		}
+		slog.Debug("retrying a webhook event", "event", ev.Event, "name", ev.Name, "attempt", attempt, "error", err)
+		t := wh.clock.NewTimer(backoff)
+		<-t.C()
+		backoff *= 2
+	}
+}
+
+// post sends the body once, and reports whether a failure is worth retrying.
+func (wh *webhook) post(body []byte) (retry bool, err error) {
+	resp, err := wh.client.Post(wh.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return false, nil
+}
+
+// webhookStats are the counters of the webhook.
+type webhookStats struct {
+	Sent    int64 `json:"sent_total"`
+	Failed  int64 `json:"failures_total"`
+	Dropped int64 `json:"dropped_total"`
+}
+
+// Stats returns the counters of the webhook, or nil on a nil webhook.
+func (wh *webhook) Stats() *webhookStats {
+	if wh == nil {
+		return nil
+	}
+	return &webhookStats{Sent: wh.sent.Load(), Failed: wh.failed.Load(), Dropped: wh.dropped.Load()}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookServer returns a server receiving the events of a webhook, and
+// answering each attempt with the next status, then with 204.
+func webhookServer(t *testing.T, statuses ...int) (*httptest.Server, chan webhookEvent, *atomic.Int64) {
+	t.Helper()
+	events := make(chan webhookEvent, 16)
+	var attempts atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(attempts.Add(1))
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("%s with the content type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		var ev webhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Error(err)
+		}
+		events <- ev
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, events, &attempts
+}
+
+// receive returns the next event received by the webhook server.
+func receive(t *testing.T, events chan webhookEvent) webhookEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook event")
+		return webhookEvent{}
+	}
+}
+
+func TestParseWebhookEvents(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  []string
+		valid bool
+	}{
+		{"add,stop", []string{"add", "stop"}, true},
+		{" add , tick ", []string{"add", "tick"}, true},
+		{"", nil, true},
+		{"stop,", []string{"stop"}, true},
+		{"add,restart", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseWebhookEvents(tt.in)
+		if (err == nil) != tt.valid || !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %q and %v, want %q and valid %t", tt.in, got, err, tt.want, tt.valid)
+		}
+	}
+}
+
+func TestWebhookValidation(t *testing.T) {
+	tests := []struct {
+		args  []string
+		valid bool
+	}{
+		{[]string{"-webhook", "http://localhost:9000/events"}, true},
+		{[]string{"-webhook", "https://example.com/hook", "-webhook-events", "add,stop,tick"}, true},
+		{[]string{"-webhook", "localhost:9000"}, false},
+		{[]string{"-webhook", "ftp://example.com/hook"}, false},
+		{[]string{"-webhook", "http:///hook"}, false},
+		{[]string{"-webhook-events", "boot"}, false},
+	}
+	for _, tt := range tests {
+		c := parseFlags(t, tt.args...)
+		if errs, _ := c.validate(); (len(errs) == 0) != tt.valid {
+			t.Errorf("%q: errors %v, want valid %t", tt.args, errs, tt.valid)
+		}
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	srv, events, _ := webhookServer(t)
+	p, _ := newTestPrinters(t, realClock{})
+	p.webhook = newWebhook(srv.URL, []string{"add", "stop"}, realClock{})
+	go p.webhook.run()
+
+	mustAdd(t, p, spec{Name: "a", Period: 60, Color: "#00FF00"})
+	ev := receive(t, events)
+	if ev.Event != "add" || ev.Name != "a" || ev.Time.IsZero() || ev.Spec == nil || ev.Spec.Period != 60 || ev.Spec.Color != "#00FF00" {
+		t.Errorf("got %+v, want the add event of a with its spec", ev)
+	}
+	if res := p.Stop("a", false); res != stopped {
+		t.Fatalf("got %s, want %s", res, stopped)
+	}
+	ev = receive(t, events)
+	if ev.Event != "stop" || ev.Name != "a" || ev.Spec != nil {
+		t.Errorf("got %+v, want the stop event of a", ev)
+	}
+	waitFor(t, "the counters", func() bool { return p.Stats().Webhook.Sent == 2 })
+}
+
+func TestWebhookEventSet(t *testing.T) {
+	srv, events, _ := webhookServer(t)
+	p, _ := newTestPrinters(t, realClock{})
+	p.webhook = newWebhook(srv.URL, []string{"stop"}, realClock{})
+	go p.webhook.run()
+
+	mustAdd(t, p, spec{Name: "a", Period: 60})
+	p.Stop("a", false)
+	if ev := receive(t, events); ev.Event != "stop" {
+		t.Errorf("got the %s event first, want only the stop one", ev.Event)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		// Number of attempts, and whether the event is sent in the end.
+		attempts int64
+		sent     bool
+	}{
+		{"sent", nil, 1, true},
+		{"retried after server errors", []int{http.StatusInternalServerError, http.StatusTooManyRequests}, 3, true},
+		{"given up after the attempts", []int{502, 502, 502}, webhookAttempts, false},
+		{"client error not retried", []int{http.StatusBadRequest}, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClock()
+			srv, events, attempts := webhookServer(t, tt.statuses...)
+			wh := newWebhook(srv.URL, []string{"add"}, c)
+			go wh.run()
+			wh.send(webhookEvent{Event: "add", Name: "a"})
+
+			// Each retry waits for twice as long as the one before.
+			backoff := webhookBackoff
+			for i := int64(1); i < tt.attempts; i++ {
+				waitFor(t, "the attempt", func() bool { return attempts.Load() == i })
+				waitTimers(t, c, 1)
+				c.Advance(backoff)
+				backoff *= 2
+			}
+			if tt.sent {
+				receive(t, events)
+			}
+			waitFor(t, "the counters", func() bool { st := wh.Stats(); return st.Sent+st.Failed == 1 })
+			if st := wh.Stats(); (st.Sent == 1) != tt.sent {
+				t.Errorf("got %+v, want sent %t", st, tt.sent)
+			}
+			if n := attempts.Load(); n != tt.attempts {
+				t.Errorf("%d attempts, want %d", n, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestWebhookDrops(t *testing.T) {
+	c := newFakeClock()
+	// Not run, so that the events stay queued.
+	wh := newWebhook("http://localhost/", []string{"add", "tick"}, c)
+
+	// The ticks are limited to webhookTickRate per second.
+	for range 3 {
+		wh.send(webhookEvent{Event: "tick", Name: "a"})
+	}
+	if st := wh.Stats(); st.Dropped != 3-webhookTickRate {
+		t.Errorf("%d ticks dropped, want %d", st.Dropped, 3-webhookTickRate)
+	}
+	c.Advance(time.Second)
+	wh.send(webhookEvent{Event: "tick", Name: "a"})
+	if n := len(wh.queue); n != 2*webhookTickRate {
+		t.Errorf("%d events queued, want %d", n, 2*webhookTickRate)
+	}
+
+	// Past the size of the queue, the events are dropped without waiting.
+	for range webhookQueueSize {
+		wh.send(webhookEvent{Event: "add", Name: "a"})
+	}
+	if st := wh.Stats(); st.Dropped != 3-webhookTickRate+2*webhookTickRate {
+		t.Errorf("%d events dropped, want %d", st.Dropped, 3-webhookTickRate+2*webhookTickRate)
+	}
+	// A nil webhook sends nothing, and has no counters.
+	var none *webhook
+	none.send(webhookEvent{Event: "add"})
+	if none.Stats() != nil {
+		t.Error("counters of a nil webhook")
+	}
+}
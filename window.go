@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// window restricts printing to the hours in [Start, End), in local time.
+// It crosses midnight when Start is after End, and is always open when both are equal.
+type window struct {
+	Start int `json:"start_hour"`
+	End   int `json:"end_hour"`
+}
+
+// open reports whether t is inside the window.
+func (w window) open(t time.Time) bool {
+	h := t.Hour()
+	switch {
+	case w.Start == w.End:
+		return true
+	case w.Start < w.End:
+		return h >= w.Start && h < w.End
+	default:
+		return h >= w.Start || h < w.End
+	}
+}
+
+// String returns the window as "9h-17h", or an empty string if it is always open.
+func (w window) String() string {
+	if w.Start == w.End {
+		return ""
+	}
+	return fmt.Sprintf("%dh-%dh", w.Start, w.End)
+}
+
+// parseWindow parses the hours of a window from form values.
+// Both must be given, or none for a window that is always open.
+func parseWindow(start, end string) (window, error) {
+	if start == "" && end == "" {
+		return window{}, nil
+	}
+	if start == "" || end == "" {
+		return window{}, errors.New("both start_hour and end_hour are needed")
+	}
+
+	var w window
+	var err error
+	if w.Start, err = parseHour(start); err != nil {
+		return window{}, fmt.Errorf("start_hour: %w", err)
+	}
+	if w.End, err = parseHour(end); err != nil {
+		return window{}, fmt.Errorf("end_hour: %w", err)
+	}
+	return w, nil
+}
+
+func parseHour(s string) (int, error) {
+	h, err := strconv.Atoi(s)
+	if err != nil || !validHour(h) {
+		return 0, errors.New("must be an hour between 0 and 23")
+	}
+	return h, nil
+}
+
+func validHour(h int) bool {
+	return h >= 0 && h <= 23
+}
+
+// validate checks that both hours of the window are between 0 and 23.
+func (w window) validate() error {
+	if !validHour(w.Start) || !validHour(w.End) {
+		return errors.New("hours must be between 0 and 23")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWindowOpen(t *testing.T) {
+	tests := []struct {
+		w    window
+		hour int
+		want bool
+	}{
+		{window{}, 3, true},
+		{window{9, 9}, 3, true},
+		{window{9, 17}, 9, true},
+		{window{9, 17}, 16, true},
+		{window{9, 17}, 17, false},
+		{window{9, 17}, 8, false},
+		// Across midnight.
+		{window{22, 6}, 23, true},
+		{window{22, 6}, 0, true},
+		{window{22, 6}, 5, true},
+		{window{22, 6}, 6, false},
+		{window{22, 6}, 12, false},
+	}
+	for _, tt := range tests {
+		at := time.Date(2024, 3, 18, tt.hour, 30, 0, 0, time.UTC)
+		if got := tt.w.open(at); got != tt.want {
+			t.Errorf("window %+v at %dh30: open %t, want %t", tt.w, tt.hour, got, tt.want)
+		}
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		start, end string
+		want       window
+		wantErr    string
+	}{
+		{"", "", window{}, ""},
+		{"9", "17", window{9, 17}, ""},
+		{"22", "6", window{22, 6}, ""},
+		{"9", "", window{}, "both"},
+		{"", "17", window{}, "both"},
+		{"24", "6", window{}, "start_hour"},
+		{"9", "-1", window{}, "end_hour"},
+		{"nine", "17", window{}, "start_hour"},
+	}
+	for _, tt := range tests {
+		got, err := parseWindow(tt.start, tt.end)
+		switch {
+		case tt.wantErr == "" && (err != nil || got != tt.want):
+			t.Errorf("parseWindow(%q, %q) = %+v, %v, want %+v", tt.start, tt.end, got, err, tt.want)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("parseWindow(%q, %q) returned %v, want an error about %s", tt.start, tt.end, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWindowSuppressesPrinting(t *testing.T) {
+	// The fake clock starts at noon.
+	c := newFakeClock()
+	p, sk := newTestPrinters(t, c)
+	mustAdd(t, p,
+		spec{Name: "noon", Period: 1800, Window: window{12, 13}},
+		spec{Name: "night", Period: 1800, Window: window{13, 12}},
+	)
+	waitTimers(t, c, 2)
+
+	want := []string{"noon", "night", "night"}
+	for i := range want {
+		tick(t, c, 30*time.Minute, sk, i+1)
+	}
+	// Give a wrongly printed line the time to come.
+	time.Sleep(10 * time.Millisecond)
+	got := sk.Lines()
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want one line of noon at 12h30 then night at 13h and 13h30", got)
+	}
+	for i, l := range got {
+		if !strings.HasSuffix(l, " "+want[i]) {
+			t.Errorf("line %d is %q, want %s", i, l, want[i])
+		}
+	}
+	if n := c.Active(); n < 2 {
+		t.Errorf("%d active tickers, want both kept outside of their window", n)
+	}
+}